@@ -0,0 +1,90 @@
+package api
+
+import "time"
+
+type GameVersion string
+
+const (
+	Retail  GameVersion = "retail"
+	Classic GameVersion = "classic"
+)
+
+type Provider string
+
+const (
+	Curse  Provider = "curse"
+	Github Provider = "github"
+)
+
+type Channel string
+
+const (
+	ChannelRelease Channel = "release"
+	ChannelBeta    Channel = "beta"
+	ChannelAlpha   Channel = "alpha"
+)
+
+// Addon is an addon saved by a user, returned by the /addons routes.
+type Addon struct {
+	Id          string      `json:"id"`
+	UserId      string      `json:"user_id"`
+	GameVersion GameVersion `json:"game_version"`
+	Slug        string      `json:"slug"`
+	Name        string      `json:"name"`
+	Author      string      `json:"author"`
+	Provider    Provider    `json:"provider"`
+	ExternalId  string      `json:"external_id"`
+	Url         string      `json:"url"`
+	Version     string      `json:"version"`
+	FileId      string      `json:"file_id"`
+	Channel     Channel     `json:"channel"`
+	Pinned      bool        `json:"pinned"`
+	Directories []string    `json:"directories"`
+	// The only device to install the addon on, nil for all the devices
+	DeviceId *string `json:"device_id"`
+	// The organization requiring the addon when it was installed for it, nil when the user added it
+	OrganizationId *string `json:"organization_id"`
+	// Bumped on every change, and returned as the ETag of the addon
+	Revision  int       `json:"revision"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type DeletedAddon struct {
+	GameVersion GameVersion `json:"game_version"`
+	Slug        string      `json:"slug"`
+	DeletedAt   time.Time   `json:"deleted_at"`
+}
+
+// AddonChanges holds the latest state of every addon saved or deleted after a cursor,
+// and the cursor to ask for the next changes.
+type AddonChanges struct {
+	Cursor  int64          `json:"cursor"`
+	Addons  []Addon        `json:"addons"`
+	Deleted []DeletedAddon `json:"deleted"`
+}
+
+// PutAddonRequest is the body of PUT /addons/{game_version}/{slug}.
+// The install metadata is optional, so older clients can still add addons.
+type PutAddonRequest struct {
+	Name        string   `json:"name" validate:"required"`
+	Author      string   `json:"author" validate:"required"`
+	Provider    Provider `json:"provider" validate:"required,oneof=curse github"`
+	ExternalId  string   `json:"external_id" validate:"required"`
+	Url         string   `json:"url" validate:"required,url"`
+	Version     string   `json:"version"`
+	FileId      string   `json:"file_id"`
+	Channel     Channel  `json:"channel" validate:"omitempty,oneof=release beta alpha"`
+	Pinned      bool     `json:"pinned"`
+	Directories []string `json:"directories"`
+	DeviceId    *string  `json:"device_id"`
+	// OrganizationId marks an addon installed because the organization requires it
+	OrganizationId *string `json:"organization_id"`
+}
+
+// AddAddonRequest is the body of POST /addons.
+type AddAddonRequest struct {
+	GameVersion GameVersion `json:"game_version" validate:"required,oneof=retail classic"`
+	Slug        string      `json:"slug" validate:"required"`
+	PutAddonRequest
+}
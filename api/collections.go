@@ -0,0 +1,50 @@
+package api
+
+import "time"
+
+// AddonReference identifies an addon and where to install it from, without any install data.
+// Collections and organizations share lists of them.
+type AddonReference struct {
+	GameVersion GameVersion `json:"game_version"`
+	Slug        string      `json:"slug"`
+	Name        string      `json:"name"`
+	Author      string      `json:"author"`
+	Provider    Provider    `json:"provider"`
+	ExternalId  string      `json:"external_id"`
+	Url         string      `json:"url"`
+}
+
+type CollectionAddon struct {
+	Id           string `json:"id"`
+	CollectionId string `json:"collection_id"`
+	AddonReference
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Collection is a named list of addons that its owner can share with a code, so others can subscribe and install it.
+type Collection struct {
+	Id     string `json:"id"`
+	UserId string `json:"user_id"`
+	Name   string `json:"name"`
+	// Nil when the collection is not shared
+	ShareCode *string           `json:"share_code"`
+	Addons    []CollectionAddon `json:"addons"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// CreateCollectionRequest is the body of POST /collections.
+type CreateCollectionRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// AddCollectionAddonRequest is the body of POST /collections/{id}/addons.
+type AddCollectionAddonRequest struct {
+	GameVersion GameVersion `json:"game_version" validate:"required,oneof=retail classic"`
+	Slug        string      `json:"slug" validate:"required"`
+	Name        string      `json:"name" validate:"required"`
+	Author      string      `json:"author" validate:"required"`
+	Provider    Provider    `json:"provider" validate:"required,oneof=curse github"`
+	ExternalId  string      `json:"external_id" validate:"required"`
+	Url         string      `json:"url" validate:"required,url"`
+}
@@ -0,0 +1,41 @@
+package api
+
+import "time"
+
+// DeviceAddon is an addon installed on a device, as last reported by it.
+type DeviceAddon struct {
+	GameVersion GameVersion `json:"game_version"`
+	Slug        string      `json:"slug"`
+	Version     string      `json:"version"`
+	ReportedAt  time.Time   `json:"reported_at"`
+}
+
+// Device is a machine running wowa, registered when the user logs in on it.
+type Device struct {
+	Id         string        `json:"id"`
+	UserId     string        `json:"user_id"`
+	Name       string        `json:"name"`
+	Platform   string        `json:"platform"`
+	LastSeenAt time.Time     `json:"last_seen_at"`
+	Addons     []DeviceAddon `json:"addons"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+// RegisterDeviceRequest is the body of POST /devices. Registering a name already registered by the user
+// refreshes that device.
+type RegisterDeviceRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Platform string `json:"platform" validate:"max=50"`
+}
+
+type DeviceAddonReport struct {
+	GameVersion GameVersion `json:"game_version" validate:"required,oneof=retail classic"`
+	Slug        string      `json:"slug" validate:"required"`
+	Version     string      `json:"version"`
+}
+
+// ReportDeviceAddonsRequest is the body of PUT /devices/{id}/addons, replacing the addons of the device.
+type ReportDeviceAddonsRequest struct {
+	Addons []DeviceAddonReport `json:"addons" validate:"dive"`
+}
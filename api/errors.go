@@ -0,0 +1,32 @@
+package api
+
+// ErrorCode tells the clients why a request failed, without parsing the message meant for humans.
+type ErrorCode string
+
+const (
+	ErrorCodeBadRequest        ErrorCode = "bad_request"
+	ErrorCodeValidationFailed  ErrorCode = "validation_failed"
+	ErrorCodeUnauthorized      ErrorCode = "unauthorized"
+	ErrorCodeInvalidToken      ErrorCode = "invalid_token"
+	ErrorCodeInsufficientScope ErrorCode = "insufficient_scope"
+	ErrorCodeForbidden         ErrorCode = "forbidden"
+	ErrorCodeNotFound          ErrorCode = "not_found"
+	ErrorCodeMethodNotAllowed  ErrorCode = "method_not_allowed"
+	ErrorCodeConflict          ErrorCode = "conflict"
+	// The addon does not have the revision of the If-Match header
+	ErrorCodeRevisionMismatch   ErrorCode = "revision_mismatch"
+	ErrorCodeInvalidCredentials ErrorCode = "invalid_credentials"
+	ErrorCodeEmailTaken         ErrorCode = "email_taken"
+	ErrorCodeTooManyRequests    ErrorCode = "too_many_requests"
+	// The addon provider could not be asked, or is not configured on the server
+	ErrorCodeProviderUnavailable ErrorCode = "provider_unavailable"
+	ErrorCodeInternal            ErrorCode = "internal_error"
+)
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// The ID of the request in the server logs
+	RequestId string `json:"request_id,omitempty"`
+}
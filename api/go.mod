@@ -0,0 +1,3 @@
+module wowa-api
+
+go 1.23.2
@@ -0,0 +1,10 @@
+// Package api holds the wire types shared by the wowa server and client, and the OpenAPI document
+// describing the whole HTTP API.
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3.1 document of the API, served by the server at /openapi.json.
+//
+//go:embed openapi.json
+var OpenAPI []byte
@@ -0,0 +1,128 @@
+package api
+
+import "time"
+
+type OrganizationRole string
+
+const (
+	RoleOwner   OrganizationRole = "owner"
+	RoleOfficer OrganizationRole = "officer"
+	RoleMember  OrganizationRole = "member"
+)
+
+type AddonRequirement string
+
+const (
+	// Required addons are installed by the members and checked by the compliance report
+	RequirementRequired    AddonRequirement = "required"
+	RequirementRecommended AddonRequirement = "recommended"
+)
+
+type OrganizationAddon struct {
+	Id             string `json:"id"`
+	OrganizationId string `json:"organization_id"`
+	AddonReference
+	Requirement AddonRequirement `json:"requirement"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+type OrganizationMember struct {
+	UserId    string           `json:"user_id"`
+	Email     string           `json:"email"`
+	Role      OrganizationRole `json:"role"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// Organization is a guild or a team, whose officers maintain the addon sets of its members.
+type Organization struct {
+	Id     string              `json:"id"`
+	Name   string              `json:"name"`
+	Addons []OrganizationAddon `json:"addons"`
+	// The role of the user who requested the organization
+	Role OrganizationRole `json:"role"`
+	// Only returned when getting a single organization
+	Members   []OrganizationMember `json:"members,omitempty"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// OrganizationInvitation lets the user with the email join the organization with the role, once they accept it.
+// Until then they are not a member.
+type OrganizationInvitation struct {
+	Id             string `json:"id"`
+	OrganizationId string `json:"organization_id"`
+	// The name of the organization, which the invited user cannot get yet
+	OrganizationName string           `json:"organization_name"`
+	Email            string           `json:"email"`
+	Role             OrganizationRole `json:"role"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
+
+// CreateOrganizationRequest is the body of POST /orgs.
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// SaveOrganizationMemberRequest is the body of POST /orgs/{id}/members, changing the role of a member.
+type SaveOrganizationMemberRequest struct {
+	Email string           `json:"email" validate:"required,email"`
+	Role  OrganizationRole `json:"role" validate:"required,oneof=officer member"`
+}
+
+// InviteOrganizationMemberRequest is the body of POST /orgs/{id}/invitations.
+type InviteOrganizationMemberRequest struct {
+	Email string           `json:"email" validate:"required,email"`
+	Role  OrganizationRole `json:"role" validate:"required,oneof=officer member"`
+}
+
+// AcceptInvitationRequest is the body of POST /invitations/{id}/accept, with the code mailed with the invitation.
+type AcceptInvitationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// PutOrganizationAddonRequest is the body of PUT /orgs/{id}/addons/{game_version}/{slug}.
+type PutOrganizationAddonRequest struct {
+	Name        string           `json:"name" validate:"required"`
+	Author      string           `json:"author" validate:"required"`
+	Provider    Provider         `json:"provider" validate:"required,oneof=curse github"`
+	ExternalId  string           `json:"external_id" validate:"required"`
+	Url         string           `json:"url" validate:"required,url"`
+	Requirement AddonRequirement `json:"requirement" validate:"required,oneof=required recommended"`
+}
+
+type ComplianceStatus string
+
+const (
+	ComplianceOk ComplianceStatus = "ok"
+	// The member has not installed the addon
+	ComplianceMissing ComplianceStatus = "missing"
+	// The member installed an addon with the same slug from another project
+	ComplianceWrongSource ComplianceStatus = "wrong-source"
+	// The member reported an older version than the latest one installed in the organization
+	ComplianceOutdated ComplianceStatus = "outdated"
+)
+
+type AddonCompliance struct {
+	GameVersion      GameVersion      `json:"game_version"`
+	Slug             string           `json:"slug"`
+	Status           ComplianceStatus `json:"status"`
+	InstalledVersion string           `json:"installed_version"`
+	LatestVersion    string           `json:"latest_version"`
+}
+
+type MemberCompliance struct {
+	UserId    string            `json:"user_id"`
+	Email     string            `json:"email"`
+	Role      OrganizationRole  `json:"role"`
+	Compliant bool              `json:"compliant"`
+	Addons    []AddonCompliance `json:"addons"`
+}
+
+// OrganizationCompliance is the report of GET /orgs/{id}/compliance, whether each member installed the
+// required addons.
+type OrganizationCompliance struct {
+	OrganizationId string             `json:"organization_id"`
+	Members        []MemberCompliance `json:"members"`
+}
@@ -0,0 +1,42 @@
+package api
+
+// AddonLookup identifies an addon at its provider, by its CurseForge slug or its GitHub "owner/repository".
+type AddonLookup struct {
+	Provider    Provider    `json:"provider" validate:"required,oneof=curse github"`
+	Id          string      `json:"id" validate:"required,max=200"`
+	GameVersion GameVersion `json:"game_version" validate:"required,oneof=retail classic"`
+}
+
+// ResolveAddonsRequest asks for the latest release of a batch of addons.
+type ResolveAddonsRequest struct {
+	Addons []AddonLookup `json:"addons" validate:"required,min=1,max=100,dive"`
+}
+
+// ResolvedAddon is the latest release of an addon at its provider.
+type ResolvedAddon struct {
+	Slug        string      `json:"slug"`
+	Name        string      `json:"name"`
+	Author      string      `json:"author"`
+	GameVersion GameVersion `json:"game_version"`
+	Version     string      `json:"version"`
+	Provider    Provider    `json:"provider"`
+	ExternalId  string      `json:"external_id"`
+	FileId      string      `json:"file_id"`
+	Channel     Channel     `json:"channel"`
+	Url         string      `json:"url"`
+	// Downloadable without any provider key
+	DownloadUrl string `json:"download_url"`
+}
+
+// AddonResolution is the result of a lookup, with either the addon or why it could not be resolved:
+// not_found when the provider does not have it, or provider_unavailable when the provider could not be asked.
+type AddonResolution struct {
+	AddonLookup
+	Addon *ResolvedAddon `json:"addon,omitempty"`
+	Error *ErrorResponse `json:"error,omitempty"`
+}
+
+// ResolveAddonsResponse holds the resolution of every lookup, in the order of the request.
+type ResolveAddonsResponse struct {
+	Addons []AddonResolution `json:"addons"`
+}
@@ -0,0 +1,34 @@
+package api
+
+import "time"
+
+type Scope string
+
+const (
+	ScopeAddonsRead  Scope = "addons:read"
+	ScopeAddonsWrite Scope = "addons:write"
+	// Only session access tokens have this scope, so personal access tokens cannot manage the account.
+	ScopeAccount Scope = "account"
+)
+
+type PersonalAccessToken struct {
+	Id         string     `json:"id"`
+	UserId     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Scope      Scope      `json:"scope"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// CreatePersonalAccessTokenRequest is the body of POST /tokens.
+type CreatePersonalAccessTokenRequest struct {
+	Name  string `json:"name" validate:"required,max=100"`
+	Scope Scope  `json:"scope" validate:"required,oneof=addons:read addons:write"`
+}
+
+type CreatedPersonalAccessToken struct {
+	PersonalAccessToken
+	// The token is only returned once, when it is created
+	Token string `json:"token"`
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"wowa/core"
+	"wowa/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func SetupAccountCmd(rootCmd *cobra.Command, userManager *core.UserManager, deviceManager *core.DeviceManager) {
+	var accountCmd = &cobra.Command{
+		Use:   "account",
+		Short: "Export or delete your wowa account",
+	}
+
+	var exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export everything the server stores about you, as JSON",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			export, err := userManager.ExportAccount()
+			if err != nil {
+				return err
+			}
+
+			output := cmd.Flag("output").Value.String()
+			if output == "" {
+				_, err = os.Stdout.Write(export)
+				return err
+			}
+			if err := os.WriteFile(output, export, 0600); err != nil {
+				return err
+			}
+			fmt.Printf("Exported the account to %s%s%s\n", utils.AnsiBlue, output, utils.AnsiReset)
+			return nil
+		},
+	}
+	exportCmd.Flags().StringP("output", "o", "", "Write the export to this file instead of the standard output")
+
+	var deleteCmd = &cobra.Command{
+		Use:   "delete",
+		Short: "Delete your account with everything saved on the server",
+		Long: "Delete your account with everything saved on the server: addons, collections, devices, tokens and the\n" +
+			"organizations you own. The addons installed on this machine are kept.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email, err := userManager.GetUserEmail()
+			if err != nil {
+				return err
+			}
+			if email == "" {
+				return errors.New("you are not logged in")
+			}
+
+			if cmd.Flag("yes").Value.String() != "true" {
+				confirmed, err := confirm(fmt.Sprintf("Delete the account %s and everything saved on the server? This cannot be undone", email))
+				if err != nil {
+					return err
+				}
+				if !confirmed {
+					fmt.Println("Aborted")
+					return nil
+				}
+			}
+
+			password, err := promptPassword("What is your password?")
+			if err != nil {
+				return err
+			}
+			if err := userManager.DeleteAccount(password); err != nil {
+				return err
+			}
+			if err := deviceManager.Forget(); err != nil {
+				return err
+			}
+
+			fmt.Printf("Deleted the account %s%s%s\n", utils.AnsiBlue, email, utils.AnsiReset)
+			return nil
+		},
+	}
+	deleteCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation")
+
+	accountCmd.AddCommand(exportCmd, deleteCmd)
+	rootCmd.AddCommand(accountCmd)
+}
@@ -29,7 +29,15 @@ func SetupAddCmd(rootCmd *cobra.Command, addonManager *core.AddonManager) {
 
 			var spinner = spinners.NewSpinner(fmt.Sprintf("Installing %s (%s)", url, gameVersion))
 
-			installResult, err := addonManager.Install(url, gameVersion)
+			var installResult core.AddonInstallResult
+			var err error
+			if cmd.Flag("this-device").Value.String() == "true" {
+				installResult, err = addonManager.InstallScoped(url, gameVersion, true)
+			} else if cmd.Flag("all-devices").Value.String() == "true" {
+				installResult, err = addonManager.InstallScoped(url, gameVersion, false)
+			} else {
+				installResult, err = addonManager.Install(url, gameVersion)
+			}
 			if err != nil {
 				spinner.Fail(err.Error())
 				return err
@@ -52,6 +60,9 @@ func SetupAddCmd(rootCmd *cobra.Command, addonManager *core.AddonManager) {
 	addCmd.Flags().BoolP("retail", "r", true, "Install in the retail version of the game")
 	addCmd.Flags().BoolP("classic", "c", false, "Install in the classic version of the game")
 	addCmd.MarkFlagsMutuallyExclusive("classic", "retail")
+	addCmd.Flags().Bool("this-device", false, "Only install the addon on this device, not on your other devices")
+	addCmd.Flags().Bool("all-devices", false, "Install the addon on all your devices, the default for new addons")
+	addCmd.MarkFlagsMutuallyExclusive("this-device", "all-devices")
 
 	rootCmd.AddCommand(addCmd)
 }
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"wowa/core"
+	"wowa/spinny"
+
+	"github.com/spf13/cobra"
+)
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func SetupBackupCmd(rootCmd *cobra.Command, backupManager *core.BackupManager) {
+	var backupCmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Create a snapshot of the WTF folder",
+		Long:  "Create a snapshot of the WTF folder of every game version, or only of the selected one",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			options := core.BackupOptions{
+				SavedVariablesOnly: cmd.Flag("saved-variables").Value.String() == "true",
+				Reason:             core.BackupReasonManual,
+			}
+			if cmd.Flag("before-update").Value.String() == "true" {
+				options = core.BeforeUpdateBackupOptions
+			}
+
+			var gameVersions []core.GameVersion
+			if cmd.Flag("retail").Value.String() == "true" {
+				gameVersions = append(gameVersions, core.Retail)
+			}
+			if cmd.Flag("classic").Value.String() == "true" {
+				gameVersions = append(gameVersions, core.Classic)
+			}
+			if len(gameVersions) == 0 {
+				gameVersions = []core.GameVersion{core.Retail, core.Classic}
+			}
+
+			var spinners = spinny.NewManager()
+			spinners.Start()
+			defer spinners.Stop()
+
+			for _, gameVersion := range gameVersions {
+				var spinner = spinners.NewSpinner(fmt.Sprintf("Backing up %s", gameVersion))
+
+				backup, err := backupManager.Create(gameVersion, options)
+				if err != nil {
+					spinner.Fail(err.Error())
+					return err
+				}
+
+				if backup == nil {
+					spinner.Warn(fmt.Sprintf("%s has no WTF folder", gameVersion))
+				} else {
+					spinner.Succeed(fmt.Sprintf("Created %s (%s)", backup.Name, formatSize(backup.Size)))
+				}
+			}
+
+			return nil
+		},
+	}
+	backupCmd.Flags().BoolP("retail", "r", false, "Back up the retail version of the game")
+	backupCmd.Flags().BoolP("classic", "c", false, "Back up the classic version of the game")
+	backupCmd.Flags().BoolP("saved-variables", "s", false, "Only back up the SavedVariables folders")
+	backupCmd.Flags().Bool("before-update", false, "Create the snapshot taken automatically before an update")
+
+	var lsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "List all backups",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backups, err := backupManager.List()
+			if err != nil {
+				return err
+			}
+
+			if len(backups) == 0 {
+				fmt.Println("No backups found")
+				return nil
+			}
+
+			for _, backup := range backups {
+				fmt.Printf("%s  %s  %s\n", backup.CreatedAt.Format("2006-01-02 15:04:05"), formatSize(backup.Size), backup.Name)
+			}
+
+			return nil
+		},
+	}
+
+	backupCmd.AddCommand(lsCmd)
+	rootCmd.AddCommand(backupCmd)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"wowa/core"
+	"wowa/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func confirm(question string) (bool, error) {
+	fmt.Printf("%s>%s  %s [y/N] ", utils.AnsiYellow, utils.AnsiReset, question)
+	reader := bufio.NewReader(os.Stdin)
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// purgeSavedVariables lists the orphaned SavedVariables files and, once confirmed, moves them into a backup.
+func purgeSavedVariables(savedVariablesManager *core.SavedVariablesManager, gameVersion core.GameVersion, orphans []core.SavedVariablesFile, skipConfirmation bool) error {
+	if len(orphans) == 0 {
+		fmt.Printf("No orphaned SavedVariables found (%s)\n", gameVersion)
+		return nil
+	}
+
+	var totalSize int64
+	for _, orphan := range orphans {
+		totalSize += orphan.Size
+		fmt.Printf(" -> %s (%s, %s)\n", orphan.Path, orphan.Scope, formatSize(orphan.Size))
+	}
+
+	if !skipConfirmation {
+		confirmed, err := confirm(fmt.Sprintf("Move %d SavedVariables files (%s) into a backup?", len(orphans), formatSize(totalSize)))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return nil
+		}
+	}
+
+	backup, err := savedVariablesManager.Purge(gameVersion, orphans)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Moved %d SavedVariables files into %s%s%s\n", len(orphans), utils.AnsiBlue, backup.Name, utils.AnsiReset)
+	return nil
+}
+
+func SetupCleanCmd(rootCmd *cobra.Command, savedVariablesManager *core.SavedVariablesManager) {
+	var cleanCmd = &cobra.Command{
+		Use:   "clean",
+		Short: "Move the SavedVariables of uninstalled addons into a backup",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var gameVersion core.GameVersion
+			if cmd.Flag("retail").Value.String() == "true" {
+				gameVersion = core.Retail
+			} else {
+				gameVersion = core.Classic
+			}
+
+			orphans, err := savedVariablesManager.FindOrphans(gameVersion, nil)
+			if err != nil {
+				return err
+			}
+
+			return purgeSavedVariables(savedVariablesManager, gameVersion, orphans, cmd.Flag("yes").Value.String() == "true")
+		},
+	}
+	cleanCmd.Flags().BoolP("retail", "r", true, "Clean the retail version of the game")
+	cleanCmd.Flags().BoolP("classic", "c", false, "Clean the classic version of the game")
+	cleanCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation")
+	cleanCmd.MarkFlagsMutuallyExclusive("classic", "retail")
+
+	rootCmd.AddCommand(cleanCmd)
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"wowa/core"
+	"wowa/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func SetupDevicesCmd(rootCmd *cobra.Command, deviceManager *core.DeviceManager) {
+	var devicesCmd = &cobra.Command{
+		Use:   "devices",
+		Short: "Manage the devices you use wowa on",
+		Long: "Each device is registered when logging in on it, and reports its installed addons to your account.\n" +
+			"Addons are installed on all your devices, unless added with \"wowa add --this-device\".",
+	}
+
+	var registerCmd = &cobra.Command{
+		Use:   "register [name]",
+		Short: "Register this device, under its hostname by default",
+		Long:  "Register this device, under its hostname by default. Logging in registers it too, so this is only needed with the WOWA_TOKEN environment variable.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+
+			device, err := deviceManager.Register(name)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Registered this device as %s%s%s (%s)\n", utils.AnsiBlue, device.Name, utils.AnsiReset, device.Id)
+			return nil
+		},
+	}
+
+	var lsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "List your devices and the addons installed on each of them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// So this device is listed with its current addons
+			if err := deviceManager.ReportInstalledAddons(); err != nil {
+				return err
+			}
+
+			devices, err := deviceManager.GetAll()
+			if err != nil {
+				return err
+			}
+			currentDeviceId, err := deviceManager.GetCurrentDeviceId()
+			if err != nil {
+				return err
+			}
+
+			if len(devices) == 0 {
+				fmt.Println("No devices found, log in to register this one")
+				return nil
+			}
+
+			for i, device := range devices {
+				if i > 0 {
+					fmt.Println()
+				}
+				current := ""
+				if device.Id == currentDeviceId {
+					current = " (this device)"
+				}
+				fmt.Printf("%s%s%s%s  %s, last seen %s\n", utils.AnsiBlue, device.Name, utils.AnsiReset, current, device.Platform, device.LastSeenAt.Format("2006-01-02 15:04:05"))
+
+				if len(device.Addons) == 0 {
+					fmt.Println("    No addons")
+				}
+				for _, addon := range device.Addons {
+					fmt.Printf("    %s (%s) %s\n", addon.Slug, addon.GameVersion, addon.Version)
+				}
+			}
+			return nil
+		},
+	}
+
+	devicesCmd.AddCommand(registerCmd, lsCmd)
+	rootCmd.AddCommand(devicesCmd)
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"wowa/core"
+	"wowa/spinny"
+	"wowa/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func SetupListCmd(rootCmd *cobra.Command, collectionManager *core.CollectionManager, addonManager *core.AddonManager) {
+	var listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Manage shareable addon lists",
+		Long: "Manage named addon lists saved on your account.\n" +
+			"Share a list with a code so others can install the same addons with \"wowa list apply <code>\".",
+	}
+
+	var createCmd = &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a new addon list",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			collection, err := collectionManager.Create(args[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Created list %s%s%s (%s)\n", utils.AnsiBlue, collection.Name, utils.AnsiReset, collection.Id)
+			return nil
+		},
+	}
+
+	var lsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "Show your addon lists and the ones you subscribed to",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			collections, err := collectionManager.GetAll()
+			if err != nil {
+				return err
+			}
+
+			if len(collections) == 0 {
+				fmt.Println("No lists found")
+				return nil
+			}
+
+			for _, collection := range collections {
+				shared := ""
+				if collection.ShareCode != nil {
+					shared = ", shared with code " + *collection.ShareCode
+				}
+				fmt.Printf("%s  %s%s%s  %d addons%s\n", collection.Id, utils.AnsiBlue, collection.Name, utils.AnsiReset, len(collection.Addons), shared)
+				for _, addon := range collection.Addons {
+					fmt.Printf("    %s (%s)\n", addon.Slug, addon.GameVersion)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	var addCmd = &cobra.Command{
+		Use:   "add <list> <addon id or url>",
+		Short: "Add an installed addon, or any addon by its URL, to a list",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var gameVersion core.GameVersion
+			if cmd.Flag("retail").Value.String() == "true" {
+				gameVersion = core.Retail
+			} else {
+				gameVersion = core.Classic
+			}
+
+			collection, err := collectionManager.Find(args[0])
+			if err != nil {
+				return err
+			}
+
+			collection, err = collectionManager.AddAddon(collection, args[1], gameVersion)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Added %s (%s) to %s%s%s, which now has %d addons\n", args[1], gameVersion, utils.AnsiBlue, collection.Name, utils.AnsiReset, len(collection.Addons))
+			return nil
+		},
+	}
+	addCmd.Flags().BoolP("retail", "r", true, "Add the retail version of the addon")
+	addCmd.Flags().BoolP("classic", "c", false, "Add the classic version of the addon")
+	addCmd.MarkFlagsMutuallyExclusive("classic", "retail")
+
+	var shareCmd = &cobra.Command{
+		Use:   "share <list>",
+		Short: "Get the code and the link to share a list",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			collection, err := collectionManager.Find(args[0])
+			if err != nil {
+				return err
+			}
+
+			// A new code replaces the one that was shared, so its link stops working
+			if cmd.Flag("new").Value.String() == "true" {
+				collection, err = collectionManager.Unshare(collection)
+				if err != nil {
+					return err
+				}
+			}
+
+			collection, link, err := collectionManager.Share(collection)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Share %s%s%s with the code %s%s%s or the link:\n", utils.AnsiBlue, collection.Name, utils.AnsiReset, utils.AnsiGreen, *collection.ShareCode, utils.AnsiReset)
+			fmt.Println(link)
+			return nil
+		},
+	}
+
+	shareCmd.Flags().Bool("new", false, "Replace the share code, so the previous link stops working")
+
+	var unshareCmd = &cobra.Command{
+		Use:   "unshare <list>",
+		Short: "Stop sharing a list",
+		Long: "Stop sharing a list, so its code and link stop working.\n" +
+			"The users who already subscribed keep the list. Share it again to get a new code.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			collection, err := collectionManager.Find(args[0])
+			if err != nil {
+				return err
+			}
+
+			collection, err = collectionManager.Unshare(collection)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s%s%s is no longer shared\n", utils.AnsiBlue, collection.Name, utils.AnsiReset)
+			return nil
+		},
+	}
+
+	var applyCmd = &cobra.Command{
+		Use:   "apply <code or link>",
+		Short: "Install all the addons of a shared list",
+		Long: "Install all the addons of a shared list.\n" +
+			"When signed in, you are also subscribed to the list, so it shows in \"wowa list ls\".",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			collection, err := collectionManager.GetShared(args[0])
+			if err != nil {
+				return err
+			}
+
+			if len(collection.Addons) == 0 {
+				fmt.Printf("The list %s is empty\n", collection.Name)
+				return nil
+			}
+
+			var spinners = spinny.NewManager()
+			spinners.Start()
+			defer spinners.Stop()
+
+			failures := 0
+			for _, addon := range collection.Addons {
+				var spinner = spinners.NewSpinner(fmt.Sprintf("Installing %s (%s)", addon.Slug, addon.GameVersion))
+
+				installResult, err := addonManager.Install(addon.Url, addon.GameVersion)
+				if err != nil {
+					failures++
+					spinner.Fail(fmt.Sprintf("Failed to install %s (%s) - %s", addon.Slug, addon.GameVersion, err.Error()))
+					continue
+				}
+
+				switch installResult.Status {
+				case core.AddonInstallStatusAlreadyInstalled:
+					spinner.Info(fmt.Sprintf("%s (%s) %s is already installed", installResult.Addon.Slug, addon.GameVersion, installResult.Addon.Version))
+				case core.AddonInstallStatusInstalled:
+					spinner.Succeed(fmt.Sprintf("%s (%s) %s installed successfully", installResult.Addon.Slug, addon.GameVersion, installResult.Addon.Version))
+				case core.AddonInstallStatusReinstalled:
+					spinner.Warn(fmt.Sprintf("%s (%s) %s reinstalled", installResult.Addon.Slug, addon.GameVersion, installResult.Addon.Version))
+				case core.AddonInstallStatusUpdated:
+					spinner.Info(fmt.Sprintf("%s (%s) updated to %s", installResult.Addon.Slug, addon.GameVersion, installResult.Addon.Version))
+				}
+			}
+
+			if failures > 0 {
+				return fmt.Errorf("%d addons of %s failed to install", failures, collection.Name)
+			}
+			return nil
+		},
+	}
+
+	listCmd.AddCommand(createCmd, lsCmd, addCmd, shareCmd, unshareCmd, applyCmd)
+	rootCmd.AddCommand(listCmd)
+}
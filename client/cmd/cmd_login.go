@@ -20,9 +20,35 @@ func isValidEmail(email string) bool {
 	return re.MatchString(email)
 }
 
+func promptEmail() (string, error) {
+	fmt.Println(utils.AnsiYellow + ">" + utils.AnsiReset + "  What is your email?")
+	reader := bufio.NewReader(os.Stdin)
+	rawEmail, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	email := strings.TrimSpace(rawEmail)
+	if !isValidEmail(email) {
+		return "", errors.New("invalid email: " + email)
+	}
+	return email, nil
+}
+
+func promptPassword(question string) (string, error) {
+	fmt.Println(utils.AnsiYellow + ">" + utils.AnsiReset + "  " + question)
+	password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		return "", err
+	}
+	if len(password) == 0 {
+		return "", errors.New("the password is too short")
+	}
+	return string(password), nil
+}
+
 // TODO: Improve the logs/out
 
-func SetupLoginCmd(rootCmd *cobra.Command, userManager *core.UserManager) {
+func SetupLoginCmd(rootCmd *cobra.Command, userManager *core.UserManager, deviceManager *core.DeviceManager) {
 	var loginCmd = &cobra.Command{
 		Use:   "login",
 		Short: "Login to your wowa account",
@@ -36,32 +62,29 @@ func SetupLoginCmd(rootCmd *cobra.Command, userManager *core.UserManager) {
 				return nil
 			}
 
-			fmt.Println(utils.AnsiYellow + ">" + utils.AnsiReset + "  What is your email?")
-			reader := bufio.NewReader(os.Stdin)
-			rawEmail, err := reader.ReadString('\n')
+			email, err := promptEmail()
 			if err != nil {
 				return err
 			}
-			email := strings.TrimSpace(rawEmail)
-			if !isValidEmail(email) {
-				return errors.New("invalid email: " + email)
-			}
 
-			fmt.Println(utils.AnsiYellow + ">" + utils.AnsiReset + "  What is your password?")
-			password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+			password, err := promptPassword("What is your password?")
 			if err != nil {
 				return err
 			}
-			if len(password) == 0 {
-				return errors.New("the password is too short")
-			}
 
-			err = userManager.SignIn(email, string(password))
+			err = userManager.SignIn(email, password)
 			if err != nil {
 				return err
 			}
 
 			fmt.Printf("Successfully signed in as %s%s%s!\n", utils.AnsiBlue, email, utils.AnsiReset)
+
+			device, err := deviceManager.Register("")
+			if err != nil {
+				fmt.Printf("%sFailed to register this device - %s%s\n", utils.AnsiYellow, err.Error(), utils.AnsiReset)
+				return nil
+			}
+			fmt.Printf("Registered this device as %s%s%s\n", utils.AnsiBlue, device.Name, utils.AnsiReset)
 			return nil
 		},
 	}
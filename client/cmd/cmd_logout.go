@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"wowa/core"
+	"wowa/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func SetupLogoutCmd(rootCmd *cobra.Command, userManager *core.UserManager, deviceManager *core.DeviceManager) {
+	var logoutCmd = &cobra.Command{
+		Use:   "logout",
+		Short: "Logout from your wowa account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email, err := userManager.GetUserEmail()
+			if err != nil {
+				return err
+			}
+			if email == "" {
+				fmt.Println("You are not logged in")
+				return nil
+			}
+
+			// The device stays registered on the server, for when logging in again
+			if err := deviceManager.Forget(); err != nil {
+				return err
+			}
+
+			err = userManager.SignOut()
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Successfully signed out from %s%s%s\n", utils.AnsiBlue, email, utils.AnsiReset)
+			return nil
+		},
+	}
+	rootCmd.AddCommand(logoutCmd)
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"fmt"
+	"wowa/core"
+	"wowa/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func getGameVersionFlag(cmd *cobra.Command) core.GameVersion {
+	if cmd.Flag("retail").Value.String() == "true" {
+		return core.Retail
+	}
+	return core.Classic
+}
+
+func addGameVersionFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("retail", "r", true, "Use the retail version of the addon")
+	cmd.Flags().BoolP("classic", "c", false, "Use the classic version of the addon")
+	cmd.MarkFlagsMutuallyExclusive("classic", "retail")
+}
+
+func newOrgAddonCmd(organizationManager *core.OrganizationManager, name string, requirement core.AddonRequirement) *cobra.Command {
+	var addonCmd = &cobra.Command{
+		Use:   name + " <organization> <addon id or url>",
+		Short: fmt.Sprintf("Make an installed addon, or any addon by its URL, %s for the members", requirement),
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			organization, err := organizationManager.Find(args[0])
+			if err != nil {
+				return err
+			}
+
+			addon, err := organizationManager.SetAddon(organization, args[1], getGameVersionFlag(cmd), requirement)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s (%s) is now %s in %s%s%s\n", addon.Slug, addon.GameVersion, requirement, utils.AnsiBlue, organization.Name, utils.AnsiReset)
+			return nil
+		},
+	}
+	addGameVersionFlags(addonCmd)
+	return addonCmd
+}
+
+func SetupOrgCmd(rootCmd *cobra.Command, organizationManager *core.OrganizationManager) {
+	var orgCmd = &cobra.Command{
+		Use:   "org",
+		Short: "Manage the organizations of your guild or team",
+		Long: "Manage organizations, whose officers maintain the required and recommended addons of the members.\n" +
+			"\"wowa update\" installs the required addons, and reports the members out of compliance to the officers.",
+	}
+
+	var createCmd = &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a new organization, of which you are the owner",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			organization, err := organizationManager.Create(args[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Created organization %s%s%s (%s)\n", utils.AnsiBlue, organization.Name, utils.AnsiReset, organization.Id)
+			return nil
+		},
+	}
+
+	var lsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "List your organizations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			organizations, err := organizationManager.GetAll()
+			if err != nil {
+				return err
+			}
+
+			if len(organizations) == 0 {
+				fmt.Println("No organizations found")
+				return nil
+			}
+
+			for _, organization := range organizations {
+				fmt.Printf("%s  %s%s%s  %s, %d addons\n", organization.Id, utils.AnsiBlue, organization.Name, utils.AnsiReset, organization.Role, len(organization.Addons))
+			}
+			return nil
+		},
+	}
+
+	var showCmd = &cobra.Command{
+		Use:   "show <organization>",
+		Short: "Show the members and the addons of an organization",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			organization, err := organizationManager.Find(args[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s%s%s (%s), you are %s\n\nMembers:\n", utils.AnsiBlue, organization.Name, utils.AnsiReset, organization.Id, organization.Role)
+			for _, member := range organization.Members {
+				fmt.Printf("    %s  %s\n", member.Email, member.Role)
+			}
+
+			// Only the officers see the pending invitations
+			if organization.Role != core.OrganizationRoleMember {
+				invitations, err := organizationManager.GetInvitations(organization)
+				if err != nil {
+					return err
+				}
+				if len(invitations) > 0 {
+					fmt.Println("\nInvited:")
+				}
+				for _, invitation := range invitations {
+					fmt.Printf("    %s  %s\n", invitation.Email, invitation.Role)
+				}
+			}
+
+			fmt.Println("\nAddons:")
+			if len(organization.Addons) == 0 {
+				fmt.Println("    None")
+			}
+			for _, addon := range organization.Addons {
+				fmt.Printf("    %s (%s)  %s\n", addon.Slug, addon.GameVersion, addon.Requirement)
+			}
+			return nil
+		},
+	}
+
+	var memberCmd = &cobra.Command{
+		Use:   "member",
+		Short: "Manage the members of an organization",
+	}
+
+	var memberAddCmd = &cobra.Command{
+		Use:   "add <organization> <email>",
+		Short: "Invite a member to an organization, or change its role",
+		Long: "Invite an email to join an organization, or change the role of a member.\n" +
+			"The invited user only becomes a member once they accept with \"wowa org join\" and the code mailed to them.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			organization, err := organizationManager.Find(args[0])
+			if err != nil {
+				return err
+			}
+
+			role := core.OrganizationRoleMember
+			if cmd.Flag("officer").Value.String() == "true" {
+				role = core.OrganizationRoleOfficer
+			}
+
+			if organizationManager.IsMember(organization, args[1]) {
+				member, err := organizationManager.SaveMember(organization, args[1], role)
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("%s is now %s of %s%s%s\n", member.Email, member.Role, utils.AnsiBlue, organization.Name, utils.AnsiReset)
+				return nil
+			}
+
+			invitation, err := organizationManager.Invite(organization, args[1], role)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Invited %s to join %s%s%s as %s, they become a member once they accept with the mailed code\n", invitation.Email, utils.AnsiBlue, organization.Name, utils.AnsiReset, invitation.Role)
+			return nil
+		},
+	}
+	memberAddCmd.Flags().Bool("officer", false, "Make the member an officer, only the owner can")
+
+	var memberRemoveCmd = &cobra.Command{
+		Use:   "remove <organization> <email>",
+		Short: "Remove a member from an organization or cancel their invitation, or leave it with your own email",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			organization, err := organizationManager.Find(args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := organizationManager.RemoveMember(organization, args[1]); err != nil {
+				return err
+			}
+
+			fmt.Printf("Removed %s from %s%s%s\n", args[1], utils.AnsiBlue, organization.Name, utils.AnsiReset)
+			return nil
+		},
+	}
+	memberCmd.AddCommand(memberAddCmd, memberRemoveCmd)
+
+	var invitationsCmd = &cobra.Command{
+		Use:   "invitations",
+		Short: "List your invitations to join organizations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			invitations, err := organizationManager.GetMyInvitations()
+			if err != nil {
+				return err
+			}
+
+			if len(invitations) == 0 {
+				fmt.Println("No invitations found")
+				return nil
+			}
+
+			for _, invitation := range invitations {
+				fmt.Printf("%s  %s%s%s  as %s\n", invitation.Id, utils.AnsiBlue, invitation.OrganizationName, utils.AnsiReset, invitation.Role)
+			}
+			return nil
+		},
+	}
+
+	var joinCmd = &cobra.Command{
+		Use:   "join <organization or invitation id> <code>",
+		Short: "Accept an invitation to join an organization, with the code mailed with it",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			invitation, err := organizationManager.FindInvitation(args[0])
+			if err != nil {
+				return err
+			}
+
+			organization, err := organizationManager.AcceptInvitation(invitation, args[1])
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Joined %s%s%s as %s\n", utils.AnsiBlue, organization.Name, utils.AnsiReset, organization.Role)
+			return nil
+		},
+	}
+
+	var declineCmd = &cobra.Command{
+		Use:   "decline <organization or invitation id>",
+		Short: "Decline an invitation to join an organization",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			invitation, err := organizationManager.FindInvitation(args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := organizationManager.DeclineInvitation(invitation); err != nil {
+				return err
+			}
+
+			fmt.Printf("Declined the invitation to %s%s%s\n", utils.AnsiBlue, invitation.OrganizationName, utils.AnsiReset)
+			return nil
+		},
+	}
+
+	var dropCmd = &cobra.Command{
+		Use:   "drop <organization> <addon id>",
+		Short: "Remove an addon from the addons of an organization",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			organization, err := organizationManager.Find(args[0])
+			if err != nil {
+				return err
+			}
+
+			gameVersion := getGameVersionFlag(cmd)
+			if err := organizationManager.RemoveAddon(organization, args[1], gameVersion); err != nil {
+				return err
+			}
+
+			fmt.Printf("Removed %s (%s) from %s%s%s\n", args[1], gameVersion, utils.AnsiBlue, organization.Name, utils.AnsiReset)
+			return nil
+		},
+	}
+	addGameVersionFlags(dropCmd)
+
+	var complianceCmd = &cobra.Command{
+		Use:   "compliance <organization>",
+		Short: "Show which members installed the required addons, only for officers",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			organization, err := organizationManager.Find(args[0])
+			if err != nil {
+				return err
+			}
+
+			compliance, err := organizationManager.GetCompliance(organization)
+			if err != nil {
+				return err
+			}
+
+			for _, member := range compliance.Members {
+				if member.Compliant {
+					fmt.Printf("%s✔%s %s\n", utils.AnsiGreen, utils.AnsiReset, member.Email)
+				} else {
+					fmt.Printf("%s✗%s %s - %s\n", utils.AnsiRed, utils.AnsiReset, member.Email, formatComplianceIssues(member))
+				}
+			}
+			return nil
+		},
+	}
+
+	orgCmd.AddCommand(
+		createCmd, lsCmd, showCmd, memberCmd, invitationsCmd, joinCmd, declineCmd,
+		newOrgAddonCmd(organizationManager, "require", core.AddonRequirementRequired),
+		newOrgAddonCmd(organizationManager, "recommend", core.AddonRequirementRecommended),
+		dropCmd, complianceCmd,
+	)
+	rootCmd.AddCommand(orgCmd)
+}
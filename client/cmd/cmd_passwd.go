@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"wowa/core"
+	"wowa/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func promptNewPassword() (string, error) {
+	password, err := promptPassword("Choose a new password")
+	if err != nil {
+		return "", err
+	}
+	passwordConfirmation, err := promptPassword("Confirm your new password")
+	if err != nil {
+		return "", err
+	}
+	if password != passwordConfirmation {
+		return "", errors.New("the passwords do not match")
+	}
+	return password, nil
+}
+
+func resetPassword(userManager *core.UserManager) error {
+	email, err := promptEmail()
+	if err != nil {
+		return err
+	}
+
+	err = userManager.RequestPasswordReset(email)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(utils.AnsiYellow + ">" + utils.AnsiReset + "  If the account exists, a reset code was sent to " + email + ". What is the code?")
+	reader := bufio.NewReader(os.Stdin)
+	rawResetCode, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	resetCode := strings.TrimSpace(rawResetCode)
+	if resetCode == "" {
+		return errors.New("the reset code is empty")
+	}
+
+	password, err := promptNewPassword()
+	if err != nil {
+		return err
+	}
+
+	err = userManager.ResetPassword(resetCode, password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Password reset successfully! Sign in again with wowa login")
+	return nil
+}
+
+func SetupPasswdCmd(rootCmd *cobra.Command, userManager *core.UserManager) {
+	var passwdCmd = &cobra.Command{
+		Use:   "passwd",
+		Short: "Change the password of your wowa account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.Flag("forgot").Value.String() == "true" {
+				return resetPassword(userManager)
+			}
+
+			email, err := userManager.GetUserEmail()
+			if err != nil {
+				return err
+			}
+			if email == "" {
+				return errors.New("you are not logged in (use --forgot to reset a forgotten password)")
+			}
+
+			currentPassword, err := promptPassword("What is your current password?")
+			if err != nil {
+				return err
+			}
+			password, err := promptNewPassword()
+			if err != nil {
+				return err
+			}
+
+			err = userManager.ChangePassword(currentPassword, password)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Successfully changed the password of %s%s%s! Other devices need to sign in again\n", utils.AnsiBlue, email, utils.AnsiReset)
+			return nil
+		},
+	}
+	passwdCmd.Flags().Bool("forgot", false, "Reset a forgotten password with a code sent by email")
+
+	rootCmd.AddCommand(passwdCmd)
+}
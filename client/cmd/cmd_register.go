@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"wowa/core"
+	"wowa/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func SetupRegisterCmd(rootCmd *cobra.Command, userManager *core.UserManager) {
+	var registerCmd = &cobra.Command{
+		Use:   "register",
+		Short: "Create a new wowa account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			currentEmail, err := userManager.GetUserEmail()
+			if err != nil {
+				return err
+			}
+			if currentEmail != "" {
+				fmt.Printf("You are already logged in as %s%s%s\n", utils.AnsiBlue, currentEmail, utils.AnsiReset)
+				return nil
+			}
+
+			email, err := promptEmail()
+			if err != nil {
+				return err
+			}
+
+			password, err := promptPassword("Choose a password")
+			if err != nil {
+				return err
+			}
+			passwordConfirmation, err := promptPassword("Confirm your password")
+			if err != nil {
+				return err
+			}
+			if password != passwordConfirmation {
+				return errors.New("the passwords do not match")
+			}
+
+			err = userManager.Register(email, password)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Successfully registered and signed in as %s%s%s!\n", utils.AnsiBlue, email, utils.AnsiReset)
+			return nil
+		},
+	}
+	rootCmd.AddCommand(registerCmd)
+}
@@ -4,11 +4,12 @@ import (
 	"fmt"
 	"wowa/core"
 	"wowa/spinny"
+	"wowa/utils"
 
 	"github.com/spf13/cobra"
 )
 
-func SetupRemoveCmd(rootCmd *cobra.Command, addonManager *core.AddonManager) {
+func SetupRemoveCmd(rootCmd *cobra.Command, addonManager *core.AddonManager, localAddonRepository *core.LocalAddonRepository, savedVariablesManager *core.SavedVariablesManager) {
 	var removeCmd = &cobra.Command{
 		Use:     "rm <id>",
 		Aliases: []string{"remove"},
@@ -24,6 +25,11 @@ func SetupRemoveCmd(rootCmd *cobra.Command, addonManager *core.AddonManager) {
 				gameVersion = core.Classic
 			}
 
+			localAddon, err := localAddonRepository.Get(id, gameVersion)
+			if err != nil {
+				return err
+			}
+
 			var spinners = spinny.NewManager()
 			spinners.Start()
 			defer spinners.Stop()
@@ -42,11 +48,32 @@ func SetupRemoveCmd(rootCmd *cobra.Command, addonManager *core.AddonManager) {
 				spinner.Warn(fmt.Sprintf("%s (%s) not found", id, gameVersion))
 			}
 
-			return nil
+			if !removed || cmd.Flag("purge").Value.String() != "true" {
+				return nil
+			}
+
+			// Stop the spinners before asking for confirmation
+			spinners.Stop()
+
+			// FindOrphans looks at every addon when given no directories, so the addons installed before
+			// their directories were recorded cannot be purged
+			if len(localAddon.Directories) == 0 {
+				fmt.Printf("%sThe directories of %s (%s) are unknown, its SavedVariables were not purged%s\n", utils.AnsiYellow, id, gameVersion, utils.AnsiReset)
+				return nil
+			}
+
+			orphans, err := savedVariablesManager.FindOrphans(gameVersion, localAddon.Directories)
+			if err != nil {
+				return err
+			}
+
+			return purgeSavedVariables(savedVariablesManager, gameVersion, orphans, cmd.Flag("yes").Value.String() == "true")
 		},
 	}
 	removeCmd.Flags().BoolP("retail", "r", true, "Remove from the retail version of the game")
 	removeCmd.Flags().BoolP("classic", "c", false, "Remove from the classic version of the game")
+	removeCmd.Flags().Bool("purge", false, "Also move the SavedVariables of the addon into a backup")
+	removeCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation when purging")
 	removeCmd.MarkFlagsMutuallyExclusive("classic", "retail")
 
 	rootCmd.AddCommand(removeCmd)
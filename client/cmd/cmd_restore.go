@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"wowa/core"
+	"wowa/spinny"
+
+	"github.com/spf13/cobra"
+)
+
+func SetupRestoreCmd(rootCmd *cobra.Command, backupManager *core.BackupManager) {
+	var restoreCmd = &cobra.Command{
+		Use:   "restore <backup>",
+		Short: "Restore a snapshot of the WTF folder",
+		Long:  "Restore a snapshot of the WTF folder. The current WTF folder is backed up before it is overwritten.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			var spinners = spinny.NewManager()
+			spinners.Start()
+			defer spinners.Stop()
+
+			var spinner = spinners.NewSpinner(fmt.Sprintf("Restoring %s", name))
+
+			backup, err := backupManager.Restore(name)
+			if err != nil {
+				spinner.Fail(err.Error())
+				return err
+			}
+
+			spinner.Succeed(fmt.Sprintf("Restored %s (%s)", backup.Name, backup.GameVersion))
+			return nil
+		},
+	}
+
+	rootCmd.AddCommand(restoreCmd)
+}
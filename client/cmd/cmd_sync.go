@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"wowa/core"
+	"wowa/spinny"
+	"wowa/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func formatSyncAction(action core.SyncAction) string {
+	switch action.Type {
+	case core.SyncActionInstall:
+		return fmt.Sprintf("%s+ install%s        %s (%s), added elsewhere", utils.AnsiGreen, utils.AnsiReset, action.Slug, action.GameVersion)
+	case core.SyncActionRemove:
+		return fmt.Sprintf("%s- remove%s         %s (%s), removed elsewhere", utils.AnsiRed, utils.AnsiReset, action.Slug, action.GameVersion)
+	case core.SyncActionPush:
+		return fmt.Sprintf("%s^ push%s           %s (%s), only installed here", utils.AnsiBlue, utils.AnsiReset, action.Slug, action.GameVersion)
+	case core.SyncActionDeleteRemote:
+		return fmt.Sprintf("%sx delete remote%s  %s (%s), removed here", utils.AnsiRed, utils.AnsiReset, action.Slug, action.GameVersion)
+	default:
+		return fmt.Sprintf("%s! conflict%s       %s (%s), %s", utils.AnsiYellow, utils.AnsiReset, action.Slug, action.GameVersion, action.Reason)
+	}
+}
+
+func SetupSyncCmd(rootCmd *cobra.Command, syncManager *core.SyncManager) {
+	var syncCmd = &cobra.Command{
+		Use:   "sync",
+		Short: "Synchronize the installed addons with your other machines",
+		Long: `Compare the addons installed here with the ones saved on your account, and with the last sync.
+Addons added elsewhere are installed, addons removed elsewhere are uninstalled, and addons only
+installed here are saved to your account. Addons changed on both sides are reported as conflicts
+and left alone.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			actions, err := syncManager.Plan()
+			if err != nil {
+				return err
+			}
+
+			if len(actions) == 0 {
+				fmt.Println("Everything is in sync!")
+				return nil
+			}
+
+			conflicts := 0
+			for _, action := range actions {
+				fmt.Printf(" -> %s\n", formatSyncAction(action))
+				if action.Type == core.SyncActionConflict {
+					conflicts++
+				}
+			}
+
+			if cmd.Flag("dry-run").Value.String() == "true" || conflicts == len(actions) {
+				return nil
+			}
+
+			if cmd.Flag("yes").Value.String() != "true" {
+				confirmed, err := confirm(fmt.Sprintf("Apply %d changes?", len(actions)-conflicts))
+				if err != nil {
+					return err
+				}
+				if !confirmed {
+					return nil
+				}
+			}
+
+			var spinners = spinny.NewManager()
+			spinners.Start()
+			defer spinners.Stop()
+
+			failures := 0
+			var spinner *spinny.Spinner
+			onStart := func(action core.SyncAction) {
+				spinner = spinners.NewSpinner(fmt.Sprintf("Syncing %s (%s)", action.Slug, action.GameVersion))
+			}
+			_, err = syncManager.Apply(actions, onStart, func(result core.SyncActionResult) {
+				if result.Err != nil {
+					failures++
+					spinner.Fail(fmt.Sprintf("Failed to sync %s (%s) - %s", result.Action.Slug, result.Action.GameVersion, result.Err.Error()))
+				} else {
+					spinner.Succeed(formatSyncAction(result.Action))
+				}
+			})
+			if err != nil {
+				return fmt.Errorf("failed to save the sync snapshot: %w", err)
+			}
+			if failures > 0 {
+				return fmt.Errorf("%d changes failed, run sync again to retry them", failures)
+			}
+
+			return nil
+		},
+	}
+
+	syncCmd.Flags().Bool("dry-run", false, "Only show what would be done")
+	syncCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation")
+
+	rootCmd.AddCommand(syncCmd)
+}
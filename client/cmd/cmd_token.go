@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"wowa/core"
+	"wowa/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func SetupTokenCmd(rootCmd *cobra.Command, tokenRepository *core.TokenRepository) {
+	var tokenCmd = &cobra.Command{
+		Use:   "token",
+		Short: "Manage personal access tokens for headless machines and scripts",
+		Long: "Manage personal access tokens for headless machines and scripts.\n" +
+			"Set a token in the WOWA_TOKEN environment variable to use it instead of logging in.",
+	}
+
+	var createCmd = &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a new personal access token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scope := core.TokenScopeAddonsWrite
+			if cmd.Flag("read-only").Value.String() == "true" {
+				scope = core.TokenScopeAddonsRead
+			}
+
+			token, err := tokenRepository.Create(args[0], scope)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Created token %s%s%s (%s) with the %s scope\n", utils.AnsiBlue, token.Name, utils.AnsiReset, token.Id, token.Scope)
+			fmt.Printf("%sCopy it now, it will not be shown again:%s\n", utils.AnsiYellow, utils.AnsiReset)
+			fmt.Println(token.Token)
+			return nil
+		},
+	}
+	createCmd.Flags().Bool("read-only", false, "Only allow the token to read the addon list")
+
+	var lsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "List all personal access tokens",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tokens, err := tokenRepository.GetAll()
+			if err != nil {
+				return err
+			}
+
+			if len(tokens) == 0 {
+				fmt.Println("No personal access tokens found")
+				return nil
+			}
+
+			for _, token := range tokens {
+				lastUsedAt := "never used"
+				if token.LastUsedAt != nil {
+					lastUsedAt = "last used at " + token.LastUsedAt.Local().Format("2006-01-02 15:04:05")
+				}
+				fmt.Printf("%s  %s%s%s  %s  created at %s, %s\n", token.Id, utils.AnsiBlue, token.Name, utils.AnsiReset, token.Scope, token.CreatedAt.Local().Format("2006-01-02 15:04:05"), lastUsedAt)
+			}
+
+			return nil
+		},
+	}
+
+	var revokeCmd = &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Revoke a personal access token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			revoked, err := tokenRepository.Revoke(args[0])
+			if err != nil {
+				return err
+			}
+
+			if revoked {
+				fmt.Printf("Revoked token %s\n", args[0])
+			} else {
+				fmt.Printf("%sToken %s not found%s\n", utils.AnsiYellow, args[0], utils.AnsiReset)
+			}
+			return nil
+		},
+	}
+
+	tokenCmd.AddCommand(createCmd, lsCmd, revokeCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
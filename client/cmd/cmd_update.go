@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"wowa/core"
 	"wowa/utils"
@@ -11,13 +12,35 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func SetupUpdateCmd(rootCmd *cobra.Command, addonManager *core.AddonManager, remoteAddonRepository *core.RemoteAddonRepository, weakAuraManager *core.WeakAuraManager) {
+func formatComplianceIssues(member core.MemberCompliance) string {
+	var issues []string
+	for _, addon := range member.Addons {
+		switch addon.Status {
+		case core.AddonComplianceMissing:
+			issues = append(issues, fmt.Sprintf("%s (%s) missing", addon.Slug, addon.GameVersion))
+		case core.AddonComplianceWrongSource:
+			issues = append(issues, fmt.Sprintf("%s (%s) installed from another project", addon.Slug, addon.GameVersion))
+		case core.AddonComplianceOutdated:
+			issues = append(issues, fmt.Sprintf("%s (%s) %s instead of %s", addon.Slug, addon.GameVersion, addon.InstalledVersion, addon.LatestVersion))
+		}
+	}
+	return strings.Join(issues, ", ")
+}
+
+func SetupUpdateCmd(rootCmd *cobra.Command, addonManager *core.AddonManager, remoteAddonRepository *core.RemoteAddonRepository, organizationManager *core.OrganizationManager, weakAuraManager *core.WeakAuraManager, backupManager *core.BackupManager) {
 	var addCmd = &cobra.Command{
 		Use:     "update",
 		Short:   "Update all installed addons",
 		Aliases: []string{"up"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// TODO: This should also remove uninstalled addons
+			// Addons removed on other machines are only uninstalled by `wowa sync`
+
+			if cmd.Flag("no-backup").Value.String() != "true" {
+				_, err := backupManager.CreateAll(core.BeforeUpdateBackupOptions)
+				if err != nil {
+					return fmt.Errorf("failed to back up the SavedVariables: %w", err)
+				}
+			}
 
 			var messages []string
 			var wg sync.WaitGroup
@@ -48,6 +71,31 @@ func SetupUpdateCmd(rootCmd *cobra.Command, addonManager *core.AddonManager, rem
 				return err
 			}
 
+			// Also install the addons required by the organizations, which are optional so a failure only warns
+			organizations, err := organizationManager.GetAll()
+			if err != nil {
+				messages = append(messages, fmt.Sprintf("%sFailed to retrieve organizations - %s %s", utils.AnsiYellow, err.Error(), utils.AnsiReset))
+			}
+			isSaved := make(map[string]bool)
+			for _, addon := range addons {
+				isSaved[string(addon.GameVersion)+"/"+addon.Slug] = true
+			}
+			for _, requiredAddon := range organizationManager.GetRequiredAddons(organizations) {
+				if !isSaved[string(requiredAddon.GameVersion)+"/"+requiredAddon.Slug] {
+					organizationId := requiredAddon.OrganizationId
+					addons = append(addons, core.RemoteAddon{
+						Slug: requiredAddon.Slug, GameVersion: requiredAddon.GameVersion, Url: requiredAddon.Url, OrganizationId: &organizationId,
+					})
+				}
+			}
+
+			// Resolve the latest releases at once, rather than with a request per addon
+			queries := make([]core.AddonSearchQuery, 0, len(addons))
+			for _, addon := range addons {
+				queries = append(queries, core.AddonSearchQuery{IdOrUrl: addon.Url, GameVersion: addon.GameVersion})
+			}
+			addonManager.PrefetchLatest(queries)
+
 			// Update addons
 			progressBar.ChangeMax(len(addons))
 			wg.Add(len(addons))
@@ -57,7 +105,15 @@ func SetupUpdateCmd(rootCmd *cobra.Command, addonManager *core.AddonManager, rem
 					defer wg.Done()
 					defer progressBar.Add(1)
 
-					installResult, err := addonManager.Install(addon.Url, addon.GameVersion)
+					// The addons keep their saved device scope, and the required ones stay marked as such so they
+					// are not mistaken for addons added by the user
+					var installResult core.AddonInstallResult
+					var err error
+					if addon.OrganizationId != nil {
+						installResult, err = addonManager.InstallForOrganization(addon.Url, addon.GameVersion, *addon.OrganizationId, addon.DeviceId != nil)
+					} else {
+						installResult, err = addonManager.InstallScoped(addon.Url, addon.GameVersion, addon.DeviceId != nil)
+					}
 					if err != nil {
 						messages = append(messages, fmt.Sprintf("%sFailed to update addon %s (%s) - %s %s", utils.AnsiRed, addon.Slug, addon.GameVersion, err.Error(), utils.AnsiReset))
 						return
@@ -85,19 +141,39 @@ func SetupUpdateCmd(rootCmd *cobra.Command, addonManager *core.AddonManager, rem
 				defer wg.Done()
 				defer progressBar.Add(1)
 
-				waUpdates, err := weakAuraManager.UpdateAll(core.Retail)
+				waResult, err := weakAuraManager.UpdateAll(core.Retail)
 				if err != nil {
 					messages = append(messages, fmt.Sprintf("%sFailed to update weak auras %s %s", utils.AnsiRed, err.Error(), utils.AnsiReset))
 					return
 				}
 
-				for _, waUpdate := range waUpdates {
+				for _, waUpdate := range waResult.Updates {
 					messages = append(messages, fmt.Sprintf("Weak Aura %s updated to %s", waUpdate.Name, waUpdate.WagoSemver))
 				}
+				for _, unreachable := range waResult.Unreachable {
+					messages = append(messages, fmt.Sprintf("%sWeak Aura %s (%s) is unreachable - %s%s", utils.AnsiYellow, unreachable.Name, unreachable.Slug, unreachable.Reason, utils.AnsiReset))
+				}
 			}()
 
 			wg.Wait()
 
+			// Report the members missing required addons to the officers
+			for _, organization := range organizations {
+				if organization.Role != core.OrganizationRoleOwner && organization.Role != core.OrganizationRoleOfficer {
+					continue
+				}
+				compliance, err := organizationManager.GetCompliance(&organization)
+				if err != nil {
+					messages = append(messages, fmt.Sprintf("%sFailed to check the compliance of %s - %s %s", utils.AnsiRed, organization.Name, err.Error(), utils.AnsiReset))
+					continue
+				}
+				for _, member := range compliance.Members {
+					if !member.Compliant {
+						messages = append(messages, fmt.Sprintf("%s%s: %s is out of compliance - %s%s", utils.AnsiYellow, organization.Name, member.Email, formatComplianceIssues(member), utils.AnsiReset))
+					}
+				}
+			}
+
 			if len(messages) == 0 {
 				messages = append(messages, "All addons and weak auras are up to date!")
 			}
@@ -106,5 +182,7 @@ func SetupUpdateCmd(rootCmd *cobra.Command, addonManager *core.AddonManager, rem
 		},
 	}
 
+	addCmd.Flags().Bool("no-backup", false, "Skip the SavedVariables backup taken before updating")
+
 	rootCmd.AddCommand(addCmd)
 }
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"wowa/core"
+	"wowa/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func SetupWeakAuraCmd(rootCmd *cobra.Command, weakAuraManager *core.WeakAuraManager) {
+	var waCmd = &cobra.Command{
+		Use:     "wa",
+		Aliases: []string{"weakauras"},
+		Short:   "Manage weak auras",
+	}
+
+	var statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show the weak aura imports pending in game and the ones already applied",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var gameVersion core.GameVersion
+			if cmd.Flag("retail").Value.String() == "true" {
+				gameVersion = core.Retail
+			} else {
+				gameVersion = core.Classic
+			}
+
+			companionImports, err := weakAuraManager.Status(gameVersion)
+			if err != nil {
+				return err
+			}
+
+			if len(companionImports) == 0 {
+				fmt.Println("No weak aura imports were offered yet")
+				return nil
+			}
+
+			for _, companionImport := range companionImports {
+				if companionImport.AppliedAt == nil {
+					fmt.Printf(
+						"%spending%s  %s (%s) %s - generated at %s\n",
+						utils.AnsiYellow, utils.AnsiReset,
+						companionImport.Name, companionImport.Slug, companionImport.WagoSemver,
+						companionImport.GeneratedAt.Format("2006-01-02 15:04:05"),
+					)
+				} else {
+					fmt.Printf(
+						"%sapplied%s  %s (%s) %s - applied at %s\n",
+						utils.AnsiGreen, utils.AnsiReset,
+						companionImport.Name, companionImport.Slug, companionImport.WagoSemver,
+						companionImport.AppliedAt.Format("2006-01-02 15:04:05"),
+					)
+				}
+			}
+
+			return nil
+		},
+	}
+	statusCmd.Flags().BoolP("retail", "r", true, "Show the retail version of the game")
+	statusCmd.Flags().BoolP("classic", "c", false, "Show the classic version of the game")
+	statusCmd.MarkFlagsMutuallyExclusive("classic", "retail")
+
+	waCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(waCmd)
+}
@@ -13,6 +13,11 @@ func SetupWhoamiCmd(rootCmd *cobra.Command, userManager *core.UserManager) {
 		Use:   "whoami",
 		Short: "Display the user email currently logged in",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if userManager.IsUsingEnvToken() {
+				fmt.Println(utils.AnsiBlue, "personal access token (WOWA_TOKEN)", utils.AnsiReset)
+				return nil
+			}
+
 			email, err := userManager.GetUserEmail()
 			if err != nil {
 				return err
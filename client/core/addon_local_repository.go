@@ -3,20 +3,26 @@ package core
 import (
 	"encoding/json"
 	"time"
+	"wowa-api"
 )
 
-type GameVersion string
+// The enums are shared with the server
+type (
+	GameVersion   = api.GameVersion
+	AddonProvider = api.Provider
+	AddonChannel  = api.Channel
+)
 
 const (
-	Retail  GameVersion = "retail"
-	Classic GameVersion = "classic"
-)
+	Retail  = api.Retail
+	Classic = api.Classic
 
-type AddonProvider string
+	Curse  = api.Curse
+	Github = api.Github
 
-const (
-	Curse  AddonProvider = "curse"
-	Github AddonProvider = "github"
+	AddonChannelRelease = api.ChannelRelease
+	AddonChannelBeta    = api.ChannelBeta
+	AddonChannelAlpha   = api.ChannelAlpha
 )
 
 type LocalAddon struct {
@@ -29,7 +35,14 @@ type LocalAddon struct {
 	Directories []string      `json:"directories"`
 	Provider    AddonProvider `json:"provider"`
 	ExternalId  string        `json:"providerId"`
-	UpdatedAt   time.Time     `json:"updatedAt"`
+	// The provider ID of the installed file, the CurseForge file or the GitHub release asset
+	FileId     string       `json:"fileId"`
+	Channel    AddonChannel `json:"channel"`
+	Pinned     bool         `json:"pinned"`
+	DeviceOnly bool         `json:"deviceOnly"` // Only installed on this device, not on the other devices of the user
+	// The organization requiring the addon when it was installed for it, nil when the user added it
+	OrganizationId *string   `json:"organizationId"`
+	UpdatedAt      time.Time `json:"updatedAt"`
 }
 
 // LocalAddonRepositoryItem TODO: Remove this shit.
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"wowa-api"
 	"wowa/utils"
 )
 
@@ -41,24 +42,12 @@ func NewAddonManager(addonSearcher *AddonSearcher, configRepository *ConfigRepos
 }
 
 func (am *AddonManager) getAddonsFolder(gameVersion GameVersion) (string, error) {
-	gameDir, err := am.configRepository.Get(GameDir)
+	gameVersionFolder, err := getGameVersionFolder(am.configRepository, gameVersion)
 	if err != nil {
 		return "", err
 	}
-	if gameDir == "" {
-		return "", errors.New("game dir is not defined")
-	}
-
-	var versionFolder string
-	if gameVersion == "classic" {
-		versionFolder = "_classic_era_"
-	} else {
-		versionFolder = "_retail_"
-	}
-
-	addonsFolder := filepath.Join(gameDir, versionFolder, "Interface", "AddOns")
 
-	return addonsFolder, nil
+	return filepath.Join(gameVersionFolder, "Interface", "AddOns"), nil
 }
 
 func (am *AddonManager) isAddonInstallationValid(localAddon *LocalAddon) (bool, error) {
@@ -174,7 +163,50 @@ func (am *AddonManager) extractAddon(zipBytes []byte, addonsFolder string) ([]st
 	return rootDirectories.ToArray(), nil
 }
 
+// getScopeDeviceId returns the device to save a device-only addon for, and nil for an addon on all devices.
+func (am *AddonManager) getScopeDeviceId(deviceOnly bool) (*string, error) {
+	if !deviceOnly {
+		return nil, nil
+	}
+	deviceId, err := am.configRepository.Get(DeviceId)
+	if err != nil {
+		return nil, err
+	}
+	if deviceId == "" {
+		return nil, errors.New("this device is not registered, run \"wowa devices register\" first")
+	}
+	return &deviceId, nil
+}
+
+// PrefetchLatest resolves the latest release of many addons in one request to the server, before installing them.
+func (am *AddonManager) PrefetchLatest(queries []AddonSearchQuery) {
+	am.addonSearcher.Prefetch(queries)
+}
+
+// Install installs or updates the addon, keeping its device scope when it is already installed.
 func (am *AddonManager) Install(url string, gameVersion GameVersion) (AddonInstallResult, error) {
+	return am.install(url, gameVersion, nil, nil)
+}
+
+// InstallScoped installs or updates the addon, and saves it for this device only or for all devices.
+func (am *AddonManager) InstallScoped(url string, gameVersion GameVersion, deviceOnly bool) (AddonInstallResult, error) {
+	return am.install(url, gameVersion, &deviceOnly, nil)
+}
+
+// InstallForOrganization installs or updates an addon required by the organization, and saves it marked as
+// such, so it is told apart from the addons added by the user.
+func (am *AddonManager) InstallForOrganization(url string, gameVersion GameVersion, organizationId string, deviceOnly bool) (AddonInstallResult, error) {
+	return am.install(url, gameVersion, &deviceOnly, &organizationId)
+}
+
+func isSameOrganizationId(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func (am *AddonManager) install(url string, gameVersion GameVersion, deviceOnly *bool, organizationId *string) (AddonInstallResult, error) {
 	searchResult, err := am.addonSearcher.Search(url, gameVersion)
 	if err != nil {
 		return AddonInstallResult{}, err
@@ -185,14 +217,24 @@ func (am *AddonManager) Install(url string, gameVersion GameVersion) (AddonInsta
 		return AddonInstallResult{}, err
 	}
 
+	isDeviceOnly := existingAddon != nil && existingAddon.DeviceOnly
+	if deviceOnly != nil {
+		isDeviceOnly = *deviceOnly
+	}
+	deviceId, err := am.getScopeDeviceId(isDeviceOnly)
+	if err != nil {
+		return AddonInstallResult{}, err
+	}
+
 	// Get the folder where the addons are installed
 	addonsFolder, err := am.getAddonsFolder(gameVersion)
 	if err != nil {
 		return AddonInstallResult{}, err
 	}
 
-	// Check if the addon is already installed
-	if existingAddon != nil && existingAddon.Version == searchResult.Version {
+	// Check if the addon is already installed, a scope or organization change still saves it again
+	if existingAddon != nil && existingAddon.Version == searchResult.Version && existingAddon.DeviceOnly == isDeviceOnly &&
+		isSameOrganizationId(existingAddon.OrganizationId, organizationId) {
 		// Check if the addon installation is valid. We should reinstall if something is missing,
 		isInstallationValid, err := am.isAddonInstallationValid(existingAddon)
 		if err != nil {
@@ -237,39 +279,50 @@ func (am *AddonManager) Install(url string, gameVersion GameVersion) (AddonInsta
 		return AddonInstallResult{}, err
 	}
 
-	// Save the addon to the remote repository
-	remoteAddon, err := am.remoteAddonRepository.GetAddon(searchResult.Slug, gameVersion)
-	if err != nil {
-		return AddonInstallResult{}, err
+	installedAddon := LocalAddon{
+		Id:             searchResult.Slug,
+		Slug:           searchResult.Slug,
+		GameVersion:    gameVersion,
+		Name:           searchResult.Name,
+		Version:        searchResult.Version,
+		Author:         searchResult.Author,
+		Directories:    rootDirectories,
+		Provider:       searchResult.Provider,
+		ExternalId:     searchResult.ExternalId,
+		FileId:         searchResult.FileId,
+		Channel:        searchResult.Channel,
+		DeviceOnly:     isDeviceOnly,
+		OrganizationId: organizationId,
+		UpdatedAt:      time.Now(),
 	}
-	if remoteAddon == nil {
-		_, err := am.remoteAddonRepository.CreateAddon(CreateAddonRequest{
-			Slug:        searchResult.Slug,
-			GameVersion: gameVersion,
-			Author:      searchResult.Author,
-			Name:        searchResult.Name,
-			Provider:    searchResult.Provider,
-			ExternalId:  searchResult.ExternalId,
-			Url:         searchResult.Url,
-		})
-		if err != nil {
-			return AddonInstallResult{}, err
-		}
+	if existingAddon != nil {
+		installedAddon.Pinned = existingAddon.Pinned
 	}
 
-	// Save the addon to the local repository
-	installedAddon := LocalAddon{
-		Id:          searchResult.Slug,
-		Slug:        searchResult.Slug,
+	// Save the addon to the remote repository, on every install so other machines know what to install
+	_, err = am.remoteAddonRepository.SaveAddon(CreateAddonRequest{
+		Slug:        installedAddon.Slug,
 		GameVersion: gameVersion,
-		Name:        searchResult.Name,
-		Version:     searchResult.Version,
-		Author:      searchResult.Author,
-		Directories: rootDirectories,
-		Provider:    searchResult.Provider,
-		ExternalId:  searchResult.ExternalId,
-		UpdatedAt:   time.Now(),
+		PutAddonRequest: api.PutAddonRequest{
+			Author:         installedAddon.Author,
+			Name:           installedAddon.Name,
+			Provider:       installedAddon.Provider,
+			ExternalId:     installedAddon.ExternalId,
+			Url:            searchResult.Url,
+			Version:        installedAddon.Version,
+			FileId:         installedAddon.FileId,
+			Channel:        installedAddon.Channel,
+			Pinned:         installedAddon.Pinned,
+			Directories:    installedAddon.Directories,
+			DeviceId:       deviceId,
+			OrganizationId: organizationId,
+		},
+	})
+	if err != nil {
+		return AddonInstallResult{}, err
 	}
+
+	// Save the addon to the local repository
 	err = am.localAddonRepository.Save(installedAddon)
 	if err != nil {
 		return AddonInstallResult{}, err
@@ -288,9 +341,8 @@ func (am *AddonManager) Install(url string, gameVersion GameVersion) (AddonInsta
 	}, nil
 }
 
-func (am *AddonManager) Remove(id string, gameVersion GameVersion) (bool, error) {
-	// TODO: This should check if the local addons are up to date with the remote repository.
-
+// RemoveLocal uninstalls an addon from this machine only, leaving the remote addon untouched.
+func (am *AddonManager) RemoveLocal(id string, gameVersion GameVersion) (bool, error) {
 	//Get the local addon
 	localAddon, err := am.localAddonRepository.Get(id, gameVersion)
 	if err != nil {
@@ -321,6 +373,22 @@ func (am *AddonManager) Remove(id string, gameVersion GameVersion) (bool, error)
 		return false, err
 	}
 
+	return true, nil
+}
+
+func (am *AddonManager) Remove(id string, gameVersion GameVersion) (bool, error) {
+	// TODO: This should check if the local addons are up to date with the remote repository.
+
+	localAddon, err := am.localAddonRepository.Get(id, gameVersion)
+	if err != nil {
+		return false, err
+	}
+
+	removed, err := am.RemoveLocal(id, gameVersion)
+	if err != nil || !removed {
+		return removed, err
+	}
+
 	// Delete the remote addon
 	err = am.remoteAddonRepository.DeleteAddon(localAddon.Slug, gameVersion)
 	if err != nil {
@@ -0,0 +1,39 @@
+package core
+
+import "wowa-api"
+
+// AddonReference identifies an addon and where to install it from, shared with the server.
+type AddonReference = api.AddonReference
+
+// resolveAddonReference returns the reference of an installed addon by its ID, or of any addon by its URL.
+func resolveAddonReference(localAddonRepository *LocalAddonRepository, addonSearcher *AddonSearcher, idOrUrl string, gameVersion GameVersion) (AddonReference, error) {
+	localAddon, err := localAddonRepository.Get(idOrUrl, gameVersion)
+	if err != nil {
+		return AddonReference{}, err
+	}
+	if localAddon != nil {
+		return AddonReference{
+			Slug:        localAddon.Slug,
+			GameVersion: localAddon.GameVersion,
+			Name:        localAddon.Name,
+			Author:      localAddon.Author,
+			Provider:    localAddon.Provider,
+			ExternalId:  localAddon.ExternalId,
+			Url:         getLocalAddonUrl(*localAddon),
+		}, nil
+	}
+
+	searchResult, err := addonSearcher.Search(idOrUrl, gameVersion)
+	if err != nil {
+		return AddonReference{}, err
+	}
+	return AddonReference{
+		Slug:        searchResult.Slug,
+		GameVersion: gameVersion,
+		Name:        searchResult.Name,
+		Author:      searchResult.Author,
+		Provider:    searchResult.Provider,
+		ExternalId:  searchResult.ExternalId,
+		Url:         searchResult.Url,
+	}, nil
+}
@@ -1,68 +1,66 @@
 package core
 
 import (
-	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
-	"time"
+	"net/url"
+	"wowa-api"
 )
 
-type RemoteAddon struct {
-	Id          string        `json:"id"`
-	UserId      string        `json:"user_id"`
-	GameVersion GameVersion   `json:"game_version"`
-	Slug        string        `json:"slug"`
-	Name        string        `json:"name"`
-	Author      string        `json:"author"`
-	Provider    AddonProvider `json:"provider"`
-	ExternalId  string        `json:"external_id"`
-	Url         string        `json:"url"`
-	CreatedAt   time.Time     `json:"created_at"`
-	UpdatedAt   time.Time     `json:"updated_at"`
+// The addons as sent and returned by the server
+type (
+	RemoteAddon        = api.Addon
+	DeletedRemoteAddon = api.DeletedAddon
+	RemoteAddonChanges = api.AddonChanges
+	CreateAddonRequest = api.AddAddonRequest
+)
+
+type RemoteAddonRepository struct {
+	userManager      *UserManager
+	configRepository *ConfigRepository
+	cache            []RemoteAddon
 }
 
-type CreateAddonRequest struct {
-	GameVersion GameVersion   `json:"game_version"`
-	Slug        string        `json:"slug"`
-	Name        string        `json:"name"`
-	Author      string        `json:"author"`
-	Provider    AddonProvider `json:"provider"`
-	ExternalId  string        `json:"external_id"`
-	Url         string        `json:"url"`
+func NewRemoteAddonRepository(userManager *UserManager, configRepository *ConfigRepository) *RemoteAddonRepository {
+	return &RemoteAddonRepository{userManager: userManager, configRepository: configRepository}
 }
 
-type RemoteAddonRepository struct {
-	userManager *UserManager
-	apiUrl      string
-	cache       []RemoteAddon
+// IsForThisDevice returns whether the addon is installed on all devices or on this one.
+// Addons scoped to a device are never for an unregistered device.
+func (rar *RemoteAddonRepository) IsForThisDevice(remoteAddon RemoteAddon) (bool, error) {
+	if remoteAddon.DeviceId == nil {
+		return true, nil
+	}
+	deviceId, err := rar.configRepository.Get(DeviceId)
+	if err != nil {
+		return false, err
+	}
+	return *remoteAddon.DeviceId == deviceId, nil
 }
 
-func NewRemoteAddonRepository(userManager *UserManager, apiUrl string) *RemoteAddonRepository {
-	return &RemoteAddonRepository{userManager: userManager, apiUrl: apiUrl}
+func (rar *RemoteAddonRepository) doRequest(method string, path string, body []byte) (*http.Response, error) {
+	return rar.userManager.DoAuthenticatedRequest(method, path, body)
 }
 
-func (rar *RemoteAddonRepository) CreateAddon(addon CreateAddonRequest) (*RemoteAddon, error) {
-	token, err := rar.userManager.GetUserToken()
-	if err != nil || token == "" {
-		return nil, errors.New("no user signed in")
+// cacheAddon adds the addon to the cache, replacing the cached one with the same game version and slug.
+func (rar *RemoteAddonRepository) cacheAddon(remoteAddon RemoteAddon) {
+	for i, cachedAddon := range rar.cache {
+		if cachedAddon.Slug == remoteAddon.Slug && cachedAddon.GameVersion == remoteAddon.GameVersion {
+			rar.cache[i] = remoteAddon
+			return
+		}
 	}
+	rar.cache = append(rar.cache, remoteAddon)
+}
 
+func (rar *RemoteAddonRepository) CreateAddon(addon CreateAddonRequest) (*RemoteAddon, error) {
 	body, err := json.Marshal(addon)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/addons", rar.apiUrl), bytes.NewBuffer(body))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := rar.doRequest("POST", "/addons", body)
 	if err != nil {
 		return nil, err
 	}
@@ -70,8 +68,9 @@ func (rar *RemoteAddonRepository) CreateAddon(addon CreateAddonRequest) (*Remote
 		_ = resp.Body.Close()
 	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to create addon: %s", resp.Status)
+	// 201 when the addon was created, 200 when it already existed
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("failed to create addon: %w", readAPIError(resp))
 	}
 
 	var remoteAddon RemoteAddon
@@ -79,25 +78,43 @@ func (rar *RemoteAddonRepository) CreateAddon(addon CreateAddonRequest) (*Remote
 		return nil, err
 	}
 
-	rar.cache = append(rar.cache, remoteAddon)
+	rar.cacheAddon(remoteAddon)
 
 	return &remoteAddon, nil
 }
 
-func (rar *RemoteAddonRepository) DeleteAddon(slug string, gameVersion GameVersion) error {
-	token, err := rar.userManager.GetUserToken()
-	if err != nil || token == "" {
-		return errors.New("no user signed in")
+// SaveAddon creates the remote addon, or replaces it with what is installed locally.
+func (rar *RemoteAddonRepository) SaveAddon(addon CreateAddonRequest) (*RemoteAddon, error) {
+	body, err := json.Marshal(addon)
+	if err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/addons/%s/%s", rar.apiUrl, gameVersion, slug), nil)
+	resp, err := rar.doRequest("PUT", fmt.Sprintf("/addons/%s/%s", addon.GameVersion, addon.Slug), body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// 201 when the addon was created, 200 when it already existed
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("failed to save addon: %w", readAPIError(resp))
+	}
+
+	var remoteAddon RemoteAddon
+	if err := json.NewDecoder(resp.Body).Decode(&remoteAddon); err != nil {
+		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	rar.cacheAddon(remoteAddon)
+
+	return &remoteAddon, nil
+}
+
+func (rar *RemoteAddonRepository) DeleteAddon(slug string, gameVersion GameVersion) error {
+	resp, err := rar.doRequest("DELETE", fmt.Sprintf("/addons/%s/%s", gameVersion, slug), nil)
 	if err != nil {
 		return err
 	}
@@ -106,7 +123,7 @@ func (rar *RemoteAddonRepository) DeleteAddon(slug string, gameVersion GameVersi
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to delete addon: %s", resp.Status)
+		return fmt.Errorf("failed to delete addon: %w", readAPIError(resp))
 	}
 
 	if rar.cache != nil {
@@ -122,24 +139,22 @@ func (rar *RemoteAddonRepository) DeleteAddon(slug string, gameVersion GameVersi
 	return nil
 }
 
+// GetAddons returns the addons to install on this device.
 func (rar *RemoteAddonRepository) GetAddons() ([]RemoteAddon, error) {
 	if rar.cache != nil {
 		return rar.cache, nil
 	}
 
-	token, err := rar.userManager.GetUserToken()
-	if err != nil || token == "" {
-		return nil, errors.New("no user signed in")
-	}
-
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/addons", rar.apiUrl), nil)
+	path := "/addons"
+	deviceId, err := rar.configRepository.Get(DeviceId)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
+	if deviceId != "" {
+		path += "?device_id=" + url.QueryEscape(deviceId)
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := rar.doRequest("GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -148,19 +163,49 @@ func (rar *RemoteAddonRepository) GetAddons() ([]RemoteAddon, error) {
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get remote addons: %s", resp.Status)
+		return nil, fmt.Errorf("failed to get remote addons: %w", readAPIError(resp))
 	}
 
-	var addons []RemoteAddon
-	if err := json.NewDecoder(resp.Body).Decode(&addons); err != nil {
+	var allAddons []RemoteAddon
+	if err := json.NewDecoder(resp.Body).Decode(&allAddons); err != nil {
 		return nil, err
 	}
 
+	// Without a device, the server also returns the addons scoped to the other devices
+	addons := []RemoteAddon{}
+	for _, addon := range allAddons {
+		if addon.DeviceId == nil || *addon.DeviceId == deviceId {
+			addons = append(addons, addon)
+		}
+	}
+
 	rar.cache = addons
 
 	return addons, nil
 }
 
+// GetChanges returns the latest state of the addons saved or deleted since the cursor, 0 to get all of them.
+func (rar *RemoteAddonRepository) GetChanges(cursor int64) (*RemoteAddonChanges, error) {
+	resp, err := rar.doRequest("GET", fmt.Sprintf("/addons/changes?cursor=%d", cursor), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get remote addon changes: %w", readAPIError(resp))
+	}
+
+	var changes RemoteAddonChanges
+	if err := json.NewDecoder(resp.Body).Decode(&changes); err != nil {
+		return nil, err
+	}
+
+	return &changes, nil
+}
+
 func (rar *RemoteAddonRepository) GetAddon(slug string, gameVersion GameVersion) (*RemoteAddon, error) {
 	if rar.cache != nil {
 		for _, addon := range rar.cache {
@@ -170,19 +215,7 @@ func (rar *RemoteAddonRepository) GetAddon(slug string, gameVersion GameVersion)
 		}
 	}
 
-	token, err := rar.userManager.GetUserToken()
-	if err != nil || token == "" {
-		return nil, errors.New("no user signed in")
-	}
-
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/addons/%s/%s", rar.apiUrl, gameVersion, slug), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := rar.doRequest("GET", fmt.Sprintf("/addons/%s/%s", gameVersion, slug), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -193,7 +226,7 @@ func (rar *RemoteAddonRepository) GetAddon(slug string, gameVersion GameVersion)
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, nil // Addon not found
 	} else if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get remote addon: %s", resp.Status)
+		return nil, fmt.Errorf("failed to get remote addon: %w", readAPIError(resp))
 	}
 
 	var remoteAddon RemoteAddon
@@ -6,6 +6,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"wowa-api"
 )
 
 type AddonSearchResult struct {
@@ -16,18 +18,41 @@ type AddonSearchResult struct {
 	Version     string
 	Provider    AddonProvider
 	ExternalId  string
+	FileId      string
+	Channel     AddonChannel
 	Url         string
 	DownloadUrl RequestParams
 }
 
+// AddonSearchQuery is an addon to search, by its ID or URL as given to Search.
+type AddonSearchQuery struct {
+	IdOrUrl     string
+	GameVersion GameVersion
+}
+
+// AddonSearcher finds the latest release of the addons. The wowa server is asked first, since it shares its
+// provider keys and caches the releases, and the providers are only asked directly when it does not find the addon.
 type AddonSearcher struct {
-	httpClient  *HTTPClient
-	curseToken  string
-	githubToken string
+	httpClient         *HTTPClient
+	providerRepository *ProviderRepository
+	curseToken         string
+	githubToken        string
+
+	mu sync.Mutex
+	// The resolutions returned by the server, for the whole command
+	resolutions map[api.AddonLookup]api.AddonResolution
+	// Set when the server cannot resolve the addons, so it is not asked again
+	serverUnavailable bool
 }
 
-func NewAddonSearcher(httpClient *HTTPClient, curseToken string, githubToken string) *AddonSearcher {
-	return &AddonSearcher{httpClient: httpClient, curseToken: curseToken, githubToken: githubToken}
+func NewAddonSearcher(httpClient *HTTPClient, providerRepository *ProviderRepository, curseToken string, githubToken string) *AddonSearcher {
+	return &AddonSearcher{
+		httpClient:         httpClient,
+		providerRepository: providerRepository,
+		curseToken:         curseToken,
+		githubToken:        githubToken,
+		resolutions:        make(map[api.AddonLookup]api.AddonResolution),
+	}
 }
 
 func (as *AddonSearcher) parseCurseSlug(idOrUrl string) string {
@@ -157,6 +182,8 @@ func (as *AddonSearcher) curseSearch(slug string, gameVersion GameVersion) (Addo
 		Version:     modFile.DisplayName,
 		Provider:    Curse,
 		ExternalId:  strconv.Itoa(curseMod.Id),
+		FileId:      strconv.Itoa(fileIndex.FileID),
+		Channel:     AddonChannelRelease,
 		Url:         fmt.Sprintf("https://www.curseforge.com/wow/addons/%s", curseMod.Slug),
 		DownloadUrl: RequestParams{
 			URL: modFile.DownloadUrl,
@@ -232,6 +259,8 @@ func (as *AddonSearcher) githubSearch(organization string, repository string, ga
 		Version:     latestRelease.TagName,
 		Provider:    Github,
 		ExternalId:  fmt.Sprintf("%s/%s", organization, repository),
+		FileId:      strconv.Itoa(asset.Id),
+		Channel:     AddonChannelRelease,
 		Url:         fmt.Sprintf("https://github.com/%s/%s", organization, repository),
 		DownloadUrl: RequestParams{
 			URL: fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/assets/%d", organization, repository, asset.Id),
@@ -243,16 +272,104 @@ func (as *AddonSearcher) githubSearch(organization string, repository string, ga
 	}, nil
 }
 
-func (as *AddonSearcher) Search(idOrUrl string, gameVersion GameVersion) (AddonSearchResult, error) {
+// parseLookup returns the provider and the ID of an addon at its provider, by its ID or URL.
+func (as *AddonSearcher) parseLookup(idOrUrl string, gameVersion GameVersion) (api.AddonLookup, error) {
 	curseSlug := as.parseCurseSlug(idOrUrl)
 	if curseSlug != "" {
-		return as.curseSearch(curseSlug, gameVersion)
+		return api.AddonLookup{Provider: Curse, Id: curseSlug, GameVersion: gameVersion}, nil
 	}
 
 	organization, repository := as.parseGithubOrganizationAndRepository(idOrUrl)
 	if organization != "" && repository != "" {
-		return as.githubSearch(organization, repository, gameVersion)
+		return api.AddonLookup{Provider: Github, Id: organization + "/" + repository, GameVersion: gameVersion}, nil
+	}
+
+	return api.AddonLookup{}, errors.New("invalid addon id or url: " + idOrUrl)
+}
+
+// resolveOnServer asks the server for the lookups it has not resolved yet. When the server cannot answer,
+// because no user is signed in or it has no provider key, it is not asked again.
+func (as *AddonSearcher) resolveOnServer(lookups []api.AddonLookup) {
+	as.mu.Lock()
+	var pending []api.AddonLookup
+	if !as.serverUnavailable {
+		for _, lookup := range lookups {
+			if _, ok := as.resolutions[lookup]; !ok {
+				pending = append(pending, lookup)
+			}
+		}
+	}
+	as.mu.Unlock()
+	if len(pending) == 0 {
+		return
 	}
 
-	return AddonSearchResult{}, errors.New("invalid addon id or url: " + idOrUrl)
+	resolutions, err := as.providerRepository.Resolve(pending)
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if err != nil {
+		as.serverUnavailable = true
+		return
+	}
+	for _, resolution := range resolutions {
+		as.resolutions[resolution.AddonLookup] = resolution
+	}
+}
+
+// Prefetch asks the server for the latest release of many addons at once, before searching them one by one.
+// The invalid queries are left to Search to report.
+func (as *AddonSearcher) Prefetch(queries []AddonSearchQuery) {
+	var lookups []api.AddonLookup
+	for _, query := range queries {
+		if lookup, err := as.parseLookup(query.IdOrUrl, query.GameVersion); err == nil {
+			lookups = append(lookups, lookup)
+		}
+	}
+	as.resolveOnServer(lookups)
+}
+
+// serverSearch returns the release resolved by the server, and whether the server found it. The server may
+// have cached that an addon is missing while it was just published, so its provider is asked again directly.
+func (as *AddonSearcher) serverSearch(lookup api.AddonLookup) (AddonSearchResult, bool) {
+	as.resolveOnServer([]api.AddonLookup{lookup})
+
+	as.mu.Lock()
+	resolution, ok := as.resolutions[lookup]
+	as.mu.Unlock()
+	if !ok || resolution.Addon == nil {
+		return AddonSearchResult{}, false
+	}
+
+	addon := resolution.Addon
+	return AddonSearchResult{
+		Slug:        addon.Slug,
+		Name:        addon.Name,
+		Author:      addon.Author,
+		GameVersion: addon.GameVersion,
+		Version:     addon.Version,
+		Provider:    addon.Provider,
+		ExternalId:  addon.ExternalId,
+		FileId:      addon.FileId,
+		Channel:     addon.Channel,
+		Url:         addon.Url,
+		DownloadUrl: RequestParams{URL: addon.DownloadUrl},
+	}, true
+}
+
+func (as *AddonSearcher) Search(idOrUrl string, gameVersion GameVersion) (AddonSearchResult, error) {
+	lookup, err := as.parseLookup(idOrUrl, gameVersion)
+	if err != nil {
+		return AddonSearchResult{}, err
+	}
+
+	if result, ok := as.serverSearch(lookup); ok {
+		return result, nil
+	}
+
+	if lookup.Provider == Curse {
+		return as.curseSearch(lookup.Id, gameVersion)
+	}
+	organization, repository, _ := strings.Cut(lookup.Id, "/")
+	return as.githubSearch(organization, repository, gameVersion)
 }
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"wowa-api"
+)
+
+// redirectTransport sends the requests to the providers to a test server instead.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rt.target.Scheme
+	req.URL.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSearchAsksTheProviderWhenTheServerDoesNotFindTheAddon(t *testing.T) {
+	t.Setenv("WOWA_TOKEN", "")
+
+	// The test server answers both as the wowa server, which has cached that the addon is missing, and as GitHub
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/providers/resolve":
+			var resolveRequest api.ResolveAddonsRequest
+			if err := json.NewDecoder(r.Body).Decode(&resolveRequest); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var resolutions []api.AddonResolution
+			for _, lookup := range resolveRequest.Addons {
+				resolutions = append(resolutions, api.AddonResolution{AddonLookup: lookup, Error: &api.ErrorResponse{Code: api.ErrorCodeNotFound}})
+			}
+			_ = json.NewEncoder(w).Encode(api.ResolveAddonsResponse{Addons: resolutions})
+		case "/repos/Tercioo/Details-Damage-Meter/releases/latest":
+			_, _ = w.Write([]byte(`{"tag_name": "1.0.0", "assets": [{"id": 12, "browser_download_url": "https://github.com/Tercioo/Details-Damage-Meter/releases/download/1.0.0/Details.zip"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kvStore, err := NewKeyValueStore(filepath.Join(t.TempDir(), "store.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	configRepository := NewConfigRepository(kvStore)
+	token := "token"
+	if err := configRepository.Set(AuthToken, &token); err != nil {
+		t.Fatal(err)
+	}
+	httpClient := &HTTPClient{client: &http.Client{Transport: redirectTransport{target: target}}}
+	searcher := NewAddonSearcher(httpClient, NewProviderRepository(NewUserManager(configRepository, server.URL)), "", "github-token")
+
+	result, err := searcher.Search("https://github.com/Tercioo/Details-Damage-Meter", Retail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != "1.0.0" || result.ExternalId != "Tercioo/Details-Damage-Meter" {
+		t.Fatalf("expected the release found at the provider, got %+v", result)
+	}
+}
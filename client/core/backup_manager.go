@@ -0,0 +1,484 @@
+package core
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultBackupRetention = 10
+
+type BackupReason string
+
+const (
+	BackupReasonManual        BackupReason = "manual"
+	BackupReasonBeforeUpdate  BackupReason = "before-update"
+	BackupReasonBeforeRestore BackupReason = "before-restore"
+	BackupReasonPurge         BackupReason = "purge"
+)
+
+type BackupOptions struct {
+	SavedVariablesOnly bool
+	Reason             BackupReason
+}
+
+// BeforeUpdateBackupOptions are used for the snapshot taken automatically before addons are updated.
+var BeforeUpdateBackupOptions = BackupOptions{SavedVariablesOnly: true, Reason: BackupReasonBeforeUpdate}
+
+type Backup struct {
+	Name               string
+	Path               string
+	GameVersion        GameVersion
+	SavedVariablesOnly bool
+	Reason             BackupReason
+	CreatedAt          time.Time
+	Size               int64
+}
+
+type BackupManager struct {
+	configRepository *ConfigRepository
+	defaultDir       string
+}
+
+func NewBackupManager(configRepository *ConfigRepository, defaultDir string) *BackupManager {
+	return &BackupManager{configRepository: configRepository, defaultDir: defaultDir}
+}
+
+func (bm *BackupManager) getBackupDir() (string, error) {
+	backupDir, err := bm.configRepository.Get(BackupDir)
+	if err != nil {
+		return "", err
+	}
+	if backupDir == "" {
+		return bm.defaultDir, nil
+	}
+	return backupDir, nil
+}
+
+func (bm *BackupManager) getRetention() (int, error) {
+	rawRetention, err := bm.configRepository.Get(BackupRetention)
+	if err != nil {
+		return 0, err
+	}
+	if rawRetention == "" {
+		return defaultBackupRetention, nil
+	}
+	retention, err := strconv.Atoi(rawRetention)
+	if err != nil || retention < 1 {
+		return 0, fmt.Errorf("invalid %s: %s", BackupRetention, rawRetention)
+	}
+	return retention, nil
+}
+
+func (bm *BackupManager) getWtfFolder(gameVersion GameVersion) (string, error) {
+	gameVersionFolder, err := getGameVersionFolder(bm.configRepository, gameVersion)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gameVersionFolder, "WTF"), nil
+}
+
+// Backups are named <game version>_<timestamp>_<scope>_<reason>.zip, the timestamp having milliseconds
+// since several backups can be taken in the same second
+func (bm *BackupManager) backupFileName(gameVersion GameVersion, createdAt time.Time, options BackupOptions) string {
+	scope := "wtf"
+	if options.SavedVariablesOnly {
+		scope = "savedvariables"
+	}
+	return fmt.Sprintf("%s_%s_%s_%s.zip", gameVersion, createdAt.Format("20060102-150405.000"), scope, options.Reason)
+}
+
+// newBackupPath returns the name and the path of a new backup, with a timestamp no other backup has.
+func (bm *BackupManager) newBackupPath(backupDir string, gameVersion GameVersion, options BackupOptions) (string, string, time.Time, error) {
+	createdAt := time.Now()
+	for {
+		name := bm.backupFileName(gameVersion, createdAt, options)
+		backupPath := filepath.Join(backupDir, name)
+		if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+			return name, backupPath, createdAt, nil
+		} else if err != nil {
+			return "", "", time.Time{}, err
+		}
+		createdAt = createdAt.Add(time.Millisecond)
+	}
+}
+
+func (bm *BackupManager) parseBackupFileName(name string) (Backup, bool) {
+	parts := strings.Split(strings.TrimSuffix(name, ".zip"), "_")
+	if !strings.HasSuffix(name, ".zip") || len(parts) != 4 {
+		return Backup{}, false
+	}
+
+	// The milliseconds are optional when parsing, the older backups have none
+	createdAt, err := time.ParseInLocation("20060102-150405", parts[1], time.Local)
+	if err != nil {
+		return Backup{}, false
+	}
+
+	return Backup{
+		Name:               name,
+		GameVersion:        GameVersion(parts[0]),
+		CreatedAt:          createdAt,
+		SavedVariablesOnly: parts[2] == "savedvariables",
+		Reason:             BackupReason(parts[3]),
+	}, true
+}
+
+func isSavedVariablesPath(relativePath string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(relativePath), "/") {
+		if part == "SavedVariables" {
+			return true
+		}
+	}
+	return false
+}
+
+func (bm *BackupManager) writeBackup(wtfFolder string, backupPath string, include func(relativePath string) bool) error {
+	tempPath := backupPath + ".tmp"
+	backupFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+
+	zipWriter := zip.NewWriter(backupFile)
+	err = filepath.Walk(wtfFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(wtfFolder, path)
+		if err != nil {
+			return err
+		}
+		if !include(relativePath) {
+			return nil
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relativePath)
+		header.Method = zip.Deflate
+
+		entryWriter, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func(file *os.File) {
+			_ = file.Close()
+		}(file)
+
+		_, err = io.Copy(entryWriter, file)
+		return err
+	})
+	if err == nil {
+		err = zipWriter.Close()
+	}
+	if closeErr := backupFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, backupPath)
+}
+
+// applyRetention removes the oldest backups of the flavor taken for the reason, except the kept one.
+func (bm *BackupManager) applyRetention(gameVersion GameVersion, reason BackupReason, keptPath string) error {
+	retention, err := bm.getRetention()
+	if err != nil {
+		return err
+	}
+
+	backups, err := bm.List()
+	if err != nil {
+		return err
+	}
+
+	// List is sorted from the newest to the oldest backup
+	kept := 0
+	for _, backup := range backups {
+		if backup.GameVersion != gameVersion || backup.Reason != reason || backup.Path == keptPath {
+			continue
+		}
+		kept++
+		if kept > retention {
+			if err := os.Remove(backup.Path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Create writes a snapshot of the WTF folder of the given flavor.
+// It returns nil when the flavor has no WTF folder yet.
+func (bm *BackupManager) Create(gameVersion GameVersion, options BackupOptions) (*Backup, error) {
+	return bm.create(gameVersion, options, "")
+}
+
+// create writes a snapshot like Create, without removing the kept backup when applying the retention.
+func (bm *BackupManager) create(gameVersion GameVersion, options BackupOptions, keptPath string) (*Backup, error) {
+	wtfFolder, err := bm.getWtfFolder(gameVersion)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(wtfFolder); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	backupDir, err := bm.getBackupDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(backupDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	if options.Reason == "" {
+		options.Reason = BackupReasonManual
+	}
+	name, backupPath, createdAt, err := bm.newBackupPath(backupDir, gameVersion, options)
+	if err != nil {
+		return nil, err
+	}
+
+	include := func(relativePath string) bool {
+		return !options.SavedVariablesOnly || isSavedVariablesPath(relativePath)
+	}
+	if err := bm.writeBackup(wtfFolder, backupPath, include); err != nil {
+		return nil, err
+	}
+
+	if err := bm.applyRetention(gameVersion, options.Reason, keptPath); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backup{
+		Name:               name,
+		Path:               backupPath,
+		GameVersion:        gameVersion,
+		SavedVariablesOnly: options.SavedVariablesOnly,
+		Reason:             options.Reason,
+		CreatedAt:          createdAt,
+		Size:               info.Size(),
+	}, nil
+}
+
+// Archive moves the given files of the WTF folder, relative to it, into a backup.
+func (bm *BackupManager) Archive(gameVersion GameVersion, relativePaths []string, reason BackupReason) (*Backup, error) {
+	wtfFolder, err := bm.getWtfFolder(gameVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	backupDir, err := bm.getBackupDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(backupDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	options := BackupOptions{SavedVariablesOnly: true, Reason: reason}
+	name, backupPath, createdAt, err := bm.newBackupPath(backupDir, gameVersion, options)
+	if err != nil {
+		return nil, err
+	}
+
+	archived := make(map[string]bool)
+	for _, relativePath := range relativePaths {
+		archived[filepath.Clean(relativePath)] = true
+	}
+	include := func(relativePath string) bool {
+		return archived[filepath.Clean(relativePath)]
+	}
+	if err := bm.writeBackup(wtfFolder, backupPath, include); err != nil {
+		return nil, err
+	}
+
+	for relativePath := range archived {
+		if err := os.Remove(filepath.Join(wtfFolder, relativePath)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backup{
+		Name:               name,
+		Path:               backupPath,
+		GameVersion:        gameVersion,
+		SavedVariablesOnly: options.SavedVariablesOnly,
+		Reason:             options.Reason,
+		CreatedAt:          createdAt,
+		Size:               info.Size(),
+	}, nil
+}
+
+// CreateAll writes a snapshot for every flavor that has a WTF folder.
+func (bm *BackupManager) CreateAll(options BackupOptions) ([]Backup, error) {
+	var backups []Backup
+	for _, gameVersion := range []GameVersion{Retail, Classic} {
+		backup, err := bm.Create(gameVersion, options)
+		if err != nil {
+			return backups, err
+		}
+		if backup != nil {
+			backups = append(backups, *backup)
+		}
+	}
+	return backups, nil
+}
+
+// List returns all the backups, from the newest to the oldest.
+func (bm *BackupManager) List() ([]Backup, error) {
+	backupDir, err := bm.getBackupDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var backups []Backup
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		backup, ok := bm.parseBackupFileName(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backup.Path = filepath.Join(backupDir, entry.Name())
+		backup.Size = info.Size()
+		backups = append(backups, backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// Restore extracts a backup over the WTF folder of its flavor.
+// The current state is backed up first, so a restore can be undone.
+func (bm *BackupManager) Restore(name string) (Backup, error) {
+	backups, err := bm.List()
+	if err != nil {
+		return Backup{}, err
+	}
+
+	var backup *Backup
+	for i := range backups {
+		if backups[i].Name == name || strings.TrimSuffix(backups[i].Name, ".zip") == name {
+			backup = &backups[i]
+			break
+		}
+	}
+	if backup == nil {
+		return Backup{}, errors.New("backup not found: " + name)
+	}
+
+	zipReader, err := zip.OpenReader(backup.Path)
+	if err != nil {
+		return Backup{}, err
+	}
+	defer func(zipReader *zip.ReadCloser) {
+		_ = zipReader.Close()
+	}(zipReader)
+
+	// The restored backup may be the oldest one taken before a restore, so the retention must keep it
+	_, err = bm.create(backup.GameVersion, BackupOptions{
+		SavedVariablesOnly: backup.SavedVariablesOnly,
+		Reason:             BackupReasonBeforeRestore,
+	}, backup.Path)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	wtfFolder, err := bm.getWtfFolder(backup.GameVersion)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	extractFile := func(file *zip.File) error {
+		// Check for ZipSlip, the file must end up in the WTF folder
+		path := filepath.Join(wtfFolder, filepath.FromSlash(file.Name))
+		relativePath, err := filepath.Rel(wtfFolder, path)
+		if err != nil || filepath.IsAbs(file.Name) || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("illegal file path: %s", file.Name)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		fileReader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer func(fileReader io.ReadCloser) {
+			_ = fileReader.Close()
+		}(fileReader)
+
+		outputFile, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer func(outputFile *os.File) {
+			_ = outputFile.Close()
+		}(outputFile)
+
+		_, err = io.Copy(outputFile, fileReader)
+		return err
+	}
+
+	for _, file := range zipReader.File {
+		if file.Mode().IsDir() {
+			continue
+		}
+		if err := extractFile(file); err != nil {
+			return Backup{}, err
+		}
+	}
+
+	return *backup, nil
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestBackupManager returns a backup manager for a game folder and a backup folder in a temporary directory,
+// with the WTF folder of the retail flavor.
+func newTestBackupManager(t *testing.T, retention string) (*BackupManager, string) {
+	t.Helper()
+	dir := t.TempDir()
+	kvStore, err := NewKeyValueStore(filepath.Join(dir, "store.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	configRepository := NewConfigRepository(kvStore)
+	gameDir := filepath.Join(dir, "game")
+	for key, value := range map[Config]string{GameDir: gameDir, BackupRetention: retention} {
+		if err := configRepository.Set(key, &value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wtfFolder := filepath.Join(gameDir, "_retail_", "WTF")
+	if err := os.MkdirAll(filepath.Join(wtfFolder, "Account", "SavedVariables"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	return NewBackupManager(configRepository, filepath.Join(dir, "backups")), wtfFolder
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestBackupNamesAreUnique(t *testing.T) {
+	bm, _ := newTestBackupManager(t, "10")
+
+	first, err := bm.Create(Retail, BackupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := bm.Create(Retail, BackupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name == second.Name {
+		t.Fatalf("expected two backups taken at once to have different names, got %s", first.Name)
+	}
+
+	backups, err := bm.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Name != second.Name {
+		t.Fatalf("expected both backups from the newest, got %+v", backups)
+	}
+}
+
+func TestParseBackupFileNameWithoutMilliseconds(t *testing.T) {
+	bm, _ := newTestBackupManager(t, "10")
+
+	backup, ok := bm.parseBackupFileName("retail_20240102-030405_savedvariables_before-update.zip")
+	if !ok {
+		t.Fatal("expected the name of an older backup to be parsed")
+	}
+	expected := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	if !backup.CreatedAt.Equal(expected) || !backup.SavedVariablesOnly || backup.Reason != BackupReasonBeforeUpdate {
+		t.Fatalf("unexpected backup: %+v", backup)
+	}
+}
+
+func TestRestoreKeepsTheRestoredBackup(t *testing.T) {
+	bm, wtfFolder := newTestBackupManager(t, "1")
+	savedVariablesPath := filepath.Join(wtfFolder, "Account", "SavedVariables", "Details.lua")
+	writeTestFile(t, savedVariablesPath, "before")
+
+	// The only backup kept before a restore is the one restored
+	backup, err := bm.Create(Retail, BackupOptions{Reason: BackupReasonBeforeRestore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, savedVariablesPath, "after")
+
+	if _, err := bm.Restore(backup.Name); err != nil {
+		t.Fatal(err)
+	}
+	if content := readTestFile(t, savedVariablesPath); content != "before" {
+		t.Fatalf("expected the backup to be restored, got %s", content)
+	}
+
+	// The new backup undoes the restore, and both are kept for now
+	backups, err := bm.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected the restored backup and the new one, got %+v", backups)
+	}
+}
+
+// writeTestBackup writes a backup of the retail flavor with the files, by name in the zip.
+func writeTestBackup(t *testing.T, bm *BackupManager, files map[string]string) string {
+	t.Helper()
+	backupDir, err := bm.getBackupDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(backupDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	name := bm.backupFileName(Retail, time.Now().Add(-time.Hour), BackupOptions{Reason: BackupReasonManual})
+	backupFile, err := os.Create(filepath.Join(backupDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipWriter := zip.NewWriter(backupFile)
+	for fileName, content := range files {
+		entryWriter, err := zipWriter.Create(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entryWriter.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := backupFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestRestoreRejectsPathsOutsideTheWtfFolder(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		valid    bool
+	}{
+		{"a file of the WTF folder", "Account/SavedVariables/Details.lua", true},
+		{"dots in a file name", "Account/SavedVariables/Details..lua", true},
+		{"a path going back inside the WTF folder", "Account/../Config.wtf", true},
+		{"a path leaving the WTF folder", "../evil.lua", false},
+		{"a path leaving the WTF folder from a subfolder", "Account/../../evil.lua", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bm, wtfFolder := newTestBackupManager(t, "10")
+			name := writeTestBackup(t, bm, map[string]string{test.fileName: "restored"})
+
+			_, err := bm.Restore(name)
+			if test.valid {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if content := readTestFile(t, filepath.Join(wtfFolder, filepath.FromSlash(test.fileName))); content != "restored" {
+					t.Fatalf("expected the file to be restored, got %s", content)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected the restore to fail")
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(wtfFolder), "evil.lua")); !os.IsNotExist(err) {
+				t.Fatalf("expected no file outside the WTF folder, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+type CollectionManager struct {
+	collectionRepository *CollectionRepository
+	localAddonRepository *LocalAddonRepository
+	addonSearcher        *AddonSearcher
+	userManager          *UserManager
+}
+
+func NewCollectionManager(collectionRepository *CollectionRepository, localAddonRepository *LocalAddonRepository, addonSearcher *AddonSearcher, userManager *UserManager) *CollectionManager {
+	return &CollectionManager{collectionRepository: collectionRepository, localAddonRepository: localAddonRepository, addonSearcher: addonSearcher, userManager: userManager}
+}
+
+// Find returns the collection with the given ID or name, among the ones owned by the user or subscribed to.
+func (cm *CollectionManager) Find(idOrName string) (*Collection, error) {
+	collections, err := cm.collectionRepository.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Collection
+	for i, collection := range collections {
+		if collection.Id == idOrName {
+			return &collections[i], nil
+		}
+		if strings.EqualFold(collection.Name, idOrName) {
+			if found != nil {
+				return nil, fmt.Errorf("several lists are named %s, use the list ID instead", idOrName)
+			}
+			found = &collections[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("list %s not found", idOrName)
+	}
+	return found, nil
+}
+
+// AddAddon adds an installed addon by its ID, or any addon by its URL, to the collection.
+func (cm *CollectionManager) AddAddon(collection *Collection, idOrUrl string, gameVersion GameVersion) (*Collection, error) {
+	addon, err := resolveAddonReference(cm.localAddonRepository, cm.addonSearcher, idOrUrl, gameVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return cm.collectionRepository.AddAddon(collection.Id, addon)
+}
+
+// parseShareCode accepts either a share code or a share link.
+func parseShareCode(codeOrLink string) string {
+	codeOrLink = strings.TrimRight(strings.TrimSpace(codeOrLink), "/")
+	if index := strings.LastIndex(codeOrLink, "/shared/collections/"); index != -1 {
+		return codeOrLink[index+len("/shared/collections/"):]
+	}
+	return codeOrLink
+}
+
+// GetShared returns the shared collection, subscribing to it first when a user is signed in.
+func (cm *CollectionManager) GetShared(codeOrLink string) (*Collection, error) {
+	shareCode := parseShareCode(codeOrLink)
+
+	token, err := cm.userManager.GetUserToken()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return cm.collectionRepository.GetShared(shareCode)
+	}
+	return cm.collectionRepository.Subscribe(shareCode)
+}
+
+func (cm *CollectionManager) Share(collection *Collection) (*Collection, string, error) {
+	shared, err := cm.collectionRepository.Share(collection.Id)
+	if err != nil {
+		return nil, "", err
+	}
+	return shared, cm.collectionRepository.GetShareLink(*shared.ShareCode), nil
+}
+
+// Unshare stops sharing the collection. The users who already subscribed keep it.
+func (cm *CollectionManager) Unshare(collection *Collection) (*Collection, error) {
+	return cm.collectionRepository.Unshare(collection.Id)
+}
+
+func (cm *CollectionManager) Create(name string) (*Collection, error) {
+	return cm.collectionRepository.Create(name)
+}
+
+func (cm *CollectionManager) GetAll() ([]Collection, error) {
+	return cm.collectionRepository.GetAll()
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"wowa-api"
+)
+
+// The collections as returned by the server
+type (
+	Collection      = api.Collection
+	CollectionAddon = api.CollectionAddon
+)
+
+type CollectionRepository struct {
+	userManager *UserManager
+}
+
+func NewCollectionRepository(userManager *UserManager) *CollectionRepository {
+	return &CollectionRepository{userManager: userManager}
+}
+
+func decodeCollection(resp *http.Response, action string) (*Collection, error) {
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("failed to %s: %s", action, readErrorMessage(resp))
+	}
+
+	var collection Collection
+	if err := json.NewDecoder(resp.Body).Decode(&collection); err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+func (cr *CollectionRepository) Create(name string) (*Collection, error) {
+	body, err := json.Marshal(api.CreateCollectionRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cr.userManager.DoAuthenticatedRequest("POST", "/collections", body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeCollection(resp, "create the list")
+}
+
+// GetAll returns the collections owned by the user or subscribed to.
+func (cr *CollectionRepository) GetAll() ([]Collection, error) {
+	resp, err := cr.userManager.DoAuthenticatedRequest("GET", "/collections", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get the lists: %s", readErrorMessage(resp))
+	}
+
+	var collections []Collection
+	if err := json.NewDecoder(resp.Body).Decode(&collections); err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
+
+// AddAddon adds the addon to the collection, or updates it if the collection already has it.
+func (cr *CollectionRepository) AddAddon(collectionId string, addon AddonReference) (*Collection, error) {
+	body, err := json.Marshal(api.AddCollectionAddonRequest{
+		GameVersion: addon.GameVersion,
+		Slug:        addon.Slug,
+		Name:        addon.Name,
+		Author:      addon.Author,
+		Provider:    addon.Provider,
+		ExternalId:  addon.ExternalId,
+		Url:         addon.Url,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cr.userManager.DoAuthenticatedRequest("POST", "/collections/"+url.PathEscape(collectionId)+"/addons", body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeCollection(resp, "add the addon")
+}
+
+// Share returns the collection with its share code, creating the code the first time.
+func (cr *CollectionRepository) Share(collectionId string) (*Collection, error) {
+	resp, err := cr.userManager.DoAuthenticatedRequest("POST", "/collections/"+url.PathEscape(collectionId)+"/share", nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeCollection(resp, "share the list")
+}
+
+// Unshare removes the share code of the collection, so its link stops working.
+func (cr *CollectionRepository) Unshare(collectionId string) (*Collection, error) {
+	resp, err := cr.userManager.DoAuthenticatedRequest("DELETE", "/collections/"+url.PathEscape(collectionId)+"/share", nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeCollection(resp, "stop sharing the list")
+}
+
+// GetShared returns a shared collection, which does not require to be signed in.
+func (cr *CollectionRepository) GetShared(shareCode string) (*Collection, error) {
+	resp, err := http.Get(cr.GetShareLink(shareCode))
+	if err != nil {
+		return nil, err
+	}
+	return decodeCollection(resp, "get the shared list")
+}
+
+// Subscribe adds a shared collection to the lists of the user, and returns it.
+func (cr *CollectionRepository) Subscribe(shareCode string) (*Collection, error) {
+	resp, err := cr.userManager.DoAuthenticatedRequest("POST", "/shared/collections/"+url.PathEscape(shareCode)+"/subscribe", nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeCollection(resp, "subscribe to the list")
+}
+
+func (cr *CollectionRepository) GetShareLink(shareCode string) string {
+	return fmt.Sprintf("%s/shared/collections/%s", cr.userManager.apiUrl, url.PathEscape(shareCode))
+}
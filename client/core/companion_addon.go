@@ -0,0 +1,236 @@
+package core
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+//go:embed templates/companion/*.tmpl
+var companionTemplatesFS embed.FS
+
+var companionTemplates = template.Must(
+	template.New("companion").
+		Funcs(template.FuncMap{"luaString": luaLongString}).
+		ParseFS(companionTemplatesFS, "templates/companion/*.tmpl"),
+)
+
+// The ## Interface number of the client build each flavor is currently on.
+var companionInterfaceVersions = map[GameVersion]string{
+	Retail:  "110007",
+	Classic: "11505",
+}
+
+type companionTemplateData struct {
+	Version   string
+	Interface string
+	WeakAuras []WeakAuraUpdate
+}
+
+// luaLongString quotes value as a Lua long bracket string, picking the lowest
+// level whose closing bracket does not show up inside the value.
+func luaLongString(value string) string {
+	// Lua reads any line break of a long string as "\n", so a carriage return would be lost.
+	if strings.Contains(value, "\r") {
+		return luaQuotedString(value)
+	}
+	// Lua skips a newline right after the opening bracket, so keep the original one.
+	if strings.HasPrefix(value, "\n") {
+		value = "\n" + value
+	}
+
+	level := 0
+	for {
+		equals := strings.Repeat("=", level)
+		closing := "]" + equals + "]"
+		// The value followed by the closing bracket must not close it earlier,
+		// which also covers values ending with "]" or "]=".
+		if strings.Index(value+closing, closing) == len(value) {
+			return "[" + equals + "[" + value + closing
+		}
+		level++
+	}
+}
+
+// luaQuotedString quotes value as a Lua string with escapes, for the values a long string cannot hold.
+func luaQuotedString(value string) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '"' || c == '\\':
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case c == '\n':
+			builder.WriteString(`\n`)
+		case c == '\r':
+			builder.WriteString(`\r`)
+		case c < 0x20 || c == 0x7f:
+			// Three digits, so a digit that follows is not read as part of the escape
+			fmt.Fprintf(&builder, "\\%03d", c)
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
+
+func renderCompanionTemplate(name string, data companionTemplateData) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := companionTemplates.ExecuteTemplate(&buffer, name, data); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// parseCompanionData runs a generated Data.lua and reads back its weak auras.
+func parseCompanionData(dataLua []byte) ([]WeakAuraUpdate, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+
+	if err := L.DoString(string(dataLua)); err != nil {
+		return nil, err
+	}
+
+	companionData, ok := L.GetGlobal("WowaCompanionData").(*lua.LTable)
+	if !ok {
+		return nil, errors.New("WowaCompanionData is not a valid Lua table")
+	}
+	weakAurasData, ok := companionData.RawGetString("WeakAuras").(*lua.LTable)
+	if !ok {
+		return nil, errors.New("WowaCompanionData.WeakAuras is not a valid Lua table")
+	}
+	slugs, ok := weakAurasData.RawGetString("slugs").(*lua.LTable)
+	if !ok {
+		return nil, errors.New("WowaCompanionData.WeakAuras.slugs is not a valid Lua table")
+	}
+
+	var updates []WeakAuraUpdate
+	var parseErr error
+	slugs.ForEach(func(key lua.LValue, value lua.LValue) {
+		if parseErr != nil {
+			return
+		}
+		entry, ok := value.(*lua.LTable)
+		if !ok {
+			parseErr = fmt.Errorf("weak aura %s is not a valid Lua table", key.String())
+			return
+		}
+		wagoVersion, err := strconv.Atoi(entry.RawGetString("wagoVersion").String())
+		if err != nil {
+			parseErr = fmt.Errorf("weak aura %s has an invalid wagoVersion", key.String())
+			return
+		}
+		updates = append(updates, WeakAuraUpdate{
+			Slug:        key.String(),
+			Name:        entry.RawGetString("name").String(),
+			Author:      entry.RawGetString("author").String(),
+			WagoVersion: wagoVersion,
+			WagoSemver:  entry.RawGetString("wagoSemver").String(),
+			Encoded:     entry.RawGetString("encoded").String(),
+		})
+	})
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	return updates, nil
+}
+
+// validateCompanionData checks that every weak aura reads back unchanged from the generated Data.lua.
+func validateCompanionData(dataLua []byte, updates []WeakAuraUpdate) error {
+	parsedUpdates, err := parseCompanionData(dataLua)
+	if err != nil {
+		return err
+	}
+	if len(parsedUpdates) != len(updates) {
+		return fmt.Errorf("expected %d weak auras, found %d", len(updates), len(parsedUpdates))
+	}
+
+	for _, update := range updates {
+		var parsedUpdate *WeakAuraUpdate
+		for i := range parsedUpdates {
+			if parsedUpdates[i].Slug == update.Slug {
+				parsedUpdate = &parsedUpdates[i]
+				break
+			}
+		}
+		if parsedUpdate == nil {
+			return fmt.Errorf("weak aura %s is missing", update.Slug)
+		}
+		if *parsedUpdate != update {
+			return fmt.Errorf("weak aura %s does not match the generated data", update.Slug)
+		}
+	}
+
+	return nil
+}
+
+// readCompanionAddon returns the weak auras offered by the installed companion addon, if any.
+func readCompanionAddon(addonFolder string) ([]WeakAuraUpdate, error) {
+	dataLua, err := os.ReadFile(filepath.Join(addonFolder, "Data.lua"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseCompanionData(dataLua)
+}
+
+func writeCompanionAddon(addonFolder string, gameVersion GameVersion, version string, updates []WeakAuraUpdate) error {
+	data := companionTemplateData{
+		Version:   version,
+		Interface: companionInterfaceVersions[gameVersion],
+		WeakAuras: updates,
+	}
+
+	dataLua, err := renderCompanionTemplate("Data.lua.tmpl", data)
+	if err != nil {
+		return err
+	}
+	if err := validateCompanionData(dataLua, updates); err != nil {
+		return fmt.Errorf("generated companion data is invalid: %w", err)
+	}
+
+	companionLua, err := renderCompanionTemplate("WowaCompanion.lua.tmpl", data)
+	if err != nil {
+		return err
+	}
+	if _, err := parse.Parse(bytes.NewReader(companionLua), "WowaCompanion.lua"); err != nil {
+		return fmt.Errorf("generated companion addon is invalid: %w", err)
+	}
+
+	toc, err := renderCompanionTemplate("WowaCompanion.toc.tmpl", data)
+	if err != nil {
+		return err
+	}
+
+	// Create the addon directory
+	if err := os.MkdirAll(addonFolder, os.ModePerm); err != nil {
+		return err
+	}
+
+	files := map[string][]byte{
+		"Data.lua":          dataLua,
+		"WowaCompanion.lua": companionLua,
+		"WowaCompanion.toc": toc,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(addonFolder, name), content, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
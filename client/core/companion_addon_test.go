@@ -0,0 +1,97 @@
+package core
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestLuaLongString(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"a plain value", "abc", "[[abc]]"},
+		{"an empty value", "", "[[]]"},
+		{"a closing bracket", "a]]b", "[=[a]]b]=]"},
+		{"closing brackets of several levels", "a]]b]=]c", "[==[a]]b]=]c]==]"},
+		{"a value ending with a bracket", "a]", "[=[a]]=]"},
+		{"a value ending with a bracket and equals", "a]=", "[[a]=]]"},
+		{"a value ending with a closing bracket of the next level", "a]=]", "[==[a]=]]==]"},
+		{"an opening bracket only", "[[a", "[[[[a]]"},
+		{"a leading newline", "\nabc", "[[\n\nabc]]"},
+		{"a carriage return", "a\r\nb", `"a\r\nb"`},
+		{"a carriage return with quotes and control characters", "\"a\\\r\x001", `"\"a\\\r\0001"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quoted := luaLongString(test.value)
+			if quoted != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, quoted)
+			}
+
+			// Lua reads the value back unchanged
+			L := lua.NewState(lua.Options{SkipOpenLibs: true})
+			defer L.Close()
+			if err := L.DoString("value = " + quoted); err != nil {
+				t.Fatal(err)
+			}
+			if value := L.GetGlobal("value").String(); value != test.value {
+				t.Fatalf("expected Lua to read %q, got %q", test.value, value)
+			}
+		})
+	}
+}
+
+func TestCompanionDataRoundTrip(t *testing.T) {
+	updates := []WeakAuraUpdate{
+		{Slug: "plain", Name: "Plain", Author: "someone", WagoVersion: 3, WagoSemver: "1.0.2", Encoded: "!WA:2!abc"},
+		{Slug: "brackets", Name: "Name with ]] and \"quotes\"", Author: "]=]", WagoVersion: 12, WagoSemver: "2.0.0", Encoded: "!WA:2!a]]b]=]c"},
+		{Slug: "newline", Name: "\nLeading newline", Author: "someone\r\nelse", WagoVersion: 1, WagoSemver: "0.1.0", Encoded: "line\nbreak"},
+	}
+
+	dataLua, err := renderCompanionTemplate("Data.lua.tmpl", companionTemplateData{Version: "1.0.0", Interface: companionInterfaceVersions[Retail], WeakAuras: updates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateCompanionData(dataLua, updates); err != nil {
+		t.Fatal(err)
+	}
+
+	parsedUpdates, err := parseCompanionData(dataLua)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsedUpdates) != len(updates) {
+		t.Fatalf("expected %d weak auras, got %d", len(updates), len(parsedUpdates))
+	}
+
+	// The validation fails when the data does not match the weak auras
+	changed := append([]WeakAuraUpdate{}, updates...)
+	changed[0].Encoded = "!WA:2!other"
+	if err := validateCompanionData(dataLua, changed); err == nil {
+		t.Fatal("expected a changed weak aura to fail the validation")
+	}
+	if err := validateCompanionData(dataLua, updates[:2]); err == nil {
+		t.Fatal("expected a missing weak aura to fail the validation")
+	}
+}
+
+func TestParseCompanionDataRejectsInvalidData(t *testing.T) {
+	tests := map[string]string{
+		"invalid Lua":             "WowaCompanionData = {",
+		"a missing table":         "WowaCompanionData = nil",
+		"missing weak auras":      "WowaCompanionData = {}",
+		"an invalid entry":        `WowaCompanionData = {WeakAuras = {slugs = {plain = "abc"}}}`,
+		"an invalid version":      `WowaCompanionData = {WeakAuras = {slugs = {plain = {wagoVersion = "abc"}}}}`,
+		"missing weak aura slugs": "WowaCompanionData = {WeakAuras = {}}",
+	}
+	for name, dataLua := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseCompanionData([]byte(dataLua)); err == nil {
+				t.Fatal("expected the data to be rejected")
+			}
+		})
+	}
+}
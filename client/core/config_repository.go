@@ -5,8 +5,16 @@ type Config string
 const (
 	CurseToken  Config = "curse.token"
 	GithubToken Config = "github.token"
+	WagoToken   Config = "wago.token"
 	GameDir     Config = "game.dir"
 	AuthToken   Config = "auth.token"
+
+	AuthRefreshToken Config = "auth.refresh-token"
+	// Set when logging in, by registering this machine as a device
+	DeviceId Config = "device.id"
+
+	BackupDir       Config = "backup.dir"
+	BackupRetention Config = "backup.retention"
 )
 
 type ConfigRepository struct {
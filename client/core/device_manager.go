@@ -0,0 +1,106 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"runtime"
+	"sort"
+)
+
+type DeviceManager struct {
+	deviceRepository     *DeviceRepository
+	localAddonRepository *LocalAddonRepository
+	configRepository     *ConfigRepository
+	kvStore              *KeyValueStore
+}
+
+func NewDeviceManager(deviceRepository *DeviceRepository, localAddonRepository *LocalAddonRepository, configRepository *ConfigRepository, kvStore *KeyValueStore) *DeviceManager {
+	return &DeviceManager{deviceRepository: deviceRepository, localAddonRepository: localAddonRepository, configRepository: configRepository, kvStore: kvStore}
+}
+
+// The fingerprint of the last reported addons, so unchanged addons are not reported again
+var reportedAddonsKey = []string{"devices", "reported-addons"}
+
+// GetCurrentDeviceId returns the ID of this device, empty when it is not registered.
+func (dm *DeviceManager) GetCurrentDeviceId() (string, error) {
+	return dm.configRepository.Get(DeviceId)
+}
+
+// Register registers this device under the given name, the hostname when empty, then reports its addons.
+func (dm *DeviceManager) Register(name string) (*Device, error) {
+	if name == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		name = hostname
+	}
+
+	device, err := dm.deviceRepository.Register(name, runtime.GOOS)
+	if err != nil {
+		return nil, err
+	}
+	if err := dm.configRepository.Set(DeviceId, &device.Id); err != nil {
+		return nil, err
+	}
+	// The device may have been registered by another account before
+	if err := dm.kvStore.Set(reportedAddonsKey, nil); err != nil {
+		return nil, err
+	}
+
+	return device, dm.ReportInstalledAddons()
+}
+
+// Forget unregisters this device locally, on logout, so another account does not report to it.
+func (dm *DeviceManager) Forget() error {
+	if err := dm.configRepository.Set(DeviceId, nil); err != nil {
+		return err
+	}
+	return dm.kvStore.Set(reportedAddonsKey, nil)
+}
+
+func (dm *DeviceManager) GetAll() ([]Device, error) {
+	return dm.deviceRepository.GetAll()
+}
+
+// ReportInstalledAddons sends the addons installed here to the server, when they changed since the last report.
+// It does nothing when this device is not registered.
+func (dm *DeviceManager) ReportInstalledAddons() error {
+	deviceId, err := dm.GetCurrentDeviceId()
+	if err != nil || deviceId == "" {
+		return err
+	}
+
+	localAddons, err := dm.localAddonRepository.GetAll(nil)
+	if err != nil {
+		return err
+	}
+	addons := []DeviceAddonReport{}
+	for _, localAddon := range localAddons {
+		addons = append(addons, DeviceAddonReport{GameVersion: localAddon.GameVersion, Slug: localAddon.Slug, Version: localAddon.Version})
+	}
+	sort.Slice(addons, func(i, j int) bool {
+		if addons[i].GameVersion != addons[j].GameVersion {
+			return addons[i].GameVersion > addons[j].GameVersion
+		}
+		return addons[i].Slug < addons[j].Slug
+	})
+
+	data, err := json.Marshal(addons)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(append([]byte(deviceId), data...))
+	fingerprint := hex.EncodeToString(hash[:])
+	reportedFingerprint, err := dm.kvStore.Get(reportedAddonsKey)
+	if err != nil || reportedFingerprint == fingerprint {
+		return err
+	}
+
+	if _, err := dm.deviceRepository.ReportAddons(deviceId, addons); err != nil {
+		return err
+	}
+	return dm.kvStore.Set(reportedAddonsKey, &fingerprint)
+}
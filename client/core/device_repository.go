@@ -0,0 +1,89 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"wowa-api"
+)
+
+// The devices as sent and returned by the server
+type (
+	Device            = api.Device
+	DeviceAddon       = api.DeviceAddon
+	DeviceAddonReport = api.DeviceAddonReport
+)
+
+type DeviceRepository struct {
+	userManager *UserManager
+}
+
+func NewDeviceRepository(userManager *UserManager) *DeviceRepository {
+	return &DeviceRepository{userManager: userManager}
+}
+
+func decodeDevice(resp *http.Response, action string) (*Device, error) {
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("failed to %s: %s", action, readErrorMessage(resp))
+	}
+
+	var device Device
+	if err := json.NewDecoder(resp.Body).Decode(&device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// Register registers the device by its name, or returns the device already registered with that name.
+func (dr *DeviceRepository) Register(name string, platform string) (*Device, error) {
+	body, err := json.Marshal(api.RegisterDeviceRequest{Name: name, Platform: platform})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := dr.userManager.DoAuthenticatedRequest("POST", "/devices", body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDevice(resp, "register the device")
+}
+
+// GetAll returns the devices of the user, with the addons installed on each of them.
+func (dr *DeviceRepository) GetAll() ([]Device, error) {
+	resp, err := dr.userManager.DoAuthenticatedRequest("GET", "/devices", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get the devices: %s", readErrorMessage(resp))
+	}
+
+	var devices []Device
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// ReportAddons replaces the addons installed on the device with the given ones.
+func (dr *DeviceRepository) ReportAddons(deviceId string, addons []DeviceAddonReport) (*Device, error) {
+	body, err := json.Marshal(api.ReportDeviceAddonsRequest{Addons: addons})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := dr.userManager.DoAuthenticatedRequest("PUT", "/devices/"+url.PathEscape(deviceId)+"/addons", body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDevice(resp, "report the installed addons")
+}
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// getGameVersionFolder returns the folder of the given flavor inside the configured game dir.
+func getGameVersionFolder(configRepository *ConfigRepository, gameVersion GameVersion) (string, error) {
+	gameDir, err := configRepository.Get(GameDir)
+	if err != nil {
+		return "", err
+	}
+	if gameDir == "" {
+		return "", errors.New("game dir is not defined")
+	}
+
+	var versionFolder string
+	if gameVersion == "classic" {
+		versionFolder = "_classic_era_"
+	} else {
+		versionFolder = "_retail_"
+	}
+
+	return filepath.Join(gameDir, versionFolder), nil
+}
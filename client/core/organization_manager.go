@@ -0,0 +1,185 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type OrganizationManager struct {
+	organizationRepository *OrganizationRepository
+	localAddonRepository   *LocalAddonRepository
+	addonSearcher          *AddonSearcher
+	configRepository       *ConfigRepository
+}
+
+func NewOrganizationManager(organizationRepository *OrganizationRepository, localAddonRepository *LocalAddonRepository, addonSearcher *AddonSearcher, configRepository *ConfigRepository) *OrganizationManager {
+	return &OrganizationManager{organizationRepository: organizationRepository, localAddonRepository: localAddonRepository, addonSearcher: addonSearcher, configRepository: configRepository}
+}
+
+// Find returns the organization with the given ID or name, with its members.
+func (om *OrganizationManager) Find(idOrName string) (*Organization, error) {
+	organizations, err := om.organizationRepository.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Organization
+	for i, organization := range organizations {
+		if organization.Id == idOrName {
+			found = &organizations[i]
+			break
+		}
+		if strings.EqualFold(organization.Name, idOrName) {
+			if found != nil {
+				return nil, fmt.Errorf("several organizations are named %s, use the organization ID instead", idOrName)
+			}
+			found = &organizations[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("organization %s not found", idOrName)
+	}
+	return om.organizationRepository.Get(found.Id)
+}
+
+func (om *OrganizationManager) Create(name string) (*Organization, error) {
+	return om.organizationRepository.Create(name)
+}
+
+func (om *OrganizationManager) GetAll() ([]Organization, error) {
+	return om.organizationRepository.GetAll()
+}
+
+// IsMember reports whether the email is a member of the organization, which must have its members.
+func (om *OrganizationManager) IsMember(organization *Organization, email string) bool {
+	for _, member := range organization.Members {
+		if strings.EqualFold(member.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (om *OrganizationManager) SaveMember(organization *Organization, email string, role OrganizationRole) (*OrganizationMember, error) {
+	return om.organizationRepository.SaveMember(organization.Id, email, role)
+}
+
+// Invite invites the email to join the organization, who only becomes a member once they accept.
+func (om *OrganizationManager) Invite(organization *Organization, email string, role OrganizationRole) (*OrganizationInvitation, error) {
+	return om.organizationRepository.Invite(organization.Id, email, role)
+}
+
+func (om *OrganizationManager) GetInvitations(organization *Organization) ([]OrganizationInvitation, error) {
+	return om.organizationRepository.GetInvitations(organization.Id)
+}
+
+// RemoveMember removes the member with the email from the organization, or cancels the invitation of the email.
+func (om *OrganizationManager) RemoveMember(organization *Organization, email string) error {
+	for _, member := range organization.Members {
+		if strings.EqualFold(member.Email, email) {
+			return om.organizationRepository.RemoveMember(organization.Id, member.UserId)
+		}
+	}
+
+	if organization.Role != OrganizationRoleMember {
+		invitations, err := om.organizationRepository.GetInvitations(organization.Id)
+		if err != nil {
+			return err
+		}
+		for _, invitation := range invitations {
+			if strings.EqualFold(invitation.Email, email) {
+				return om.organizationRepository.CancelInvitation(organization.Id, invitation.Id)
+			}
+		}
+	}
+	return fmt.Errorf("%s is neither a member of %s nor invited", email, organization.Name)
+}
+
+func (om *OrganizationManager) GetMyInvitations() ([]OrganizationInvitation, error) {
+	return om.organizationRepository.GetMyInvitations()
+}
+
+// FindInvitation returns the invitation of the user with the given ID or organization name.
+func (om *OrganizationManager) FindInvitation(idOrName string) (*OrganizationInvitation, error) {
+	invitations, err := om.organizationRepository.GetMyInvitations()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *OrganizationInvitation
+	for i, invitation := range invitations {
+		if invitation.Id == idOrName {
+			return &invitations[i], nil
+		}
+		if strings.EqualFold(invitation.OrganizationName, idOrName) {
+			if found != nil {
+				return nil, fmt.Errorf("you are invited to several organizations named %s, use the invitation ID instead", idOrName)
+			}
+			found = &invitations[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no invitation to %s found", idOrName)
+	}
+	return found, nil
+}
+
+func (om *OrganizationManager) AcceptInvitation(invitation *OrganizationInvitation, code string) (*Organization, error) {
+	return om.organizationRepository.AcceptInvitation(invitation.Id, code)
+}
+
+func (om *OrganizationManager) DeclineInvitation(invitation *OrganizationInvitation) error {
+	return om.organizationRepository.DeclineInvitation(invitation.Id)
+}
+
+// SetAddon adds an installed addon by its ID, or any addon by its URL, to the organization.
+func (om *OrganizationManager) SetAddon(organization *Organization, idOrUrl string, gameVersion GameVersion, requirement AddonRequirement) (*OrganizationAddon, error) {
+	addon, err := resolveAddonReference(om.localAddonRepository, om.addonSearcher, idOrUrl, gameVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	organizationAddon := OrganizationAddon{AddonReference: addon, Requirement: requirement}
+	if err := om.organizationRepository.SaveAddon(organization.Id, organizationAddon); err != nil {
+		return nil, err
+	}
+	return &organizationAddon, nil
+}
+
+func (om *OrganizationManager) RemoveAddon(organization *Organization, slug string, gameVersion GameVersion) error {
+	return om.organizationRepository.RemoveAddon(organization.Id, slug, gameVersion)
+}
+
+func (om *OrganizationManager) GetCompliance(organization *Organization) (*OrganizationCompliance, error) {
+	return om.organizationRepository.GetCompliance(organization.Id)
+}
+
+// GetRequiredAddons returns the addons required by the organizations, for the game versions installed here.
+// An addon required by several organizations is only returned once, for the first of them.
+func (om *OrganizationManager) GetRequiredAddons(organizations []Organization) []OrganizationAddon {
+	installedGameVersions := make(map[GameVersion]bool)
+	for _, gameVersion := range []GameVersion{Retail, Classic} {
+		folder, err := getGameVersionFolder(om.configRepository, gameVersion)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(folder); err == nil {
+			installedGameVersions[gameVersion] = true
+		}
+	}
+
+	var requiredAddons []OrganizationAddon
+	seen := make(map[syncKey]bool)
+	for _, organization := range organizations {
+		for _, addon := range organization.Addons {
+			key := syncKey{addon.GameVersion, addon.Slug}
+			if addon.Requirement != AddonRequirementRequired || !installedGameVersions[addon.GameVersion] || seen[key] {
+				continue
+			}
+			seen[key] = true
+			requiredAddons = append(requiredAddons, addon)
+		}
+	}
+	return requiredAddons
+}
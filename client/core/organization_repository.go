@@ -0,0 +1,200 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"wowa-api"
+)
+
+// The organizations as returned by the server
+type (
+	OrganizationRole       = api.OrganizationRole
+	AddonRequirement       = api.AddonRequirement
+	OrganizationAddon      = api.OrganizationAddon
+	OrganizationMember     = api.OrganizationMember
+	OrganizationInvitation = api.OrganizationInvitation
+	Organization           = api.Organization
+	AddonComplianceStatus  = api.ComplianceStatus
+	AddonCompliance        = api.AddonCompliance
+	MemberCompliance       = api.MemberCompliance
+	OrganizationCompliance = api.OrganizationCompliance
+)
+
+const (
+	OrganizationRoleOwner   = api.RoleOwner
+	OrganizationRoleOfficer = api.RoleOfficer
+	OrganizationRoleMember  = api.RoleMember
+
+	// Required addons are installed by `wowa update` and checked by the compliance report
+	AddonRequirementRequired    = api.RequirementRequired
+	AddonRequirementRecommended = api.RequirementRecommended
+
+	AddonComplianceOk          = api.ComplianceOk
+	AddonComplianceMissing     = api.ComplianceMissing
+	AddonComplianceWrongSource = api.ComplianceWrongSource
+	AddonComplianceOutdated    = api.ComplianceOutdated
+)
+
+type OrganizationRepository struct {
+	userManager *UserManager
+}
+
+func NewOrganizationRepository(userManager *UserManager) *OrganizationRepository {
+	return &OrganizationRepository{userManager: userManager}
+}
+
+func organizationPath(organizationId string) string {
+	return "/orgs/" + url.PathEscape(organizationId)
+}
+
+// doJsonRequest sends an authenticated request, then decodes the JSON response into result when it is not nil.
+func (or *OrganizationRepository) doJsonRequest(method string, path string, payload interface{}, result interface{}, action string) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := or.userManager.DoAuthenticatedRequest(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to %s: %s", action, readErrorMessage(resp))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (or *OrganizationRepository) Create(name string) (*Organization, error) {
+	var organization Organization
+	err := or.doJsonRequest("POST", "/orgs", api.CreateOrganizationRequest{Name: name}, &organization, "create the organization")
+	if err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+// GetAll returns the organizations of the user with their addons, but without their members.
+func (or *OrganizationRepository) GetAll() ([]Organization, error) {
+	var organizations []Organization
+	err := or.doJsonRequest("GET", "/orgs", nil, &organizations, "get the organizations")
+	if err != nil {
+		return nil, err
+	}
+	return organizations, nil
+}
+
+func (or *OrganizationRepository) Get(organizationId string) (*Organization, error) {
+	var organization Organization
+	err := or.doJsonRequest("GET", organizationPath(organizationId), nil, &organization, "get the organization")
+	if err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+// SaveMember changes the role of a member of the organization, by email.
+func (or *OrganizationRepository) SaveMember(organizationId string, email string, role OrganizationRole) (*OrganizationMember, error) {
+	var member OrganizationMember
+	payload := api.SaveOrganizationMemberRequest{Email: email, Role: role}
+	err := or.doJsonRequest("POST", organizationPath(organizationId)+"/members", payload, &member, "save the member")
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// Invite invites an email to join the organization, or changes the role of its invitation.
+func (or *OrganizationRepository) Invite(organizationId string, email string, role OrganizationRole) (*OrganizationInvitation, error) {
+	var invitation OrganizationInvitation
+	payload := api.InviteOrganizationMemberRequest{Email: email, Role: role}
+	err := or.doJsonRequest("POST", organizationPath(organizationId)+"/invitations", payload, &invitation, "invite the member")
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// GetInvitations returns the pending invitations of the organization, only available to officers.
+func (or *OrganizationRepository) GetInvitations(organizationId string) ([]OrganizationInvitation, error) {
+	var invitations []OrganizationInvitation
+	err := or.doJsonRequest("GET", organizationPath(organizationId)+"/invitations", nil, &invitations, "get the invitations")
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (or *OrganizationRepository) CancelInvitation(organizationId string, invitationId string) error {
+	return or.doJsonRequest("DELETE", organizationPath(organizationId)+"/invitations/"+url.PathEscape(invitationId), nil, nil, "cancel the invitation")
+}
+
+// GetMyInvitations returns the invitations sent to the email of the user.
+func (or *OrganizationRepository) GetMyInvitations() ([]OrganizationInvitation, error) {
+	var invitations []OrganizationInvitation
+	err := or.doJsonRequest("GET", "/invitations", nil, &invitations, "get your invitations")
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// AcceptInvitation joins the organization of the invitation with the code mailed with it, and returns it.
+func (or *OrganizationRepository) AcceptInvitation(invitationId string, code string) (*Organization, error) {
+	var organization Organization
+	payload := api.AcceptInvitationRequest{Token: code}
+	err := or.doJsonRequest("POST", "/invitations/"+url.PathEscape(invitationId)+"/accept", payload, &organization, "accept the invitation")
+	if err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func (or *OrganizationRepository) DeclineInvitation(invitationId string) error {
+	return or.doJsonRequest("DELETE", "/invitations/"+url.PathEscape(invitationId), nil, nil, "decline the invitation")
+}
+
+func (or *OrganizationRepository) RemoveMember(organizationId string, userId string) error {
+	return or.doJsonRequest("DELETE", organizationPath(organizationId)+"/members/"+url.PathEscape(userId), nil, nil, "remove the member")
+}
+
+// SaveAddon adds the addon to the organization, or changes its requirement.
+func (or *OrganizationRepository) SaveAddon(organizationId string, addon OrganizationAddon) error {
+	payload := api.PutOrganizationAddonRequest{
+		Name:        addon.Name,
+		Author:      addon.Author,
+		Provider:    addon.Provider,
+		ExternalId:  addon.ExternalId,
+		Url:         addon.Url,
+		Requirement: addon.Requirement,
+	}
+	path := fmt.Sprintf("%s/addons/%s/%s", organizationPath(organizationId), addon.GameVersion, url.PathEscape(addon.Slug))
+	return or.doJsonRequest("PUT", path, payload, nil, "save the addon")
+}
+
+func (or *OrganizationRepository) RemoveAddon(organizationId string, slug string, gameVersion GameVersion) error {
+	path := fmt.Sprintf("%s/addons/%s/%s", organizationPath(organizationId), gameVersion, url.PathEscape(slug))
+	return or.doJsonRequest("DELETE", path, nil, nil, "remove the addon")
+}
+
+// GetCompliance returns the required addons installed by each member, only available to officers.
+func (or *OrganizationRepository) GetCompliance(organizationId string) (*OrganizationCompliance, error) {
+	var compliance OrganizationCompliance
+	err := or.doJsonRequest("GET", organizationPath(organizationId)+"/compliance", nil, &compliance, "get the compliance report")
+	if err != nil {
+		return nil, err
+	}
+	return &compliance, nil
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"wowa-api"
+)
+
+// The number of addons the server resolves in one request
+const providerResolveBatchSize = 100
+
+// ProviderRepository asks the wowa server for the latest releases of the addons, resolved with its
+// provider keys and its cache. Servers without provider keys answer with a not_found error.
+type ProviderRepository struct {
+	userManager *UserManager
+}
+
+func NewProviderRepository(userManager *UserManager) *ProviderRepository {
+	return &ProviderRepository{userManager: userManager}
+}
+
+// Resolve returns the resolution of every lookup, in the same order.
+func (pr *ProviderRepository) Resolve(lookups []api.AddonLookup) ([]api.AddonResolution, error) {
+	resolutions := make([]api.AddonResolution, 0, len(lookups))
+	for start := 0; start < len(lookups); start += providerResolveBatchSize {
+		batch := lookups[start:min(start+providerResolveBatchSize, len(lookups))]
+		resolved, err := pr.resolveBatch(batch)
+		if err != nil {
+			return nil, err
+		}
+		resolutions = append(resolutions, resolved...)
+	}
+	return resolutions, nil
+}
+
+func (pr *ProviderRepository) resolveBatch(lookups []api.AddonLookup) ([]api.AddonResolution, error) {
+	body, err := json.Marshal(api.ResolveAddonsRequest{Addons: lookups})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := pr.userManager.DoAuthenticatedRequest("POST", "/providers/resolve", body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to resolve addons: %w", readAPIError(resp))
+	}
+
+	var resolveResponse api.ResolveAddonsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&resolveResponse); err != nil {
+		return nil, err
+	}
+	if len(resolveResponse.Addons) != len(lookups) {
+		return nil, fmt.Errorf("failed to resolve addons: %d resolutions for %d addons", len(resolveResponse.Addons), len(lookups))
+	}
+	return resolveResponse.Addons, nil
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type SavedVariablesScope string
+
+const (
+	SavedVariablesScopeAccount   SavedVariablesScope = "account"
+	SavedVariablesScopeCharacter SavedVariablesScope = "character"
+)
+
+type SavedVariablesFile struct {
+	// Path relative to the WTF folder
+	Path  string
+	Addon string
+	Scope SavedVariablesScope
+	Size  int64
+}
+
+type SavedVariablesManager struct {
+	configRepository *ConfigRepository
+	backupManager    *BackupManager
+}
+
+func NewSavedVariablesManager(configRepository *ConfigRepository, backupManager *BackupManager) *SavedVariablesManager {
+	return &SavedVariablesManager{configRepository: configRepository, backupManager: backupManager}
+}
+
+// parseTocSavedVariables returns whether the TOC declares account and per character saved variables.
+func (svm *SavedVariablesManager) parseTocSavedVariables(tocPath string) (bool, bool, error) {
+	file, err := os.Open(tocPath)
+	if err != nil {
+		return false, false, err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	account, character := false, false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "##") {
+			continue
+		}
+		tag, value, found := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "##")), ":")
+		if !found || strings.TrimSpace(value) == "" {
+			continue
+		}
+		switch strings.TrimSpace(tag) {
+		case "SavedVariables":
+			account = true
+		case "SavedVariablesPerCharacter":
+			character = true
+		}
+	}
+
+	return account, character, scanner.Err()
+}
+
+// getDeclaredSavedVariables returns the installed addons that declare saved variables for each scope.
+func (svm *SavedVariablesManager) getDeclaredSavedVariables(gameVersionFolder string) (map[SavedVariablesScope]map[string]bool, error) {
+	declared := map[SavedVariablesScope]map[string]bool{
+		SavedVariablesScopeAccount:   {},
+		SavedVariablesScopeCharacter: {},
+	}
+
+	addonsFolder := filepath.Join(gameVersionFolder, "Interface", "AddOns")
+	addonFolders, err := os.ReadDir(addonsFolder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return declared, nil
+		}
+		return nil, err
+	}
+
+	for _, addonFolder := range addonFolders {
+		if !addonFolder.IsDir() {
+			continue
+		}
+
+		// Addons can ship a TOC per flavor, like Addon_Mainline.toc or Addon-Classic.toc
+		tocPaths, err := filepath.Glob(filepath.Join(addonsFolder, addonFolder.Name(), "*.toc"))
+		if err != nil {
+			return nil, err
+		}
+		for _, tocPath := range tocPaths {
+			account, character, err := svm.parseTocSavedVariables(tocPath)
+			if err != nil {
+				return nil, err
+			}
+			if account {
+				declared[SavedVariablesScopeAccount][addonFolder.Name()] = true
+			}
+			if character {
+				declared[SavedVariablesScopeCharacter][addonFolder.Name()] = true
+			}
+		}
+	}
+
+	return declared, nil
+}
+
+// FindOrphans returns the SavedVariables files that no installed TOC declares.
+// When addons is not nil, only the files of those addon directories are returned.
+func (svm *SavedVariablesManager) FindOrphans(gameVersion GameVersion, addons []string) ([]SavedVariablesFile, error) {
+	gameVersionFolder, err := getGameVersionFolder(svm.configRepository, gameVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	declared, err := svm.getDeclaredSavedVariables(gameVersionFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	var onlyAddons map[string]bool
+	if addons != nil {
+		onlyAddons = make(map[string]bool)
+		for _, addon := range addons {
+			onlyAddons[addon] = true
+		}
+	}
+
+	wtfFolder := filepath.Join(gameVersionFolder, "WTF")
+	accountsFolder := filepath.Join(wtfFolder, "Account")
+	if _, err := os.Stat(accountsFolder); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var orphans []SavedVariablesFile
+	err = filepath.Walk(accountsFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(wtfFolder, path)
+		if err != nil {
+			return err
+		}
+
+		// Account/<account>/SavedVariables/<addon>.lua
+		// Account/<account>/<realm>/<character>/SavedVariables/<addon>.lua
+		parts := strings.Split(filepath.ToSlash(relativePath), "/")
+		if parts[len(parts)-2] != "SavedVariables" {
+			return nil
+		}
+		var scope SavedVariablesScope
+		switch len(parts) {
+		case 4:
+			scope = SavedVariablesScopeAccount
+		case 6:
+			scope = SavedVariablesScopeCharacter
+		default:
+			return nil
+		}
+
+		fileName := parts[len(parts)-1]
+		var addon string
+		if strings.HasSuffix(fileName, ".lua") {
+			addon = strings.TrimSuffix(fileName, ".lua")
+		} else if strings.HasSuffix(fileName, ".lua.bak") {
+			addon = strings.TrimSuffix(fileName, ".lua.bak")
+		} else {
+			return nil
+		}
+
+		// Blizzard addons are not installed in the AddOns folder
+		if strings.HasPrefix(addon, "Blizzard_") {
+			return nil
+		}
+		if onlyAddons != nil && !onlyAddons[addon] {
+			return nil
+		}
+		if declared[scope][addon] {
+			return nil
+		}
+
+		orphans = append(orphans, SavedVariablesFile{
+			Path:  relativePath,
+			Addon: addon,
+			Scope: scope,
+			Size:  info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Path < orphans[j].Path
+	})
+
+	return orphans, nil
+}
+
+// Purge moves the given SavedVariables files into a backup, so they can still be restored.
+func (svm *SavedVariablesManager) Purge(gameVersion GameVersion, files []SavedVariablesFile) (*Backup, error) {
+	var relativePaths []string
+	for _, file := range files {
+		relativePaths = append(relativePaths, file.Path)
+	}
+	return svm.backupManager.Archive(gameVersion, relativePaths, BackupReasonPurge)
+}
@@ -0,0 +1,338 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"wowa-api"
+)
+
+type SyncActionType string
+
+const (
+	// The addon was added on another machine
+	SyncActionInstall SyncActionType = "install"
+	// The addon was removed on another machine
+	SyncActionRemove SyncActionType = "remove"
+	// The addon was only installed on this machine
+	SyncActionPush SyncActionType = "push"
+	// The addon was removed on this machine
+	SyncActionDeleteRemote SyncActionType = "delete-remote"
+	// The addon changed on both sides, so it is left alone
+	SyncActionConflict SyncActionType = "conflict"
+)
+
+type SyncAction struct {
+	Type        SyncActionType
+	Slug        string
+	GameVersion GameVersion
+	Name        string
+	Url         string
+	// Whether the addon to install is only for this device
+	DeviceOnly bool
+	// The organization requiring the addon to install, nil when the user added it
+	OrganizationId *string
+	Reason         string
+}
+
+type SyncActionResult struct {
+	Action SyncAction
+	Err    error
+}
+
+type SyncManager struct {
+	addonManager           *AddonManager
+	localAddonRepository   *LocalAddonRepository
+	remoteAddonRepository  *RemoteAddonRepository
+	syncSnapshotRepository *SyncSnapshotRepository
+}
+
+func NewSyncManager(addonManager *AddonManager, localAddonRepository *LocalAddonRepository, remoteAddonRepository *RemoteAddonRepository, syncSnapshotRepository *SyncSnapshotRepository) *SyncManager {
+	return &SyncManager{addonManager: addonManager, localAddonRepository: localAddonRepository, remoteAddonRepository: remoteAddonRepository, syncSnapshotRepository: syncSnapshotRepository}
+}
+
+type syncKey struct {
+	gameVersion GameVersion
+	slug        string
+}
+
+// getLocalAddonUrl returns the URL to install the addon from, since it is not stored locally.
+func getLocalAddonUrl(localAddon LocalAddon) string {
+	switch localAddon.Provider {
+	case Github:
+		return fmt.Sprintf("https://github.com/%s", localAddon.ExternalId)
+	default:
+		return fmt.Sprintf("https://www.curseforge.com/wow/addons/%s", localAddon.Slug)
+	}
+}
+
+// getRemoteState returns the remote addons and tombstones, from the mirror and the changes since its cursor.
+// The changes are only saved in the mirror when persist is true, so a plan that is not applied skips nothing.
+func (sm *SyncManager) getRemoteState(persist bool) (map[syncKey]RemoteAddon, map[syncKey]DeletedRemoteAddon, error) {
+	cursor, err := sm.syncSnapshotRepository.GetCursor()
+	if err != nil {
+		return nil, nil, err
+	}
+	remoteAddons, err := sm.syncSnapshotRepository.GetRemoteAddons()
+	if err != nil {
+		return nil, nil, err
+	}
+	tombstones, err := sm.syncSnapshotRepository.GetTombstones()
+	if err != nil {
+		return nil, nil, err
+	}
+	changes, err := sm.remoteAddonRepository.GetChanges(cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	remote := make(map[syncKey]RemoteAddon)
+	deleted := make(map[syncKey]DeletedRemoteAddon)
+	for _, remoteAddon := range remoteAddons {
+		remote[syncKey{remoteAddon.GameVersion, remoteAddon.Slug}] = remoteAddon
+	}
+	for _, tombstone := range tombstones {
+		deleted[syncKey{tombstone.GameVersion, tombstone.Slug}] = tombstone
+	}
+
+	// The changes are newer than the mirror
+	for _, remoteAddon := range changes.Addons {
+		key := syncKey{remoteAddon.GameVersion, remoteAddon.Slug}
+		remote[key] = remoteAddon
+		delete(deleted, key)
+	}
+	for _, tombstone := range changes.Deleted {
+		key := syncKey{tombstone.GameVersion, tombstone.Slug}
+		deleted[key] = tombstone
+		delete(remote, key)
+	}
+
+	if persist {
+		if err := sm.syncSnapshotRepository.SaveRemoteChanges(*changes); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return remote, deleted, nil
+}
+
+// Plan computes a three-way diff between the local addons, the remote addons and the last sync snapshot.
+// Without a snapshot entry, an addon on one side only is new there, unless it has a remote tombstone
+// newer than the local install. With a snapshot entry, it was removed on the other side.
+func (sm *SyncManager) Plan() ([]SyncAction, error) {
+	localAddons, err := sm.localAddonRepository.GetAll(nil)
+	if err != nil {
+		return nil, err
+	}
+	remote, tombstones, err := sm.getRemoteState(false)
+	if err != nil {
+		return nil, err
+	}
+	snapshotEntries, err := sm.syncSnapshotRepository.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	local := make(map[syncKey]LocalAddon)
+	snapshot := make(map[syncKey]SyncSnapshotEntry)
+	keys := make(map[syncKey]bool)
+	for _, localAddon := range localAddons {
+		key := syncKey{localAddon.GameVersion, localAddon.Slug}
+		local[key] = localAddon
+		keys[key] = true
+	}
+	for key, remoteAddon := range remote {
+		// Addons scoped to another device are left alone, even when they are installed here too
+		isForThisDevice, err := sm.remoteAddonRepository.IsForThisDevice(remoteAddon)
+		if err != nil {
+			return nil, err
+		}
+		if !isForThisDevice {
+			delete(keys, key)
+			delete(remote, key)
+			continue
+		}
+		keys[key] = true
+	}
+	for _, entry := range snapshotEntries {
+		snapshot[syncKey{entry.GameVersion, entry.Slug}] = entry
+	}
+
+	var actions []SyncAction
+	for key := range keys {
+		localAddon, isLocal := local[key]
+		remoteAddon, isRemote := remote[key]
+		entry, isInSnapshot := snapshot[key]
+
+		switch {
+		case isLocal && isRemote:
+			if localAddon.Provider != remoteAddon.Provider || localAddon.ExternalId != remoteAddon.ExternalId {
+				actions = append(actions, SyncAction{
+					Type: SyncActionConflict, Slug: key.slug, GameVersion: key.gameVersion, Name: localAddon.Name,
+					Reason: fmt.Sprintf("installed from %s here but from %s elsewhere", getLocalAddonUrl(localAddon), remoteAddon.Url),
+				})
+			}
+		case isLocal && !isInSnapshot:
+			if tombstone, ok := tombstones[key]; ok && tombstone.DeletedAt.After(localAddon.UpdatedAt) {
+				actions = append(actions, SyncAction{
+					Type: SyncActionRemove, Slug: key.slug, GameVersion: key.gameVersion, Name: localAddon.Name,
+				})
+			} else {
+				actions = append(actions, SyncAction{
+					Type: SyncActionPush, Slug: key.slug, GameVersion: key.gameVersion, Name: localAddon.Name, Url: getLocalAddonUrl(localAddon),
+				})
+			}
+		case isLocal:
+			if localAddon.Version != entry.Version {
+				actions = append(actions, SyncAction{
+					Type: SyncActionConflict, Slug: key.slug, GameVersion: key.gameVersion, Name: localAddon.Name,
+					Reason: "updated here but removed elsewhere",
+				})
+			} else {
+				actions = append(actions, SyncAction{
+					Type: SyncActionRemove, Slug: key.slug, GameVersion: key.gameVersion, Name: localAddon.Name,
+				})
+			}
+		case !isInSnapshot:
+			actions = append(actions, SyncAction{
+				Type: SyncActionInstall, Slug: key.slug, GameVersion: key.gameVersion, Name: remoteAddon.Name, Url: remoteAddon.Url,
+				DeviceOnly: remoteAddon.DeviceId != nil, OrganizationId: remoteAddon.OrganizationId,
+			})
+		default:
+			if remoteAddon.Revision != entry.Revision {
+				actions = append(actions, SyncAction{
+					Type: SyncActionConflict, Slug: key.slug, GameVersion: key.gameVersion, Name: remoteAddon.Name,
+					Reason: "removed here but updated elsewhere",
+				})
+			} else {
+				actions = append(actions, SyncAction{
+					Type: SyncActionDeleteRemote, Slug: key.slug, GameVersion: key.gameVersion, Name: remoteAddon.Name,
+				})
+			}
+		}
+	}
+
+	sort.Slice(actions, func(i, j int) bool {
+		if actions[i].GameVersion != actions[j].GameVersion {
+			return actions[i].GameVersion > actions[j].GameVersion
+		}
+		return actions[i].Slug < actions[j].Slug
+	})
+
+	return actions, nil
+}
+
+func (sm *SyncManager) apply(action SyncAction) error {
+	switch action.Type {
+	case SyncActionInstall:
+		if action.OrganizationId != nil {
+			_, err := sm.addonManager.InstallForOrganization(action.Url, action.GameVersion, *action.OrganizationId, action.DeviceOnly)
+			return err
+		}
+		_, err := sm.addonManager.InstallScoped(action.Url, action.GameVersion, action.DeviceOnly)
+		return err
+	case SyncActionRemove:
+		_, err := sm.addonManager.RemoveLocal(action.Slug, action.GameVersion)
+		return err
+	case SyncActionPush:
+		localAddon, err := sm.localAddonRepository.Get(action.Slug, action.GameVersion)
+		if err != nil {
+			return err
+		}
+		deviceId, err := sm.addonManager.getScopeDeviceId(localAddon.DeviceOnly)
+		if err != nil {
+			return err
+		}
+		_, err = sm.remoteAddonRepository.SaveAddon(CreateAddonRequest{
+			Slug:        localAddon.Slug,
+			GameVersion: localAddon.GameVersion,
+			PutAddonRequest: api.PutAddonRequest{
+				Author:         localAddon.Author,
+				Name:           localAddon.Name,
+				Provider:       localAddon.Provider,
+				ExternalId:     localAddon.ExternalId,
+				Url:            action.Url,
+				Version:        localAddon.Version,
+				FileId:         localAddon.FileId,
+				Channel:        localAddon.Channel,
+				Pinned:         localAddon.Pinned,
+				Directories:    localAddon.Directories,
+				DeviceId:       deviceId,
+				OrganizationId: localAddon.OrganizationId,
+			},
+		})
+		return err
+	case SyncActionDeleteRemote:
+		return sm.remoteAddonRepository.DeleteAddon(action.Slug, action.GameVersion)
+	default:
+		return nil
+	}
+}
+
+// Apply runs the planned actions one by one, skipping conflicts, then saves the new snapshot.
+// The optional callbacks are called before and after each action.
+func (sm *SyncManager) Apply(actions []SyncAction, onStart func(action SyncAction), onDone func(result SyncActionResult)) ([]SyncActionResult, error) {
+	var results []SyncActionResult
+	unresolved := make(map[syncKey]bool)
+	for _, action := range actions {
+		if action.Type == SyncActionConflict {
+			unresolved[syncKey{action.GameVersion, action.Slug}] = true
+			continue
+		}
+		if onStart != nil {
+			onStart(action)
+		}
+		result := SyncActionResult{Action: action, Err: sm.apply(action)}
+		if result.Err != nil {
+			unresolved[syncKey{action.GameVersion, action.Slug}] = true
+		}
+		results = append(results, result)
+		if onDone != nil {
+			onDone(result)
+		}
+	}
+
+	return results, sm.saveSnapshot(unresolved)
+}
+
+// saveSnapshot records the addons that are now both installed and saved remotely.
+// Conflicts and failed actions keep their previous entry, so they are planned again by the next sync.
+func (sm *SyncManager) saveSnapshot(unresolved map[syncKey]bool) error {
+	previousEntries, err := sm.syncSnapshotRepository.GetAll()
+	if err != nil {
+		return err
+	}
+
+	localAddons, err := sm.localAddonRepository.GetAll(nil)
+	if err != nil {
+		return err
+	}
+	// Fetches the changes made by this sync too
+	remote, _, err := sm.getRemoteState(true)
+	if err != nil {
+		return err
+	}
+
+	var entries []SyncSnapshotEntry
+	for _, entry := range previousEntries {
+		if unresolved[syncKey{entry.GameVersion, entry.Slug}] {
+			entries = append(entries, entry)
+		}
+	}
+	for _, localAddon := range localAddons {
+		key := syncKey{localAddon.GameVersion, localAddon.Slug}
+		remoteAddon, ok := remote[key]
+		if !ok || unresolved[key] {
+			continue
+		}
+		entries = append(entries, SyncSnapshotEntry{
+			Slug:        localAddon.Slug,
+			GameVersion: localAddon.GameVersion,
+			Version:     localAddon.Version,
+			Revision:    remoteAddon.Revision,
+			SyncedAt:    time.Now(),
+		})
+	}
+
+	return sm.syncSnapshotRepository.Replace(entries)
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestSyncManager returns a sync manager with the local addons and the snapshot, against a server
+// returning the remote changes from cursor 0. This device is registered as device_1.
+func newTestSyncManager(t *testing.T, localAddons []LocalAddon, changes RemoteAddonChanges, snapshot []SyncSnapshotEntry) *SyncManager {
+	t.Helper()
+	t.Setenv("WOWA_TOKEN", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/addons/changes" || r.URL.Query().Get("cursor") != "0" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(changes)
+	}))
+	t.Cleanup(server.Close)
+
+	kvStore, err := NewKeyValueStore(filepath.Join(t.TempDir(), "store.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	configRepository := NewConfigRepository(kvStore)
+	for key, value := range map[Config]string{AuthToken: "token", DeviceId: "device_1"} {
+		if err := configRepository.Set(key, &value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	localAddonRepository := NewLocalAddonRepository(kvStore)
+	for _, localAddon := range localAddons {
+		if err := localAddonRepository.Save(localAddon); err != nil {
+			t.Fatal(err)
+		}
+	}
+	syncSnapshotRepository := NewSyncSnapshotRepository(kvStore)
+	if err := syncSnapshotRepository.Replace(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	remoteAddonRepository := NewRemoteAddonRepository(NewUserManager(configRepository, server.URL), configRepository)
+	return NewSyncManager(nil, localAddonRepository, remoteAddonRepository, syncSnapshotRepository)
+}
+
+func TestSyncPlan(t *testing.T) {
+	syncedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	localDetails := LocalAddon{
+		Id: "details", Slug: "details", Name: "Details!", GameVersion: Retail, Version: "1.0.0",
+		Provider: Curse, ExternalId: "61284", UpdatedAt: syncedAt,
+	}
+	remoteDetails := RemoteAddon{
+		Slug: "details", Name: "Details!", GameVersion: Retail, Version: "1.0.0", Revision: 1,
+		Provider: Curse, ExternalId: "61284", Url: "https://www.curseforge.com/wow/addons/details",
+	}
+	snapshotDetails := SyncSnapshotEntry{Slug: "details", GameVersion: Retail, Version: "1.0.0", Revision: 1, SyncedAt: syncedAt}
+	withVersion := func(localAddon LocalAddon, version string) LocalAddon {
+		localAddon.Version = version
+		return localAddon
+	}
+	withRevision := func(remoteAddon RemoteAddon, revision int) RemoteAddon {
+		remoteAddon.Revision = revision
+		return remoteAddon
+	}
+	withDevice := func(remoteAddon RemoteAddon, deviceId string) RemoteAddon {
+		remoteAddon.DeviceId = &deviceId
+		return remoteAddon
+	}
+	withExternalId := func(remoteAddon RemoteAddon, externalId string) RemoteAddon {
+		remoteAddon.ExternalId = externalId
+		remoteAddon.Url = "https://github.com/" + externalId
+		return remoteAddon
+	}
+	tombstone := func(deletedAt time.Time) []DeletedRemoteAddon {
+		return []DeletedRemoteAddon{{Slug: "details", GameVersion: Retail, DeletedAt: deletedAt}}
+	}
+
+	tests := []struct {
+		name     string
+		local    []LocalAddon
+		changes  RemoteAddonChanges
+		snapshot []SyncSnapshotEntry
+		expected []SyncAction
+	}{
+		{
+			name:     "an addon added elsewhere is installed",
+			changes:  RemoteAddonChanges{Addons: []RemoteAddon{remoteDetails}},
+			expected: []SyncAction{{Type: SyncActionInstall, Slug: "details", GameVersion: Retail, Name: "Details!", Url: remoteDetails.Url}},
+		},
+		{
+			name:     "an addon added elsewhere for this device only is installed for it",
+			changes:  RemoteAddonChanges{Addons: []RemoteAddon{withDevice(remoteDetails, "device_1")}},
+			expected: []SyncAction{{Type: SyncActionInstall, Slug: "details", GameVersion: Retail, Name: "Details!", Url: remoteDetails.Url, DeviceOnly: true}},
+		},
+		{
+			name:    "an addon of another device is left alone",
+			changes: RemoteAddonChanges{Addons: []RemoteAddon{withDevice(remoteDetails, "device_2")}},
+		},
+		{
+			name:     "an addon removed elsewhere is removed",
+			local:    []LocalAddon{localDetails},
+			snapshot: []SyncSnapshotEntry{snapshotDetails},
+			expected: []SyncAction{{Type: SyncActionRemove, Slug: "details", GameVersion: Retail, Name: "Details!"}},
+		},
+		{
+			name:     "an addon removed elsewhere after it was installed here is removed",
+			local:    []LocalAddon{localDetails},
+			changes:  RemoteAddonChanges{Deleted: tombstone(syncedAt.Add(time.Hour))},
+			expected: []SyncAction{{Type: SyncActionRemove, Slug: "details", GameVersion: Retail, Name: "Details!"}},
+		},
+		{
+			name:     "an addon only installed here is pushed",
+			local:    []LocalAddon{localDetails},
+			expected: []SyncAction{{Type: SyncActionPush, Slug: "details", GameVersion: Retail, Name: "Details!", Url: remoteDetails.Url}},
+		},
+		{
+			name:     "an addon installed here after it was removed elsewhere is pushed",
+			local:    []LocalAddon{localDetails},
+			changes:  RemoteAddonChanges{Deleted: tombstone(syncedAt.Add(-time.Hour))},
+			expected: []SyncAction{{Type: SyncActionPush, Slug: "details", GameVersion: Retail, Name: "Details!", Url: remoteDetails.Url}},
+		},
+		{
+			name:     "an addon removed here is deleted remotely",
+			changes:  RemoteAddonChanges{Addons: []RemoteAddon{remoteDetails}},
+			snapshot: []SyncSnapshotEntry{snapshotDetails},
+			expected: []SyncAction{{Type: SyncActionDeleteRemote, Slug: "details", GameVersion: Retail, Name: "Details!"}},
+		},
+		{
+			name:     "an addon updated here but removed elsewhere is a conflict",
+			local:    []LocalAddon{withVersion(localDetails, "1.1.0")},
+			snapshot: []SyncSnapshotEntry{snapshotDetails},
+			expected: []SyncAction{{Type: SyncActionConflict, Slug: "details", GameVersion: Retail, Name: "Details!", Reason: "updated here but removed elsewhere"}},
+		},
+		{
+			name:     "an addon removed here but updated elsewhere is a conflict",
+			changes:  RemoteAddonChanges{Addons: []RemoteAddon{withRevision(remoteDetails, 2)}},
+			snapshot: []SyncSnapshotEntry{snapshotDetails},
+			expected: []SyncAction{{Type: SyncActionConflict, Slug: "details", GameVersion: Retail, Name: "Details!", Reason: "removed here but updated elsewhere"}},
+		},
+		{
+			name:    "an addon installed from another source on each side is a conflict",
+			local:   []LocalAddon{localDetails},
+			changes: RemoteAddonChanges{Addons: []RemoteAddon{withExternalId(remoteDetails, "Tercioo/Details-Damage-Meter")}},
+			expected: []SyncAction{{
+				Type: SyncActionConflict, Slug: "details", GameVersion: Retail, Name: "Details!",
+				Reason: "installed from https://www.curseforge.com/wow/addons/details here but from https://github.com/Tercioo/Details-Damage-Meter elsewhere",
+			}},
+		},
+		{
+			name:    "an addon on both sides is in sync",
+			local:   []LocalAddon{localDetails},
+			changes: RemoteAddonChanges{Addons: []RemoteAddon{remoteDetails}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sm := newTestSyncManager(t, test.local, test.changes, test.snapshot)
+
+			actions, err := sm.Plan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actions, test.expected) {
+				t.Fatalf("expected %+v, got %+v", test.expected, actions)
+			}
+
+			// A plan does not move the cursor, so the changes are still there when it is applied
+			cursor, err := sm.syncSnapshotRepository.GetCursor()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cursor != 0 {
+				t.Fatalf("expected the cursor to stay at 0, got %d", cursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// SyncSnapshotEntry records an addon that was both installed locally and saved remotely after the last sync.
+type SyncSnapshotEntry struct {
+	Slug        string      `json:"slug"`
+	GameVersion GameVersion `json:"gameVersion"`
+	// The local version and remote revision at the time, to detect changes made since
+	Version  string    `json:"version"`
+	Revision int       `json:"revision"`
+	SyncedAt time.Time `json:"syncedAt"`
+}
+
+// SyncSnapshotRepository stores the last sync snapshot, and a mirror of the remote addons kept up to date
+// with the change feed, including the tombstones of the addons deleted remotely.
+type SyncSnapshotRepository struct {
+	kvStore *KeyValueStore
+}
+
+func NewSyncSnapshotRepository(kvStore *KeyValueStore) *SyncSnapshotRepository {
+	return &SyncSnapshotRepository{kvStore: kvStore}
+}
+
+func (ssr *SyncSnapshotRepository) GetAll() ([]SyncSnapshotEntry, error) {
+	dataList, err := ssr.kvStore.GetByPrefix([]string{"sync-snapshot"})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []SyncSnapshotEntry
+	for _, jsonData := range dataList {
+		var entry SyncSnapshotEntry
+		if err := json.Unmarshal([]byte(jsonData), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Replace stores the given entries in place of the previous snapshot.
+func (ssr *SyncSnapshotRepository) Replace(entries []SyncSnapshotEntry) error {
+	previousEntries, err := ssr.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, entry := range previousEntries {
+		err := ssr.kvStore.Set([]string{"sync-snapshot", string(entry.GameVersion), entry.Slug}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		stringData := string(data)
+		err = ssr.kvStore.Set([]string{"sync-snapshot", string(entry.GameVersion), entry.Slug}, &stringData)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ssr *SyncSnapshotRepository) GetCursor() (int64, error) {
+	data, err := ssr.kvStore.Get([]string{"sync", "cursor"})
+	if err != nil || data == "" {
+		return 0, err
+	}
+	return strconv.ParseInt(data, 10, 64)
+}
+
+func (ssr *SyncSnapshotRepository) GetRemoteAddons() ([]RemoteAddon, error) {
+	dataList, err := ssr.kvStore.GetByPrefix([]string{"sync-remote-addons"})
+	if err != nil {
+		return nil, err
+	}
+
+	var remoteAddons []RemoteAddon
+	for _, jsonData := range dataList {
+		var remoteAddon RemoteAddon
+		if err := json.Unmarshal([]byte(jsonData), &remoteAddon); err != nil {
+			return nil, err
+		}
+		remoteAddons = append(remoteAddons, remoteAddon)
+	}
+
+	return remoteAddons, nil
+}
+
+func (ssr *SyncSnapshotRepository) GetTombstones() ([]DeletedRemoteAddon, error) {
+	dataList, err := ssr.kvStore.GetByPrefix([]string{"sync-remote-tombstones"})
+	if err != nil {
+		return nil, err
+	}
+
+	var tombstones []DeletedRemoteAddon
+	for _, jsonData := range dataList {
+		var tombstone DeletedRemoteAddon
+		if err := json.Unmarshal([]byte(jsonData), &tombstone); err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+
+	return tombstones, nil
+}
+
+// SaveRemoteChanges applies the changes of the feed to the mirror, then moves the cursor past them.
+func (ssr *SyncSnapshotRepository) SaveRemoteChanges(changes RemoteAddonChanges) error {
+	for _, remoteAddon := range changes.Addons {
+		data, err := json.Marshal(remoteAddon)
+		if err != nil {
+			return err
+		}
+		stringData := string(data)
+		err = ssr.kvStore.Set([]string{"sync-remote-addons", string(remoteAddon.GameVersion), remoteAddon.Slug}, &stringData)
+		if err != nil {
+			return err
+		}
+		err = ssr.kvStore.Set([]string{"sync-remote-tombstones", string(remoteAddon.GameVersion), remoteAddon.Slug}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tombstone := range changes.Deleted {
+		data, err := json.Marshal(tombstone)
+		if err != nil {
+			return err
+		}
+		stringData := string(data)
+		err = ssr.kvStore.Set([]string{"sync-remote-tombstones", string(tombstone.GameVersion), tombstone.Slug}, &stringData)
+		if err != nil {
+			return err
+		}
+		err = ssr.kvStore.Set([]string{"sync-remote-addons", string(tombstone.GameVersion), tombstone.Slug}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	cursor := strconv.FormatInt(changes.Cursor, 10)
+	return ssr.kvStore.Set([]string{"sync", "cursor"}, &cursor)
+}
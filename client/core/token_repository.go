@@ -0,0 +1,91 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"wowa-api"
+)
+
+// The tokens as returned by the server
+type (
+	TokenScope                 = api.Scope
+	PersonalAccessToken        = api.PersonalAccessToken
+	CreatedPersonalAccessToken = api.CreatedPersonalAccessToken
+)
+
+const (
+	TokenScopeAddonsRead  = api.ScopeAddonsRead
+	TokenScopeAddonsWrite = api.ScopeAddonsWrite
+)
+
+type TokenRepository struct {
+	userManager *UserManager
+}
+
+func NewTokenRepository(userManager *UserManager) *TokenRepository {
+	return &TokenRepository{userManager: userManager}
+}
+
+func (tr *TokenRepository) Create(name string, scope TokenScope) (*CreatedPersonalAccessToken, error) {
+	body, err := json.Marshal(api.CreatePersonalAccessTokenRequest{Name: name, Scope: scope})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := tr.userManager.DoAuthenticatedRequest("POST", "/tokens", body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to create token: %s", readErrorMessage(resp))
+	}
+
+	var token CreatedPersonalAccessToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (tr *TokenRepository) GetAll() ([]PersonalAccessToken, error) {
+	resp, err := tr.userManager.DoAuthenticatedRequest("GET", "/tokens", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get tokens: %s", readErrorMessage(resp))
+	}
+
+	var tokens []PersonalAccessToken
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Revoke deletes a token, returning false if it does not exist.
+func (tr *TokenRepository) Revoke(id string) (bool, error) {
+	resp, err := tr.userManager.DoAuthenticatedRequest("DELETE", "/tokens/"+id, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to revoke token: %s", readErrorMessage(resp))
+	}
+	return true, nil
+}
@@ -4,15 +4,26 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
+	"wowa-api"
 )
 
 type UserManager struct {
 	configRepository *ConfigRepository
 	apiUrl           string
+	refreshMu        sync.Mutex
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
 }
 
 func NewUserManager(configRepository *ConfigRepository, apiUrl string) *UserManager {
@@ -22,8 +33,56 @@ func NewUserManager(configRepository *ConfigRepository, apiUrl string) *UserMana
 	}
 }
 
+const personalAccessTokenPrefix = "wowa_pat_"
+
+// GetUserToken returns the WOWA_TOKEN personal access token when set, or the access token of the current session.
 func (um *UserManager) GetUserToken() (string, error) {
-	return um.configRepository.Get("auth.token")
+	if envToken := os.Getenv("WOWA_TOKEN"); envToken != "" {
+		return envToken, nil
+	}
+	return um.configRepository.Get(AuthToken)
+}
+
+func (um *UserManager) IsUsingEnvToken() bool {
+	return os.Getenv("WOWA_TOKEN") != ""
+}
+
+// DoAuthenticatedRequest sends a request to the wowa API, refreshing the access token once if it expired.
+func (um *UserManager) DoAuthenticatedRequest(method string, path string, body []byte) (*http.Response, error) {
+	token, err := um.GetUserToken()
+	if err != nil || token == "" {
+		return nil, errors.New("no user signed in")
+	}
+
+	send := func(token string) (*http.Response, error) {
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, fmt.Sprintf("%s%s", um.apiUrl, path), bodyReader)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		client := &http.Client{}
+		return client.Do(req)
+	}
+
+	resp, err := send(token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	_ = resp.Body.Close()
+
+	token, err = um.RefreshAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return send(token)
 }
 
 func (um *UserManager) GetUserEmail() (string, error) {
@@ -31,7 +90,8 @@ func (um *UserManager) GetUserEmail() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if token == "" {
+	// Personal access tokens are opaque, unlike the session JWTs
+	if token == "" || strings.HasPrefix(token, personalAccessTokenPrefix) {
 		return "", nil
 	}
 
@@ -40,13 +100,8 @@ func (um *UserManager) GetUserEmail() (string, error) {
 		return "", fmt.Errorf("invalid token format")
 	}
 
-	base64Payload := parts[1]
-	base64MissingPadding := (4 - len(base64Payload)%4) % 4
-	if base64MissingPadding > 0 {
-		base64Payload += strings.Repeat("=", base64MissingPadding)
-	}
-
-	payloadBytes, err := base64.StdEncoding.DecodeString(base64Payload)
+	// JWT segments are base64url encoded without padding
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
 	if err != nil {
 		return "", err
 	}
@@ -64,23 +119,261 @@ func (um *UserManager) GetUserEmail() (string, error) {
 	return email, nil
 }
 
-func (um *UserManager) SignIn(email, password string) error {
-	body, err := json.Marshal(map[string]string{
+func (um *UserManager) postCredentials(path string, email, password string) (*http.Response, error) {
+	return um.postJson(path, map[string]string{
 		"email":    email,
 		"password": password,
 	})
+}
+
+func (um *UserManager) saveTokens(resp *http.Response) error {
+	var tokens tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return err
+	}
+
+	if err := um.configRepository.Set(AuthToken, &tokens.AccessToken); err != nil {
+		return err
+	}
+	return um.configRepository.Set(AuthRefreshToken, &tokens.RefreshToken)
+}
+
+func (um *UserManager) clearTokens() error {
+	if err := um.configRepository.Set(AuthToken, nil); err != nil {
+		return err
+	}
+	return um.configRepository.Set(AuthRefreshToken, nil)
+}
+
+func (um *UserManager) postRefreshToken(path string, refreshToken string) (*http.Response, error) {
+	return um.postJson(path, map[string]string{
+		"refresh_token": refreshToken,
+	})
+}
+
+// RefreshAccessToken exchanges the refresh token for a new access token, replacing expiredToken.
+// When several requests fail at the same time, only the first one refreshes the tokens.
+func (um *UserManager) RefreshAccessToken(expiredToken string) (string, error) {
+	if um.IsUsingEnvToken() {
+		return "", errors.New("the WOWA_TOKEN personal access token was rejected, it may have been revoked")
+	}
+
+	um.refreshMu.Lock()
+	defer um.refreshMu.Unlock()
+
+	token, err := um.GetUserToken()
+	if err != nil {
+		return "", err
+	}
+	if token != expiredToken && token != "" {
+		return token, nil
+	}
+
+	refreshToken, err := um.configRepository.Get(AuthRefreshToken)
+	if err != nil {
+		return "", err
+	}
+	if refreshToken == "" {
+		return "", errors.New("your session expired, please sign in again with wowa login")
+	}
+
+	resp, err := um.postRefreshToken("/token/refresh", refreshToken)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := um.saveTokens(resp); err != nil {
+			return "", err
+		}
+		return um.GetUserToken()
+	case http.StatusUnauthorized:
+		if err := um.clearTokens(); err != nil {
+			return "", err
+		}
+		return "", errors.New("your session expired, please sign in again with wowa login")
+	default:
+		return "", fmt.Errorf("failed to refresh the session: %s", resp.Status)
+	}
+}
+
+func (um *UserManager) SignOut() error {
+	refreshToken, err := um.configRepository.Get(AuthRefreshToken)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/login", um.apiUrl), bytes.NewBuffer(body))
+	// Forget the tokens locally even if the server cannot be reached
+	if err := um.clearTokens(); err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+
+	resp, err := um.postRefreshToken("/logout", refreshToken)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	defer func() {
+		_ = resp.Body.Close()
+	}()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to revoke the session: %s", resp.Status)
+	}
+	return nil
+}
+
+// APIError is an error response of the server, whose code tells why the request failed.
+type APIError struct {
+	StatusCode int
+	// Empty when the response was not sent by the wowa server, like a proxy error
+	Code      api.ErrorCode
+	Message   string
+	RequestId string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// IsAPIError reports whether the error, or one it wraps, is an error response of the server with the given code.
+func IsAPIError(err error, code api.ErrorCode) bool {
+	var apiError *APIError
+	return errors.As(err, &apiError) && apiError.Code == code
+}
+
+// readAPIError reads the error response, which is JSON when sent by the wowa server.
+func readAPIError(resp *http.Response) *APIError {
+	apiError := &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+	rawMessage, err := io.ReadAll(resp.Body)
+	if err != nil || len(strings.TrimSpace(string(rawMessage))) == 0 {
+		return apiError
+	}
+
+	var body api.ErrorResponse
+	if err := json.Unmarshal(rawMessage, &body); err != nil || body.Code == "" {
+		apiError.Message = strings.TrimSpace(string(rawMessage))
+		return apiError
+	}
+	apiError.Code = body.Code
+	apiError.Message = body.Message
+	apiError.RequestId = body.RequestId
+	return apiError
+}
+
+func readErrorMessage(resp *http.Response) string {
+	return readAPIError(resp).Message
+}
+
+func (um *UserManager) SignIn(email, password string) error {
+	resp, err := um.postCredentials("/login", email, password)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return um.saveTokens(resp)
+	case http.StatusUnauthorized:
+		return fmt.Errorf("invalid email or password (use wowa register to create an account)")
+	case http.StatusBadRequest:
+		return fmt.Errorf("invalid email or password: %s", readErrorMessage(resp))
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("too many failed sign ins, try again in %s seconds", resp.Header.Get("Retry-After"))
+	default:
+		return fmt.Errorf("failed to sign in: %s", resp.Status)
+	}
+}
+
+func (um *UserManager) Register(email, password string) error {
+	resp, err := um.postCredentials("/register", email, password)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return um.saveTokens(resp)
+	case http.StatusConflict:
+		return fmt.Errorf("an account with this email already exists (use wowa login to sign in)")
+	case http.StatusBadRequest:
+		return fmt.Errorf("invalid email or password: %s", readErrorMessage(resp))
+	default:
+		return fmt.Errorf("failed to register: %s", resp.Status)
+	}
+}
+
+func (um *UserManager) ChangePassword(currentPassword, newPassword string) error {
+	body, err := json.Marshal(map[string]string{
+		"current_password": currentPassword,
+		"new_password":     newPassword,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := um.DoAuthenticatedRequest(http.MethodPost, "/password/change", body)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusOK {
+		// The server revokes every session, and starts a new one for this client
+		return um.saveTokens(resp)
+	}
+
+	apiError := readAPIError(resp)
+	switch apiError.Code {
+	case api.ErrorCodeInvalidCredentials:
+		return errors.New("invalid current password")
+	case api.ErrorCodeValidationFailed, api.ErrorCodeBadRequest:
+		return fmt.Errorf("invalid password: %s", apiError.Message)
+	case api.ErrorCodeInsufficientScope:
+		return errors.New("the WOWA_TOKEN personal access token does not have the account scope")
+	default:
+		return fmt.Errorf("failed to change password: %w", apiError)
+	}
+}
+
+// ExportAccount returns everything the server stores about the user, as JSON.
+func (um *UserManager) ExportAccount() ([]byte, error) {
+	resp, err := um.DoAuthenticatedRequest(http.MethodGet, "/me/export", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to export the account: %w", readAPIError(resp))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// DeleteAccount deletes the account with everything saved on the server, then forgets its tokens.
+func (um *UserManager) DeleteAccount(password string) error {
+	body, err := json.Marshal(map[string]string{"password": password})
+	if err != nil {
+		return err
+	}
+
+	resp, err := um.DoAuthenticatedRequest(http.MethodDelete, "/me", body)
 	if err != nil {
 		return err
 	}
@@ -89,17 +382,69 @@ func (um *UserManager) SignIn(email, password string) error {
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusBadRequest {
-			return fmt.Errorf("invalid email or password")
+		apiError := readAPIError(resp)
+		switch apiError.Code {
+		case api.ErrorCodeInvalidCredentials:
+			return errors.New("invalid password")
+		case api.ErrorCodeConflict:
+			return errors.New(apiError.Message)
+		default:
+			return fmt.Errorf("failed to delete the account: %w", apiError)
 		}
-		return fmt.Errorf("failed to sign in: %s", resp.Status)
 	}
+	return um.clearTokens()
+}
+
+func (um *UserManager) postJson(path string, payload map[string]string) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s%s", um.apiUrl, path), bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	return client.Do(req)
+}
+
+func (um *UserManager) RequestPasswordReset(email string) error {
+	resp, err := um.postJson("/password/reset/request", map[string]string{
+		"email": email,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// Older servers answer with 200
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to request a password reset: %s", readErrorMessage(resp))
+	}
+	return nil
+}
 
-	rawToken, err := io.ReadAll(resp.Body)
+func (um *UserManager) ResetPassword(resetCode, newPassword string) error {
+	resp, err := um.postJson("/password/reset", map[string]string{
+		"token":        resetCode,
+		"new_password": newPassword,
+	})
 	if err != nil {
 		return err
 	}
-	token := string(rawToken)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to reset password: %s", readErrorMessage(resp))
+	}
 
-	return um.configRepository.Set("auth.token", &token)
+	// Every session was revoked by the reset
+	return um.clearTokens()
 }
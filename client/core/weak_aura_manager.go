@@ -2,21 +2,24 @@ package core
 
 import (
 	"errors"
-	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
-	"strings"
 	"sync"
+	"time"
 	"wowa/utils"
 
 	lua "github.com/yuin/gopher-lua"
 )
 
 type WeakAuraManager struct {
-	configRepository *ConfigRepository
-	httpClient       *HTTPClient
+	version            string
+	configRepository   *ConfigRepository
+	weakAuraRepository *WeakAuraRepository
+	httpClient         *HTTPClient
+	wagoToken          string
 }
 
 type LocalWeakAura struct {
@@ -34,33 +37,29 @@ type WeakAuraUpdate struct {
 	Encoded     string
 }
 
-func NewWeakAuraManager(configRepository *ConfigRepository, httpClient *HTTPClient) *WeakAuraManager {
-	return &WeakAuraManager{
-		configRepository: configRepository,
-		httpClient:       httpClient,
-	}
+type UnreachableWeakAura struct {
+	Name   string
+	Slug   string
+	Reason string
 }
 
-// TODO: Move this to another file. This is duplicated in the addon manager file.
-func (wam *WeakAuraManager) getGameVersionFolder(gameVersion GameVersion) (string, error) {
-	gameDir, err := wam.configRepository.Get(GameDir)
-	if err != nil {
-		return "", err
-	}
-	if gameDir == "" {
-		return "", errors.New("game dir is not defined")
-	}
+type WeakAuraUpdateAllResult struct {
+	Updates     []WeakAuraUpdate
+	Unreachable []UnreachableWeakAura
+}
 
-	var versionFolder string
-	if gameVersion == "classic" {
-		versionFolder = "_classic_era_"
-	} else {
-		versionFolder = "_retail_"
+func NewWeakAuraManager(version string, configRepository *ConfigRepository, weakAuraRepository *WeakAuraRepository, httpClient *HTTPClient, wagoToken string) *WeakAuraManager {
+	return &WeakAuraManager{
+		version:            version,
+		configRepository:   configRepository,
+		weakAuraRepository: weakAuraRepository,
+		httpClient:         httpClient,
+		wagoToken:          wagoToken,
 	}
+}
 
-	addonsFolder := filepath.Join(gameDir, versionFolder)
-
-	return addonsFolder, nil
+func (wam *WeakAuraManager) getGameVersionFolder(gameVersion GameVersion) (string, error) {
+	return getGameVersionFolder(wam.configRepository, gameVersion)
 }
 
 func (wam *WeakAuraManager) getWeakAurasLuaPath(gameVersion GameVersion) ([]string, error) {
@@ -194,108 +193,151 @@ func (wam *WeakAuraManager) getInstalledWeakAuras(gameVersion GameVersion) ([]Lo
 	return weakAuras, nil
 }
 
-func (wam *WeakAuraManager) generateCompanionDataFile(weakAuraUpdates []WeakAuraUpdate) string {
-	lines := []string{
-		"WowaCompanionData = {",
-		"   WeakAuras = {",
-		"       slugs = {",
-	}
-
-	for _, update := range weakAuraUpdates {
-		// TODO: Support changelogs
-		changelog := ""
-		line := fmt.Sprintf(
-			"[\"%s\"] = {\n"+
-				"    name = [=[%s]=],\n"+
-				"    author = [=[%s]=],\n"+
-				"    encoded = [=[%s]=],\n"+
-				"    wagoVersion = [=[%d]=],\n"+
-				"    wagoSemver = [=[%s]=],\n"+
-				"    source = [=[%s]=],\n"+
-				"    versionNote = [=[%s]=],\n"+
-				"},",
-			update.Slug, update.Name, update.Author, update.Encoded, update.WagoVersion, update.WagoSemver, "Wago", changelog,
-		)
-
-		lines = append(lines, line)
-	}
-
-	lines = append(lines, "       }")
-	lines = append(lines, "   }")
-	lines = append(lines, "}")
-
-	return strings.Join(lines, "\n")
+func (wam *WeakAuraManager) getCompanionAddonFolder(gameVersion GameVersion) (string, error) {
+	gameVersionFolder, err := wam.getGameVersionFolder(gameVersion)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gameVersionFolder, "Interface", "AddOns", "WowaCompanion"), nil
 }
 
 func (wam *WeakAuraManager) installCompanionAddon(updates []WeakAuraUpdate, gameVersion GameVersion) error {
-	// Compute the addon path
-	gameVersionFolder, err := wam.getGameVersionFolder(gameVersion)
+	addonFolder, err := wam.getCompanionAddonFolder(gameVersion)
 	if err != nil {
 		return err
 	}
-	addonFolder := filepath.Join(gameVersionFolder, "Interface", "AddOns", "WowaCompanion")
 
-	// Create the addon directory
-	if err := os.MkdirAll(addonFolder, os.ModePerm); err != nil {
-		return err
+	generatedAt := time.Now()
+	for _, update := range updates {
+		err := wam.weakAuraRepository.SaveImport(CompanionImport{
+			Slug:        update.Slug,
+			Name:        update.Name,
+			GameVersion: gameVersion,
+			WagoVersion: update.WagoVersion,
+			WagoSemver:  update.WagoSemver,
+			GeneratedAt: generatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeCompanionAddon(addonFolder, gameVersion, wam.version, updates)
+}
+
+func getInstalledVersions(weakAuras []LocalWeakAura) map[string]int {
+	installedVersions := make(map[string]int)
+	for _, wa := range weakAuras {
+		installedVersions[wa.Slug] = max(wa.Version, installedVersions[wa.Slug])
 	}
+	return installedVersions
+}
 
-	// Create the Data.lua file
-	dataLuaPath := filepath.Join(addonFolder, "Data.lua")
-	err = os.WriteFile(dataLuaPath, []byte(wam.generateCompanionDataFile(updates)), os.ModePerm)
+// markAppliedImports marks the imports the player applied in game since they were last checked, without
+// saving them, and returns the indexes of the ones it marked.
+func markAppliedImports(companionImports []CompanionImport, installedVersions map[string]int, appliedAt time.Time) []int {
+	var marked []int
+	for i := range companionImports {
+		companionImport := &companionImports[i]
+		if companionImport.AppliedAt != nil || installedVersions[companionImport.Slug] < companionImport.WagoVersion {
+			continue
+		}
+		companionImport.AppliedAt = &appliedAt
+		marked = append(marked, i)
+	}
+	return marked
+}
+
+// refreshCompanionImports saves the imports the player already applied in game,
+// and drops them from the companion addon so it never offers them again.
+func (wam *WeakAuraManager) refreshCompanionImports(weakAuras []LocalWeakAura, gameVersion GameVersion) error {
+	installedVersions := getInstalledVersions(weakAuras)
+
+	companionImports, err := wam.weakAuraRepository.GetAllImports(gameVersion)
 	if err != nil {
 		return err
 	}
+	for _, i := range markAppliedImports(companionImports, installedVersions, time.Now()) {
+		if err := wam.weakAuraRepository.SaveImport(companionImports[i]); err != nil {
+			return err
+		}
+	}
 
-	// Create WowaCompanion.toc file
-	wowaCompanionTocPath := filepath.Join(addonFolder, "WowaCompanion.toc")
-	tocContent := []string{
-		"## Title: Wowa Companion",
-		"## Author: Victor Wolmeister",
-		"## Version: 1.0.0",
-		"## Notes: Wowa Companion addon to keep things up to date",
-		"## DefaultState: Enabled",
-		"## OptionalDeps: WeakAuras",
-		"",
-		"Data.lua",
-		"WowaCompanion.lua",
-	}
-	err = os.WriteFile(wowaCompanionTocPath, []byte(strings.Join(tocContent, "\n")), os.ModePerm)
+	addonFolder, err := wam.getCompanionAddonFolder(gameVersion)
 	if err != nil {
 		return err
 	}
-
-	// Create WowaCompanion.lua file
-	wowaCompanionLuaPath := filepath.Join(addonFolder, "WowaCompanion.lua")
-	luaContent := []string{
-		"local frame = CreateFrame(\"FRAME\")",
-		"frame:RegisterEvent(\"ADDON_LOADED\")",
-		"frame:SetScript(\"OnEvent\", function(_, _, addonName)",
-		"   if addonName == \"WowaCompanion\" then",
-		"       if WeakAuras and WeakAuras.AddCompanionData and WowaCompanionData then",
-		"           local WeakAurasData = WowaCompanionData.WeakAuras",
-		"           if WeakAurasData then",
-		"                WeakAuras.AddCompanionData(WeakAurasData)",
-		"           end",
-		"       end",
-		"   end",
-		"end)",
-	}
-
-	err = os.WriteFile(wowaCompanionLuaPath, []byte(strings.Join(luaContent, "\n")), os.ModePerm)
+	offeredUpdates, err := readCompanionAddon(addonFolder)
 	if err != nil {
 		return err
 	}
 
+	var pendingUpdates []WeakAuraUpdate
+	for _, update := range offeredUpdates {
+		if installedVersions[update.Slug] < update.WagoVersion {
+			pendingUpdates = append(pendingUpdates, update)
+		}
+	}
+	if len(pendingUpdates) != len(offeredUpdates) {
+		return writeCompanionAddon(addonFolder, gameVersion, wam.version, pendingUpdates)
+	}
 	return nil
 }
 
-func (wam *WeakAuraManager) UpdateAll(gameVersion GameVersion) ([]WeakAuraUpdate, error) {
+// Status returns every weak aura import the companion addon offered, pending or already applied.
+// It only reads the state, the imports applied in game since are saved by UpdateAll.
+func (wam *WeakAuraManager) Status(gameVersion GameVersion) ([]CompanionImport, error) {
 	weakAuras, err := wam.getInstalledWeakAuras(gameVersion)
 	if err != nil {
 		return nil, err
 	}
 
+	companionImports, err := wam.weakAuraRepository.GetAllImports(gameVersion)
+	if err != nil {
+		return nil, err
+	}
+	markAppliedImports(companionImports, getInstalledVersions(weakAuras), time.Now())
+
+	sort.Slice(companionImports, func(i, j int) bool {
+		return companionImports[i].Name < companionImports[j].Name
+	})
+
+	return companionImports, nil
+}
+
+func (wam *WeakAuraManager) wagoHeaders() map[string]string {
+	headers := map[string]string{}
+	if wam.wagoToken != "" {
+		headers["api-key"] = wam.wagoToken
+	}
+	return headers
+}
+
+func (wam *WeakAuraManager) unreachableReason(err error) string {
+	if wam.wagoToken == "" {
+		reason := "private or unlisted weak auras require a Wago API key (wowa config wago.token <key>)"
+		if err != nil {
+			reason = err.Error() + " - " + reason
+		}
+		return reason
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return "not found on Wago or not accessible with the configured Wago API key"
+}
+
+func (wam *WeakAuraManager) UpdateAll(gameVersion GameVersion) (WeakAuraUpdateAllResult, error) {
+	weakAuras, err := wam.getInstalledWeakAuras(gameVersion)
+	if err != nil {
+		return WeakAuraUpdateAllResult{}, err
+	}
+
+	// Do not leave imports the player already applied behind if anything below fails
+	if err := wam.refreshCompanionImports(weakAuras, gameVersion); err != nil {
+		return WeakAuraUpdateAllResult{}, err
+	}
+
 	type WagoCheckUpdatesRequest struct {
 		Ids []string `json:"ids"`
 	}
@@ -314,18 +356,38 @@ func (wam *WeakAuraManager) UpdateAll(gameVersion GameVersion) ([]WeakAuraUpdate
 		wagoRequest.Ids = append(wagoRequest.Ids, wa.Slug)
 	}
 
+	checkHeaders := wam.wagoHeaders()
+	checkHeaders["Content-Type"] = "application/json"
 	err = wam.httpClient.Post(RequestParams{
-		URL: "https://data.wago.io/api/check/weakauras",
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
+		URL:     "https://data.wago.io/api/check/weakauras",
+		Headers: checkHeaders,
 	}, wagoRequest, &wagoResponse)
 	if err != nil {
-		return nil, err
+		return WeakAuraUpdateAllResult{}, err
+	}
+
+	var result WeakAuraUpdateAllResult
+
+	// Wago leaves out the weak auras it does not let us see
+	for _, wa := range weakAuras {
+		found := false
+		for _, waUpdate := range wagoResponse {
+			if wa.Slug == waUpdate.Slug {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.Unreachable = append(result.Unreachable, UnreachableWeakAura{
+				Name:   wa.Name,
+				Slug:   wa.Slug,
+				Reason: wam.unreachableReason(nil),
+			})
+		}
 	}
 
 	var wg sync.WaitGroup
-	var updates []WeakAuraUpdate
+	var mu sync.Mutex
 
 	for _, waUpdate := range wagoResponse {
 		shouldUpdate := false
@@ -344,14 +406,22 @@ func (wam *WeakAuraManager) UpdateAll(gameVersion GameVersion) ([]WeakAuraUpdate
 			defer wg.Done()
 
 			encodedBytes, err := wam.httpClient.GetBytes(RequestParams{
-				URL: "https://data.wago.io/api/raw/encoded?id=" + waUpdate.Slug,
+				URL:     "https://data.wago.io/api/raw/encoded?id=" + waUpdate.Slug,
+				Headers: wam.wagoHeaders(),
 			})
+
+			mu.Lock()
+			defer mu.Unlock()
+
 			if err != nil {
-				// TODO: Handle errors
-				wg.Done()
+				result.Unreachable = append(result.Unreachable, UnreachableWeakAura{
+					Name:   waUpdate.Name,
+					Slug:   waUpdate.Slug,
+					Reason: wam.unreachableReason(err),
+				})
 				return
 			}
-			updates = append(updates, WeakAuraUpdate{
+			result.Updates = append(result.Updates, WeakAuraUpdate{
 				Slug:        waUpdate.Slug,
 				Name:        waUpdate.Name,
 				Author:      waUpdate.Author,
@@ -359,16 +429,15 @@ func (wam *WeakAuraManager) UpdateAll(gameVersion GameVersion) ([]WeakAuraUpdate
 				WagoSemver:  waUpdate.WagoSemver,
 				Encoded:     string(encodedBytes),
 			})
-
 		}(waUpdate)
 	}
 
 	wg.Wait()
 
-	err = wam.installCompanionAddon(updates, gameVersion)
+	err = wam.installCompanionAddon(result.Updates, gameVersion)
 	if err != nil {
-		return nil, err
+		return WeakAuraUpdateAllResult{}, err
 	}
 
-	return updates, nil
+	return result, nil
 }
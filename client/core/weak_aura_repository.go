@@ -0,0 +1,52 @@
+package core
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// CompanionImport records a weak aura version offered through the companion addon.
+type CompanionImport struct {
+	Slug        string      `json:"slug"`
+	Name        string      `json:"name"`
+	GameVersion GameVersion `json:"gameVersion"`
+	WagoVersion int         `json:"wagoVersion"`
+	WagoSemver  string      `json:"wagoSemver"`
+	GeneratedAt time.Time   `json:"generatedAt"`
+	AppliedAt   *time.Time  `json:"appliedAt"`
+}
+
+type WeakAuraRepository struct {
+	kvStore *KeyValueStore
+}
+
+func NewWeakAuraRepository(kvStore *KeyValueStore) *WeakAuraRepository {
+	return &WeakAuraRepository{kvStore: kvStore}
+}
+
+func (war *WeakAuraRepository) SaveImport(companionImport CompanionImport) error {
+	data, err := json.Marshal(companionImport)
+	if err != nil {
+		return err
+	}
+	stringData := string(data)
+	return war.kvStore.Set([]string{"weak-aura-imports", string(companionImport.GameVersion), companionImport.Slug}, &stringData)
+}
+
+func (war *WeakAuraRepository) GetAllImports(gameVersion GameVersion) ([]CompanionImport, error) {
+	dataList, err := war.kvStore.GetByPrefix([]string{"weak-aura-imports", string(gameVersion)})
+	if err != nil {
+		return nil, err
+	}
+
+	var companionImports []CompanionImport
+	for _, jsonData := range dataList {
+		var companionImport CompanionImport
+		if err := json.Unmarshal([]byte(jsonData), &companionImport); err != nil {
+			return nil, err
+		}
+		companionImports = append(companionImports, companionImport)
+	}
+
+	return companionImports, nil
+}
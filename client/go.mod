@@ -8,6 +8,7 @@ require (
 	github.com/spf13/cobra v1.8.1
 	github.com/yuin/gopher-lua v1.1.1
 	golang.org/x/crypto v0.32.0
+	wowa-api v0.0.0-00010101000000-000000000000
 )
 
 require (
@@ -19,3 +20,5 @@ require (
 	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/term v0.28.0 // indirect
 )
+
+replace wowa-api => ../api
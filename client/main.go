@@ -40,6 +40,10 @@ func getKeyValueStorePath() (string, error) {
 	return path, nil
 }
 
+func getBackupDir(kvStorePath string) string {
+	return filepath.Join(filepath.Dir(kvStorePath), "backups")
+}
+
 func main() {
 	var httpClient = core.NewHTTPClient()
 
@@ -57,8 +61,15 @@ func main() {
 
 	var configRepository = core.NewConfigRepository(kvStore)
 	var userManager = core.NewUserManager(configRepository, apiUrl)
-	var remoteAddonRepository = core.NewRemoteAddonRepository(userManager, apiUrl)
+	var remoteAddonRepository = core.NewRemoteAddonRepository(userManager, configRepository)
+	var tokenRepository = core.NewTokenRepository(userManager)
+	var collectionRepository = core.NewCollectionRepository(userManager)
+	var organizationRepository = core.NewOrganizationRepository(userManager)
+	var deviceRepository = core.NewDeviceRepository(userManager)
+	var providerRepository = core.NewProviderRepository(userManager)
 	var localAddonRepository = core.NewLocalAddonRepository(kvStore)
+	var weakAuraRepository = core.NewWeakAuraRepository(kvStore)
+	var syncSnapshotRepository = core.NewSyncSnapshotRepository(kvStore)
 
 	curseToken, err := configRepository.Get(core.CurseToken)
 	if err != nil {
@@ -70,27 +81,55 @@ func main() {
 		log.Fatal(err)
 		return
 	}
+	wagoToken, err := configRepository.Get(core.WagoToken)
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
 
-	var addonSearcher = core.NewAddonSearcher(httpClient, curseToken, githubToken)
+	var addonSearcher = core.NewAddonSearcher(httpClient, providerRepository, curseToken, githubToken)
 	var addonManager = core.NewAddonManager(addonSearcher, configRepository, localAddonRepository, remoteAddonRepository, httpClient)
 	var selfUpdateManager = core.NewSelfUpdateManager(version, httpClient)
-	var weakAuraManager = core.NewWeakAuraManager(configRepository, httpClient)
+	var backupManager = core.NewBackupManager(configRepository, getBackupDir(kvStorePath))
+	var savedVariablesManager = core.NewSavedVariablesManager(configRepository, backupManager)
+	var weakAuraManager = core.NewWeakAuraManager(version, configRepository, weakAuraRepository, httpClient, wagoToken)
+	var syncManager = core.NewSyncManager(addonManager, localAddonRepository, remoteAddonRepository, syncSnapshotRepository)
+	var collectionManager = core.NewCollectionManager(collectionRepository, localAddonRepository, addonSearcher, userManager)
+	var organizationManager = core.NewOrganizationManager(organizationRepository, localAddonRepository, addonSearcher, configRepository)
+	var deviceManager = core.NewDeviceManager(deviceRepository, localAddonRepository, configRepository, kvStore)
 
 	var rootCmd = &cobra.Command{
 		Use:     "wowa",
 		Short:   "World of Warcraft addon manager",
 		Long:    `A simple CLI to manage World of Warcraft addons`,
 		Version: version,
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			// Best effort, the installed addons are reported again after the next command
+			_ = deviceManager.ReportInstalledAddons()
+		},
 	}
 
 	cmd.SetupAddCmd(rootCmd, addonManager)
-	cmd.SetupUpdateCmd(rootCmd, addonManager, remoteAddonRepository, weakAuraManager)
-	cmd.SetupRemoveCmd(rootCmd, addonManager)
+	cmd.SetupUpdateCmd(rootCmd, addonManager, remoteAddonRepository, organizationManager, weakAuraManager, backupManager)
+	cmd.SetupRemoveCmd(rootCmd, addonManager, localAddonRepository, savedVariablesManager)
+	cmd.SetupSyncCmd(rootCmd, syncManager)
+	cmd.SetupListCmd(rootCmd, collectionManager, addonManager)
+	cmd.SetupOrgCmd(rootCmd, organizationManager)
+	cmd.SetupDevicesCmd(rootCmd, deviceManager)
 	cmd.SetupLsCmd(rootCmd, localAddonRepository)
 	cmd.SetupConfigCmd(rootCmd, configRepository)
-	cmd.SetupLoginCmd(rootCmd, userManager)
+	cmd.SetupRegisterCmd(rootCmd, userManager)
+	cmd.SetupLoginCmd(rootCmd, userManager, deviceManager)
+	cmd.SetupLogoutCmd(rootCmd, userManager, deviceManager)
+	cmd.SetupPasswdCmd(rootCmd, userManager)
 	cmd.SetupWhoamiCmd(rootCmd, userManager)
+	cmd.SetupAccountCmd(rootCmd, userManager, deviceManager)
+	cmd.SetupTokenCmd(rootCmd, tokenRepository)
 	cmd.SetupSelfUpdateCmd(rootCmd, selfUpdateManager)
+	cmd.SetupWeakAuraCmd(rootCmd, weakAuraManager)
+	cmd.SetupBackupCmd(rootCmd, backupManager)
+	cmd.SetupRestoreCmd(rootCmd, backupManager)
+	cmd.SetupCleanCmd(rootCmd, savedVariablesManager)
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
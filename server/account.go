@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/crypto/bcrypt"
+
+	"wowa-api"
+)
+
+type AccountProfile struct {
+	Id        string    `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AccountExport is everything the server stores about a user, except the secrets.
+type AccountExport struct {
+	User        AccountProfile   `json:"user"`
+	Addons      []api.Addon      `json:"addons"`
+	Collections []api.Collection `json:"collections"`
+	Devices     []api.Device     `json:"devices"`
+	// The organizations the user is a member of, with the role of the user
+	Organizations []api.Organization `json:"organizations"`
+	// The pending invitations to join organizations, sent to the email of the user
+	Invitations []api.OrganizationInvitation `json:"invitations"`
+	Tokens      []api.PersonalAccessToken    `json:"tokens"`
+	ExportedAt  time.Time                    `json:"exported_at"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+func getAccountExport(store Store, userId string) (*AccountExport, error) {
+	user, err := store.GetUserById(userId)
+	if err != nil {
+		return nil, err
+	}
+	addons, err := store.GetAddons(userId)
+	if err != nil {
+		return nil, err
+	}
+	collections, err := store.GetCollections(userId)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := store.GetDevices(userId)
+	if err != nil {
+		return nil, err
+	}
+	organizations, err := store.GetOrganizations(userId)
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := store.GetInvitationsByEmail(normalizeEmail(user.Email))
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := store.GetPersonalAccessTokens(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccountExport{
+		User:          AccountProfile{Id: user.Id, Email: user.Email, CreatedAt: user.CreatedAt},
+		Addons:        toApiAddons(addons),
+		Collections:   toApiCollections(collections),
+		Devices:       toApiDevices(devices),
+		Organizations: toApiOrganizations(organizations),
+		Invitations:   toApiOrganizationInvitations(invitations),
+		Tokens:        toApiPersonalAccessTokens(tokens),
+		ExportedAt:    time.Now(),
+	}, nil
+}
+
+// exportAccountHandler returns everything the server stores about the user, as a JSON file to download.
+func exportAccountHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		export, err := getAccountExport(store, getUserId(r))
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="wowa-export.json"`)
+		w.Header().Set("Cache-Control", "no-store")
+		writeJson(w, export)
+	}
+}
+
+// deleteAccountHandler deletes the user with everything they saved, once their password is confirmed.
+// The organizations they own are deleted too, once they removed the other members.
+func deleteAccountHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var deleteRequest DeleteAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&deleteRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(deleteRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		user, err := store.GetUserById(userId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(deleteRequest.Password))
+		if err != nil {
+			writeError(w, r, http.StatusForbidden, api.ErrorCodeInvalidCredentials, "Invalid password")
+			return
+		}
+
+		err = store.DeleteUser(userId)
+		if err == ErrOrganizationHasMembers {
+			writeError(w, r, http.StatusConflict, api.ErrorCodeConflict, "Remove the other members of the organizations you own first")
+			return
+		}
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wowa-api"
+)
+
+// Collection is a named list of addons that its owner can share, so others can subscribe and install it.
+type Collection struct {
+	Id        string            `gorm:"primarykey;not null" json:"id"`
+	UserId    string            `gorm:"index;not null" json:"user_id"`
+	Name      string            `gorm:"not null" json:"name"`
+	ShareCode *string           `gorm:"uniqueIndex" json:"share_code"`
+	CreatedAt time.Time         `gorm:"not null" json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Addons    []CollectionAddon `json:"addons"`
+	User      User              `json:"-"`
+}
+
+type CollectionAddon struct {
+	Id           string      `gorm:"primarykey;not null" json:"id"`
+	CollectionId string      `gorm:"uniqueIndex:idx_unique_collection_addon;not null" json:"collection_id"`
+	GameVersion  GameVersion `gorm:"uniqueIndex:idx_unique_collection_addon;not null" json:"game_version"`
+	Slug         string      `gorm:"uniqueIndex:idx_unique_collection_addon;not null" json:"slug"`
+	Name         string      `gorm:"not null" json:"name"`
+	Author       string      `gorm:"not null" json:"author"`
+	Provider     Provider    `gorm:"not null" json:"provider"`
+	ExternalId   string      `gorm:"not null" json:"external_id"`
+	Url          string      `gorm:"not null" json:"url"`
+	CreatedAt    time.Time   `gorm:"not null" json:"created_at"`
+}
+
+type CollectionSubscription struct {
+	UserId       string    `gorm:"primarykey;not null"`
+	CollectionId string    `gorm:"primarykey;not null;index"`
+	CreatedAt    time.Time `gorm:"not null"`
+}
+
+// toApiCollection returns the collection as sent to the clients.
+func toApiCollection(collection Collection) api.Collection {
+	addons := []api.CollectionAddon{}
+	for _, addon := range collection.Addons {
+		addons = append(addons, api.CollectionAddon{
+			Id:           addon.Id,
+			CollectionId: addon.CollectionId,
+			AddonReference: api.AddonReference{
+				GameVersion: addon.GameVersion,
+				Slug:        addon.Slug,
+				Name:        addon.Name,
+				Author:      addon.Author,
+				Provider:    addon.Provider,
+				ExternalId:  addon.ExternalId,
+				Url:         addon.Url,
+			},
+			CreatedAt: addon.CreatedAt,
+		})
+	}
+	return api.Collection{
+		Id:        collection.Id,
+		UserId:    collection.UserId,
+		Name:      collection.Name,
+		ShareCode: collection.ShareCode,
+		Addons:    addons,
+		CreatedAt: collection.CreatedAt,
+		UpdatedAt: collection.UpdatedAt,
+	}
+}
+
+func toApiCollections(collections []Collection) []api.Collection {
+	apiCollections := []api.Collection{}
+	for _, collection := range collections {
+		apiCollections = append(apiCollections, toApiCollection(collection))
+	}
+	return apiCollections
+}
+
+// generateShareCode returns a short code that is easy to paste in a guild chat.
+func generateShareCode() (string, error) {
+	randomBytes := make([]byte, 10)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
+// getCollectionForUser returns the collection if the user owns it, or subscribed to it when ownerOnly is false.
+// It writes the error response and returns nil otherwise.
+func getCollectionForUser(store Store, w http.ResponseWriter, r *http.Request, userId string, collectionId string, ownerOnly bool) *Collection {
+	collection, err := store.GetCollection(collectionId)
+	if err != nil {
+		if err == ErrNotFound {
+			writeNotFound(w, r)
+			return nil
+		}
+		writeInternalError(w, r, err)
+		return nil
+	}
+
+	if collection.UserId == userId {
+		return collection
+	}
+	if !ownerOnly {
+		subscribed, err := store.IsSubscribedToCollection(userId, collectionId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return nil
+		}
+		if subscribed {
+			return collection
+		}
+	}
+
+	// Do not reveal that the collection exists
+	writeNotFound(w, r)
+	return nil
+}
+
+func createCollectionHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var createRequest api.CreateCollectionRequest
+		if err := json.NewDecoder(r.Body).Decode(&createRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(createRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		collection := Collection{
+			Id:     "collection_" + uuid.New().String(),
+			UserId: userId,
+			Name:   createRequest.Name,
+			Addons: []CollectionAddon{},
+		}
+		err := store.CreateCollection(&collection)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		writeJson(w, toApiCollection(collection))
+	}
+}
+
+// getCollectionsHandler returns the collections the user owns or subscribed to.
+func getCollectionsHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		collections, err := store.GetCollections(userId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		writeJson(w, toApiCollections(collections))
+	}
+}
+
+func getCollectionHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		collection := getCollectionForUser(store, w, r, userId, mux.Vars(r)["id"], false)
+		if collection == nil {
+			return
+		}
+		writeJson(w, toApiCollection(*collection))
+	}
+}
+
+func addCollectionAddonHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var addRequest api.AddCollectionAddonRequest
+		if err := json.NewDecoder(r.Body).Decode(&addRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(addRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		collection := getCollectionForUser(store, w, r, userId, mux.Vars(r)["id"], true)
+		if collection == nil {
+			return
+		}
+
+		err := store.SaveCollectionAddon(&CollectionAddon{
+			Id:           "collection_addon_" + uuid.New().String(),
+			CollectionId: collection.Id,
+			GameVersion:  addRequest.GameVersion,
+			Slug:         addRequest.Slug,
+			Name:         addRequest.Name,
+			Author:       addRequest.Author,
+			Provider:     addRequest.Provider,
+			ExternalId:   addRequest.ExternalId,
+			Url:          addRequest.Url,
+		})
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		collection = getCollectionForUser(store, w, r, userId, collection.Id, true)
+		if collection == nil {
+			return
+		}
+		writeJson(w, toApiCollection(*collection))
+	}
+}
+
+func deleteCollectionAddonHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		vars := mux.Vars(r)
+		collection := getCollectionForUser(store, w, r, userId, vars["id"], true)
+		if collection == nil {
+			return
+		}
+
+		err := store.DeleteCollectionAddon(collection.Id, GameVersion(vars["game_version"]), vars["slug"])
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+}
+
+// shareCollectionHandler gives the collection a share code, keeping the existing one if it was already shared.
+func shareCollectionHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		collection := getCollectionForUser(store, w, r, userId, mux.Vars(r)["id"], true)
+		if collection == nil {
+			return
+		}
+
+		if collection.ShareCode == nil {
+			shareCode, err := generateShareCode()
+			if err != nil {
+				writeInternalError(w, r, err)
+				return
+			}
+			err = store.SetCollectionShareCode(collection.Id, &shareCode)
+			if err != nil {
+				writeInternalError(w, r, err)
+				return
+			}
+			collection.ShareCode = &shareCode
+		}
+
+		writeJson(w, toApiCollection(*collection))
+	}
+}
+
+// unshareCollectionHandler removes the share code of a collection, so its link stops working. The users
+// who already subscribed keep the collection. Sharing it again creates a new code.
+func unshareCollectionHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		collection := getCollectionForUser(store, w, r, userId, mux.Vars(r)["id"], true)
+		if collection == nil {
+			return
+		}
+
+		if collection.ShareCode != nil {
+			err := store.SetCollectionShareCode(collection.Id, nil)
+			if err != nil {
+				writeInternalError(w, r, err)
+				return
+			}
+			collection.ShareCode = nil
+		}
+
+		writeJson(w, toApiCollection(*collection))
+	}
+}
+
+// getSharedCollectionHandler lets anyone with the share link see the collection, without an account.
+func getSharedCollectionHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection, err := store.GetCollectionByShareCode(mux.Vars(r)["code"])
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+		writeJson(w, toApiCollection(*collection))
+	}
+}
+
+func subscribeToCollectionHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		collection, err := store.GetCollectionByShareCode(mux.Vars(r)["code"])
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+
+		// Owners already see their collections
+		if collection.UserId != userId {
+			err = store.SubscribeToCollection(userId, collection.Id)
+			if err != nil {
+				writeInternalError(w, r, err)
+				return
+			}
+		}
+
+		writeJson(w, toApiCollection(*collection))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"wowa-api"
+)
+
+func TestUnshareCollection(t *testing.T) {
+	server := newTestServer(t, newTestStore(t))
+	accessToken := register(t, server, "user@example.com")
+	otherAccessToken := register(t, server, "other@example.com")
+
+	var collection api.Collection
+	resp := doJson(t, server, "POST", "/collections", accessToken, api.CreateCollectionRequest{Name: "Raiding"}, &collection)
+	expectStatus(t, resp, http.StatusCreated)
+
+	var shared api.Collection
+	resp = doJson(t, server, "POST", "/collections/"+collection.Id+"/share", accessToken, nil, &shared)
+	expectStatus(t, resp, http.StatusOK)
+	if shared.ShareCode == nil {
+		t.Fatal("expected a share code")
+	}
+	shareCode := *shared.ShareCode
+	resp = doJson(t, server, "GET", "/shared/collections/"+shareCode, "", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	resp = doJson(t, server, "POST", "/shared/collections/"+shareCode+"/subscribe", otherAccessToken, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	// Only the owner can stop sharing
+	resp = doJson(t, server, "DELETE", "/collections/"+collection.Id+"/share", otherAccessToken, nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	var unshared api.Collection
+	resp = doJson(t, server, "DELETE", "/collections/"+collection.Id+"/share", accessToken, nil, &unshared)
+	expectStatus(t, resp, http.StatusOK)
+	if unshared.ShareCode != nil {
+		t.Fatalf("expected no share code, got %s", *unshared.ShareCode)
+	}
+	resp = doJson(t, server, "GET", "/shared/collections/"+shareCode, "", nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	// The subscribers keep the collection
+	resp = doJson(t, server, "GET", "/collections/"+collection.Id, otherAccessToken, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	// Sharing again creates a new code
+	resp = doJson(t, server, "POST", "/collections/"+collection.Id+"/share", accessToken, nil, &shared)
+	expectStatus(t, resp, http.StatusOK)
+	if shared.ShareCode == nil || *shared.ShareCode == shareCode {
+		t.Fatal("expected a new share code")
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config is the configuration of the server. Each setting is taken from its command line flag, else from its
+// environment variable, else from the JSON config file given by -config or CONFIG_FILE, else from its default.
+type Config struct {
+	Address string
+	// The key signing the session access tokens
+	JwtKey string
+	// Serve HTTPS when both are set
+	TlsCertFile string
+	TlsKeyFile  string
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// How long the server keeps serving after failing its readiness check on shutdown, so the load balancers
+	// stop sending it traffic before it closes its listener
+	ShutdownDrainDelay time.Duration
+	// How long the requests in progress are waited for on shutdown
+	ShutdownTimeout time.Duration
+
+	// "postgres" using PgDsn, or "sqlite" using SqlitePath
+	DbDriver   string
+	PgDsn      string
+	SqlitePath string
+
+	// "log", or "file" writing the mails to MailerDir
+	Mailer    string
+	MailerDir string
+	// Whether the log mailer also logs the bodies of the mails, with their reset and invitation codes
+	MailerLogBodies bool
+
+	// "memory", or "database" to share the login throttles between servers
+	RateLimitStore string
+	// Whether to take the client IP address from X-Forwarded-For, when running behind a reverse proxy
+	RateLimitTrustProxy bool
+	// The number of reverse proxies in front of the server, each appending to X-Forwarded-For
+	RateLimitProxyHops int
+
+	// "json" or "text"
+	LogFormat string
+
+	// The bearer token required to read /metrics, which is public when empty
+	MetricsToken string
+
+	// The provider keys shared by the users to resolve the latest addon releases, which is disabled when neither is set
+	CurseApiKey string
+	GithubToken string
+	// How long a resolved release is cached
+	ProviderCacheTtl time.Duration
+}
+
+func defaultConfig() Config {
+	return Config{
+		Address:            "0.0.0.0:8888",
+		ReadTimeout:        30 * time.Second,
+		ReadHeaderTimeout:  10 * time.Second,
+		WriteTimeout:       60 * time.Second,
+		IdleTimeout:        120 * time.Second,
+		ShutdownDrainDelay: 5 * time.Second,
+		ShutdownTimeout:    30 * time.Second,
+		DbDriver:           "postgres",
+		SqlitePath:         "wowa.db",
+		Mailer:             "log",
+		MailerDir:          "mails",
+		RateLimitStore:     "memory",
+		RateLimitProxyHops: 1,
+		LogFormat:          "json",
+		ProviderCacheTtl:   time.Hour,
+	}
+}
+
+// configSetting is a setting of the config, by its flag name which is also its key in the config file.
+type configSetting struct {
+	name  string
+	env   string
+	usage string
+	value flag.Value
+}
+
+func (c *Config) settings() []configSetting {
+	return []configSetting{
+		{"address", "ADDRESS", "the address to listen on", (*stringValue)(&c.Address)},
+		{"jwt-key", "JWT_KEY", "the key signing the access tokens (required)", (*stringValue)(&c.JwtKey)},
+		{"tls-cert-file", "TLS_CERT_FILE", "the TLS certificate file, to serve HTTPS", (*stringValue)(&c.TlsCertFile)},
+		{"tls-key-file", "TLS_KEY_FILE", "the TLS private key file, to serve HTTPS", (*stringValue)(&c.TlsKeyFile)},
+		{"read-timeout", "READ_TIMEOUT", "the maximum duration to read a request", (*durationValue)(&c.ReadTimeout)},
+		{"read-header-timeout", "READ_HEADER_TIMEOUT", "the maximum duration to read the headers of a request", (*durationValue)(&c.ReadHeaderTimeout)},
+		{"write-timeout", "WRITE_TIMEOUT", "the maximum duration to write a response", (*durationValue)(&c.WriteTimeout)},
+		{"idle-timeout", "IDLE_TIMEOUT", "the maximum duration to keep an idle connection open", (*durationValue)(&c.IdleTimeout)},
+		{"shutdown-drain-delay", "SHUTDOWN_DRAIN_DELAY", "how long to keep serving once not ready on shutdown, zero to stop at once", (*durationValue)(&c.ShutdownDrainDelay)},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "the maximum duration to wait for the requests in progress on shutdown", (*durationValue)(&c.ShutdownTimeout)},
+		{"db-driver", "DB_DRIVER", "the database driver, postgres or sqlite", (*stringValue)(&c.DbDriver)},
+		{"pg-dsn", "PG_DSN", "the PostgreSQL connection string", (*stringValue)(&c.PgDsn)},
+		{"sqlite-path", "SQLITE_PATH", "the SQLite database file", (*stringValue)(&c.SqlitePath)},
+		{"mailer", "MAILER", "the mailer, log or file", (*stringValue)(&c.Mailer)},
+		{"mailer-dir", "MAILER_DIR", "the directory of the file mailer", (*stringValue)(&c.MailerDir)},
+		{"mailer-log-bodies", "MAILER_LOG_BODIES", "log the bodies of the mails with their codes, for local development only", (*boolValue)(&c.MailerLogBodies)},
+		{"rate-limit-store", "RATE_LIMIT_STORE", "where the login throttles are kept, memory or database", (*stringValue)(&c.RateLimitStore)},
+		{"rate-limit-trust-proxy", "RATE_LIMIT_TRUST_PROXY", "take the client IP address from X-Forwarded-For", (*boolValue)(&c.RateLimitTrustProxy)},
+		{"rate-limit-proxy-hops", "RATE_LIMIT_PROXY_HOPS", "the number of reverse proxies appending to X-Forwarded-For", (*intValue)(&c.RateLimitProxyHops)},
+		{"log-format", "LOG_FORMAT", "the format of the logs, json or text", (*stringValue)(&c.LogFormat)},
+		{"metrics-token", "METRICS_TOKEN", "the bearer token required to read the metrics, public when empty", (*stringValue)(&c.MetricsToken)},
+		{"curse-api-key", "CURSE_API_KEY", "the CurseForge API key used to resolve the addon releases", (*stringValue)(&c.CurseApiKey)},
+		{"github-token", "GITHUB_TOKEN", "the GitHub token used to resolve the addon releases", (*stringValue)(&c.GithubToken)},
+		{"provider-cache-ttl", "PROVIDER_CACHE_TTL", "how long a resolved addon release is cached", (*durationValue)(&c.ProviderCacheTtl)},
+	}
+}
+
+// loadConfig reads the config from the command line arguments, the environment and the config file,
+// and returns the arguments left after the flags.
+func loadConfig(args []string) (Config, []string, error) {
+	config := defaultConfig()
+	settings := config.settings()
+
+	flags := flag.NewFlagSet("wowa-server", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "the JSON config file, keyed by the flag names")
+	for _, setting := range settings {
+		usage := fmt.Sprintf("%s (%s)", setting.usage, setting.env)
+		if _, ok := setting.value.(*boolValue); ok {
+			flags.Bool(setting.name, false, usage)
+		} else {
+			flags.String(setting.name, setting.value.String(), usage)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	if *configFile != "" {
+		if err := config.loadFile(*configFile, settings); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	for _, setting := range settings {
+		if value := os.Getenv(setting.env); value != "" {
+			if err := setting.value.Set(value); err != nil {
+				return Config{}, nil, fmt.Errorf("invalid %s: %w", setting.env, err)
+			}
+		}
+	}
+
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		for _, setting := range settings {
+			if err == nil && setting.name == f.Name {
+				if setErr := setting.value.Set(f.Value.String()); setErr != nil {
+					err = fmt.Errorf("invalid -%s: %w", f.Name, setErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	return config, flags.Args(), nil
+}
+
+// loadFile sets the settings found in a JSON config file, like {"address": "0.0.0.0:443", "read-timeout": "1m"}.
+func (c *Config) loadFile(path string, settings []configSetting) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read the config file: %w", err)
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse the config file %s: %w", path, err)
+	}
+
+	for name, raw := range values {
+		var setting *configSetting
+		for i := range settings {
+			if settings[i].name == name {
+				setting = &settings[i]
+			}
+		}
+		if setting == nil {
+			return fmt.Errorf("unknown setting in the config file %s: %s", path, name)
+		}
+
+		// The strings are unquoted, the booleans and the numbers are kept as they are
+		value := string(raw)
+		var unquoted string
+		if json.Unmarshal(raw, &unquoted) == nil {
+			value = unquoted
+		}
+		if err := setting.value.Set(value); err != nil {
+			return fmt.Errorf("invalid %s in the config file %s: %w", name, path, err)
+		}
+	}
+	return nil
+}
+
+// validateDatabase checks the settings needed to open the store, which is all the migrate command needs.
+func (c *Config) validateDatabase() error {
+	switch c.DbDriver {
+	case "postgres", "sqlite":
+	default:
+		return fmt.Errorf("unsupported database driver: %s", c.DbDriver)
+	}
+	if c.DbDriver == "sqlite" && c.SqlitePath == "" {
+		return errors.New("the SQLite database file is required")
+	}
+	return nil
+}
+
+// Validate checks the settings needed to serve, so a misconfigured server does not start.
+func (c *Config) Validate() error {
+	if err := c.validateDatabase(); err != nil {
+		return err
+	}
+
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	if c.JwtKey == "" {
+		return errors.New("the JWT key is required, set JWT_KEY or -jwt-key")
+	}
+	if len(c.JwtKey) < 32 {
+		slog.Warn("The JWT key is shorter than 32 bytes, which is weak for HS256")
+	}
+	if (c.TlsCertFile == "") != (c.TlsKeyFile == "") {
+		return errors.New("the TLS certificate and key files must be set together")
+	}
+
+	timeouts := map[string]time.Duration{
+		"read timeout": c.ReadTimeout, "read header timeout": c.ReadHeaderTimeout,
+		"write timeout": c.WriteTimeout, "idle timeout": c.IdleTimeout, "shutdown drain delay": c.ShutdownDrainDelay,
+	}
+	for name, timeout := range timeouts {
+		if timeout < 0 {
+			return fmt.Errorf("the %s cannot be negative", name)
+		}
+	}
+	if c.ShutdownTimeout <= 0 {
+		return errors.New("the shutdown timeout must be positive")
+	}
+	if c.RateLimitProxyHops < 1 {
+		return errors.New("the number of rate limit proxy hops must be at least 1")
+	}
+	if c.ProviderCacheTtl <= 0 {
+		return errors.New("the provider cache TTL must be positive")
+	}
+
+	switch c.Mailer {
+	case "log":
+	case "file":
+		if c.MailerDir == "" {
+			return errors.New("the mailer directory is required by the file mailer")
+		}
+	default:
+		return fmt.Errorf("unsupported mailer: %s", c.Mailer)
+	}
+	switch c.RateLimitStore {
+	case "memory", "database":
+	default:
+		return fmt.Errorf("unsupported rate limit store: %s", c.RateLimitStore)
+	}
+	switch c.LogFormat {
+	case "json", "text":
+	default:
+		return fmt.Errorf("unsupported log format: %s", c.LogFormat)
+	}
+	return nil
+}
+
+// The flag values setting the fields of the config
+type (
+	stringValue   string
+	boolValue     bool
+	intValue      int
+	durationValue time.Duration
+)
+
+func (v *stringValue) String() string {
+	return string(*v)
+}
+
+func (v *stringValue) Set(value string) error {
+	*v = stringValue(value)
+	return nil
+}
+
+func (v *boolValue) String() string {
+	return strconv.FormatBool(bool(*v))
+}
+
+func (v *boolValue) Set(value string) error {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*v = boolValue(parsed)
+	return nil
+}
+
+func (v *intValue) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+func (v *intValue) Set(value string) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*v = intValue(parsed)
+	return nil
+}
+
+func (v *durationValue) String() string {
+	return time.Duration(*v).String()
+}
+
+func (v *durationValue) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*v = durationValue(parsed)
+	return nil
+}
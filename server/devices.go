@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wowa-api"
+)
+
+// Device is a machine running wowa, registered when the user logs in on it.
+type Device struct {
+	Id         string        `gorm:"primarykey;not null" json:"id"`
+	UserId     string        `gorm:"uniqueIndex:idx_unique_user_device;not null" json:"user_id"`
+	Name       string        `gorm:"uniqueIndex:idx_unique_user_device;not null" json:"name"`
+	Platform   string        `gorm:"not null" json:"platform"`
+	LastSeenAt time.Time     `gorm:"not null" json:"last_seen_at"`
+	CreatedAt  time.Time     `gorm:"not null" json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	Addons     []DeviceAddon `json:"addons"`
+	User       User          `json:"-"`
+}
+
+// DeviceAddon is an addon installed on a device, as last reported by it.
+type DeviceAddon struct {
+	DeviceId    string      `gorm:"primarykey;not null" json:"-"`
+	GameVersion GameVersion `gorm:"primarykey;not null" json:"game_version"`
+	Slug        string      `gorm:"primarykey;not null" json:"slug"`
+	Version     string      `gorm:"not null" json:"version"`
+	ReportedAt  time.Time   `gorm:"not null" json:"reported_at"`
+}
+
+// toApiDevice returns the device as sent to the clients.
+func toApiDevice(device Device) api.Device {
+	addons := []api.DeviceAddon{}
+	for _, addon := range device.Addons {
+		addons = append(addons, api.DeviceAddon{GameVersion: addon.GameVersion, Slug: addon.Slug, Version: addon.Version, ReportedAt: addon.ReportedAt})
+	}
+	return api.Device{
+		Id:         device.Id,
+		UserId:     device.UserId,
+		Name:       device.Name,
+		Platform:   device.Platform,
+		LastSeenAt: device.LastSeenAt,
+		Addons:     addons,
+		CreatedAt:  device.CreatedAt,
+		UpdatedAt:  device.UpdatedAt,
+	}
+}
+
+func toApiDevices(devices []Device) []api.Device {
+	apiDevices := []api.Device{}
+	for _, device := range devices {
+		apiDevices = append(apiDevices, toApiDevice(device))
+	}
+	return apiDevices
+}
+
+// registerDeviceHandler registers a device by its name, or returns the device already registered with that name.
+func registerDeviceHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var registerRequest api.RegisterDeviceRequest
+		if err := json.NewDecoder(r.Body).Decode(&registerRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(registerRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		device := Device{
+			Id:         "device_" + uuid.New().String(),
+			UserId:     userId,
+			Name:       registerRequest.Name,
+			Platform:   registerRequest.Platform,
+			LastSeenAt: time.Now(),
+		}
+		err := store.SaveDevice(&device)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		writeJson(w, toApiDevice(device))
+	}
+}
+
+// getDevicesHandler returns the devices of the user, with the addons installed on each of them.
+func getDevicesHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		devices, err := store.GetDevices(userId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		writeJson(w, toApiDevices(devices))
+	}
+}
+
+// reportDeviceAddonsHandler replaces the addons installed on the device with the reported ones.
+func reportDeviceAddonsHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var reportRequest api.ReportDeviceAddonsRequest
+		if err := json.NewDecoder(r.Body).Decode(&reportRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(reportRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		device, err := store.GetDevice(userId, mux.Vars(r)["id"])
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+
+		now := time.Now()
+		addons := []DeviceAddon{}
+		for _, report := range reportRequest.Addons {
+			addons = append(addons, DeviceAddon{
+				DeviceId: device.Id, GameVersion: report.GameVersion, Slug: report.Slug, Version: report.Version, ReportedAt: now,
+			})
+		}
+		err = store.ReplaceDeviceAddons(device.Id, addons)
+		if err != nil {
+			if err == ErrDuplicate {
+				writeError(w, r, http.StatusBadRequest, api.ErrorCodeBadRequest, "Bad request (duplicated addon)")
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+		device.Addons = addons
+		writeJson(w, toApiDevice(*device))
+	}
+}
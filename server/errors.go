@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"wowa-api"
+)
+
+func writeJson(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		slog.Error("Failed to write the response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code api.ErrorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(api.ErrorResponse{Code: code, Message: message, RequestId: getRequestId(r)})
+}
+
+// writeInternalError logs the error with the request, and hides it from the client.
+func writeInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "Request failed", "error", err)
+	writeError(w, r, http.StatusInternalServerError, api.ErrorCodeInternal, "Internal server error")
+}
+
+func writeBadRequest(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusBadRequest, api.ErrorCodeBadRequest, "Bad request")
+}
+
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, http.StatusBadRequest, api.ErrorCodeValidationFailed, "Validation failed: "+err.Error())
+}
+
+func writeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, api.ErrorCodeNotFound, "Not found error")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+type HealthStatus string
+
+const (
+	HealthStatusUp   HealthStatus = "up"
+	HealthStatusDown HealthStatus = "down"
+)
+
+type HealthResponse struct {
+	// The server is up whenever it answers
+	Status   HealthStatus `json:"status"`
+	Database HealthStatus `json:"database"`
+	// Whether the server accepts traffic: it is not shutting down and its database is up
+	Ready bool `json:"ready"`
+}
+
+func getHealth(store Store, ready *atomic.Bool) HealthResponse {
+	health := HealthResponse{Status: HealthStatusUp, Database: HealthStatusUp}
+	if err := store.Ping(); err != nil {
+		slog.Warn("The database is unreachable", "error", err)
+		health.Database = HealthStatusDown
+	}
+	health.Ready = ready.Load() && health.Database == HealthStatusUp
+	return health
+}
+
+func writeHealth(w http.ResponseWriter, r *http.Request, status int, health HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write the response", "error", err)
+	}
+}
+
+// healthHandler is the liveness check, it succeeds whenever the server answers and reports its database and readiness.
+func healthHandler(store Store, ready *atomic.Bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, r, http.StatusOK, getHealth(store, ready))
+	}
+}
+
+// readinessHandler is the readiness check, it fails while the database is down or the server is shutting down.
+func readinessHandler(store Store, ready *atomic.Bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		health := getHealth(store, ready)
+		status := http.StatusOK
+		if !health.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeHealth(w, r, status, health)
+	}
+}
+
+// getReadinessUrl returns the URL of the readiness check of the server listening on the configured address,
+// reached through the loopback interface when it listens on every interface.
+func getReadinessUrl(config Config) (string, error) {
+	host, port, err := net.SplitHostPort(config.Address)
+	if err != nil {
+		return "", fmt.Errorf("invalid address: %w", err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	scheme := "http"
+	if config.TlsCertFile != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + "/health/ready", nil
+}
+
+// runHealthcheckCommand runs the "healthcheck" subcommand, for container health checks, and returns the
+// process exit code: 0 when the server is ready, 1 otherwise.
+func runHealthcheckCommand(config Config) int {
+	url, err := getReadinessUrl(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		// The certificate names the public host of the server, not the local address it is checked on
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintln(os.Stderr, "Not ready:", resp.Status)
+		return 1
+	}
+	return 0
+}
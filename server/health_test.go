@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestGetReadinessUrl(t *testing.T) {
+	tests := []struct {
+		address     string
+		tlsCertFile string
+		expected    string
+	}{
+		{"0.0.0.0:8888", "", "http://localhost:8888/health/ready"},
+		{":9000", "", "http://localhost:9000/health/ready"},
+		{"[::]:8443", "cert.pem", "https://localhost:8443/health/ready"},
+		{"127.0.0.1:8888", "", "http://127.0.0.1:8888/health/ready"},
+		{"[::1]:8888", "", "http://[::1]:8888/health/ready"},
+	}
+	for _, test := range tests {
+		config := defaultConfig()
+		config.Address = test.address
+		config.TlsCertFile = test.tlsCertFile
+		url, err := getReadinessUrl(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.address, test.expected, url)
+		}
+	}
+}
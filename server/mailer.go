@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers the emails sent by the server, like password reset codes.
+type Mailer interface {
+	Send(message MailMessage) error
+}
+
+// LogMailer writes the emails to the server log, for local development.
+// The bodies hold secret codes, so they are only logged when asked for.
+type LogMailer struct {
+	logBodies bool
+}
+
+func (m *LogMailer) Send(message MailMessage) error {
+	if m.logBodies {
+		slog.Info("Mail", "to", message.To, "subject", message.Subject, "body", message.Body)
+	} else {
+		slog.Info("Mail", "to", message.To, "subject", message.Subject)
+	}
+	return nil
+}
+
+// FileMailer writes each email to its own file in a directory, for local development.
+type FileMailer struct {
+	dir string
+}
+
+func (m *FileMailer) Send(message MailMessage) error {
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), strings.ReplaceAll(message.To, "@", "_at_"))
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s\r\n", message.To, message.Subject, message.Body)
+	return os.WriteFile(filepath.Join(m.dir, fileName), []byte(content), 0600)
+}
+
+// newMailerFromConfig creates the configured mailer, "log" or "file".
+func newMailerFromConfig(config Config) (Mailer, error) {
+	switch config.Mailer {
+	case "log":
+		slog.Warn("The log mailer does not deliver the mails, use it for local development only")
+		return &LogMailer{logBodies: config.MailerLogBodies}, nil
+	case "file":
+		return &FileMailer{dir: config.MailerDir}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mailer: %s", config.Mailer)
+	}
+}
@@ -1,21 +1,29 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+
+	"wowa-api"
 )
 
 // Database structs
@@ -27,18 +35,23 @@ type User struct {
 	UpdatedAt time.Time
 }
 
-type GameVersion string
+// The enums of the API are stored as they are
+type (
+	GameVersion = api.GameVersion
+	Provider    = api.Provider
+	Channel     = api.Channel
+)
 
 const (
-	Retail  GameVersion = "retail"
-	Classic GameVersion = "classic"
-)
+	Retail  = api.Retail
+	Classic = api.Classic
 
-type Provider string
+	Curse  = api.Curse
+	Github = api.Github
 
-const (
-	Curse  Provider = "curse"
-	Github Provider = "github"
+	ChannelRelease = api.ChannelRelease
+	ChannelBeta    = api.ChannelBeta
+	ChannelAlpha   = api.ChannelAlpha
 )
 
 type Addon struct {
@@ -51,9 +64,47 @@ type Addon struct {
 	Provider    Provider    `gorm:"not null" json:"provider"`
 	ExternalId  string      `gorm:"not null" json:"external_id"`
 	Url         string      `gorm:"not null" json:"url"`
-	CreatedAt   time.Time   `gorm:"not null" json:"created_at"`
-	UpdatedAt   time.Time   `gorm:"not null" json:"updated_at"`
-	User        User        `json:"-"`
+	Version     string      `gorm:"not null;default:''" json:"version"`
+	FileId      string      `gorm:"not null;default:''" json:"file_id"`
+	Channel     Channel     `gorm:"not null;default:'release'" json:"channel"`
+	Pinned      bool        `gorm:"not null;default:false" json:"pinned"`
+	Directories []string    `gorm:"serializer:json;type:text;not null;default:'[]'" json:"directories"`
+	// DeviceId scopes the addon to one device, it is installed on all the devices when nil
+	DeviceId *string `gorm:"index" json:"device_id"`
+	// OrganizationId is the organization requiring the addon when it was installed for it, nil when the user added it
+	OrganizationId *string `json:"organization_id"`
+	// Revision is bumped on every change, and is the ETag of the addon
+	Revision  int       `gorm:"not null;default:1" json:"revision"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null" json:"updated_at"`
+	User      User      `json:"-"`
+}
+
+// AddonChange is an entry of the change feed, written whenever an addon is saved or deleted.
+// Its cursor, given to the clients, counts the changes of the user.
+type AddonChange struct {
+	Id          int64       `gorm:"primarykey;autoIncrement"`
+	UserId      string      `gorm:"uniqueIndex:idx_unique_addon_change_cursor,priority:1;not null"`
+	Cursor      int64       `gorm:"uniqueIndex:idx_unique_addon_change_cursor,priority:2;not null"`
+	GameVersion GameVersion `gorm:"not null"`
+	Slug        string      `gorm:"not null"`
+	Deleted     bool        `gorm:"not null"`
+	CreatedAt   time.Time   `gorm:"not null"`
+}
+
+// AddonChangeCounter holds the cursor of the last change of the addons of a user. Its row stays locked until
+// the change is committed, so the changes of a user are committed in the order of their cursors.
+type AddonChangeCounter struct {
+	UserId     string `gorm:"primarykey;not null"`
+	LastCursor int64  `gorm:"not null"`
+	User       User
+}
+
+// AddonChanges holds the latest state of every addon changed after a cursor.
+type AddonChanges struct {
+	Cursor  int64
+	Addons  []Addon
+	Deleted []api.DeletedAddon
 }
 
 // Request structs
@@ -62,264 +113,595 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required,min=4"`
 }
 
-type AddAddonRequest struct {
-	GameVersion GameVersion `json:"game_version" validate:"required,oneof=retail classic"`
-	Slug        string      `json:"slug" validate:"required"`
-	Name        string      `json:"name" validate:"required"`
-	Author      string      `json:"author" validate:"required"`
-	Provider    Provider    `json:"provider" validate:"required,oneof=curse github"`
-	ExternalId  string      `json:"external_id" validate:"required"`
-	Url         string      `json:"url" validate:"required,url"`
+type RegisterRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=4"`
+}
+
+func newAddon(userId string, gameVersion GameVersion, slug string, putAddonRequest api.PutAddonRequest) Addon {
+	channel := putAddonRequest.Channel
+	if channel == "" {
+		channel = ChannelRelease
+	}
+	directories := putAddonRequest.Directories
+	if directories == nil {
+		directories = []string{}
+	}
+
+	return Addon{
+		Id:             "addon_" + uuid.New().String(),
+		UserId:         userId,
+		GameVersion:    gameVersion,
+		Slug:           slug,
+		Name:           putAddonRequest.Name,
+		Author:         putAddonRequest.Author,
+		Provider:       putAddonRequest.Provider,
+		ExternalId:     putAddonRequest.ExternalId,
+		Url:            putAddonRequest.Url,
+		Version:        putAddonRequest.Version,
+		FileId:         putAddonRequest.FileId,
+		Channel:        channel,
+		Pinned:         putAddonRequest.Pinned,
+		Directories:    directories,
+		DeviceId:       putAddonRequest.DeviceId,
+		OrganizationId: putAddonRequest.OrganizationId,
+	}
+}
+
+// toApiAddon returns the addon as sent to the clients.
+func toApiAddon(addon Addon) api.Addon {
+	return api.Addon{
+		Id:             addon.Id,
+		UserId:         addon.UserId,
+		GameVersion:    addon.GameVersion,
+		Slug:           addon.Slug,
+		Name:           addon.Name,
+		Author:         addon.Author,
+		Provider:       addon.Provider,
+		ExternalId:     addon.ExternalId,
+		Url:            addon.Url,
+		Version:        addon.Version,
+		FileId:         addon.FileId,
+		Channel:        addon.Channel,
+		Pinned:         addon.Pinned,
+		Directories:    addon.Directories,
+		DeviceId:       addon.DeviceId,
+		OrganizationId: addon.OrganizationId,
+		Revision:       addon.Revision,
+		CreatedAt:      addon.CreatedAt,
+		UpdatedAt:      addon.UpdatedAt,
+	}
+}
+
+func toApiAddons(addons []Addon) []api.Addon {
+	apiAddons := []api.Addon{}
+	for _, addon := range addons {
+		apiAddons = append(apiAddons, toApiAddon(addon))
+	}
+	return apiAddons
+}
+
+// normalizeEmail lowercases and trims an email, so an address always matches the same account and invitations
+// whatever its case.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
-func loginHandler(db *gorm.DB, validate *validator.Validate) http.HandlerFunc {
+func registerHandler(store Store, validate *validator.Validate, jwtKey []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var registerRequest RegisterRequest
+		if err := json.NewDecoder(r.Body).Decode(&registerRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(registerRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		userId := "user_" + uuid.New().String()
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(registerRequest.Password), bcrypt.DefaultCost)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		user := User{Id: userId, Email: normalizeEmail(registerRequest.Email), Password: string(hashedPassword)}
+		err = store.CreateUser(&user)
+		if err != nil {
+			if err == ErrDuplicate {
+				writeError(w, r, http.StatusConflict, api.ErrorCodeEmailTaken, "Email already registered")
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+
+		createSession(store, jwtKey, w, r, user)
+	}
+}
+
+// unknownUserPasswordHash is compared to the password of the logins to unknown accounts.
+var unknownUserPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("unknown user"), bcrypt.DefaultCost)
+
+func loginHandler(store Store, validate *validator.Validate, jwtKey []byte) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var loginRequest LoginRequest
 		if err := json.NewDecoder(r.Body).Decode(&loginRequest); err != nil {
-			http.Error(w, "Bad request", http.StatusBadRequest)
+			writeBadRequest(w, r)
 			return
 		}
 		if err := validate.Struct(loginRequest); err != nil {
-			http.Error(w, fmt.Sprintf("Validation failed: %v", err), http.StatusBadRequest)
+			writeValidationError(w, r, err)
 			return
 		}
 
-		var user User
-		result := db.First(&user, "email = ?", loginRequest.Email)
-		if result.Error != nil {
-			if result.Error != gorm.ErrRecordNotFound {
-				log.Println("Error", result.Error)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+		user, err := store.GetUserByEmail(normalizeEmail(loginRequest.Email))
+		if err != nil {
+			if err == ErrNotFound {
+				// Takes as long as a wrong password, so the response time does not tell whether the account exists
+				_ = bcrypt.CompareHashAndPassword(unknownUserPasswordHash, []byte(loginRequest.Password))
+				writeError(w, r, http.StatusUnauthorized, api.ErrorCodeInvalidCredentials, "Invalid email or password")
 				return
 			}
+			writeInternalError(w, r, err)
+			return
+		}
 
-			log.Println("Creating new user")
-			userId := "user_" + uuid.New().String()
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(loginRequest.Password), bcrypt.DefaultCost)
-			if err != nil {
-				log.Println("Error", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
-			user = User{Id: userId, Email: loginRequest.Email, Password: string(hashedPassword)}
-			result := db.Create(&user)
-			if result.Error != nil {
-				log.Println("Error", result.Error)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginRequest.Password))
+		if err != nil {
+			writeError(w, r, http.StatusUnauthorized, api.ErrorCodeInvalidCredentials, "Invalid email or password")
+			return
+		}
+
+		createSession(store, jwtKey, w, r, *user)
+	}
+}
+
+// parseIfMatch returns the revision required by the If-Match header, or nil if there is none.
+func parseIfMatch(r *http.Request) (*int, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		return nil, nil
+	}
+	revision, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`))
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+func setAddonETag(w http.ResponseWriter, addon *Addon) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, addon.Revision))
+}
+
+// saveAddon creates or updates the addon, honoring If-Match, and writes the stored record.
+func saveAddon(store Store, w http.ResponseWriter, r *http.Request, addon Addon) {
+	expectedRevision, err := parseIfMatch(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, api.ErrorCodeBadRequest, "Bad request (invalid If-Match header)")
+		return
+	}
+
+	if addon.DeviceId != nil {
+		_, err := store.GetDevice(addon.UserId, *addon.DeviceId)
+		if err != nil {
+			if err == ErrNotFound {
+				writeError(w, r, http.StatusBadRequest, api.ErrorCodeValidationFailed, "Validation failed: unknown device")
 				return
 			}
-		} else {
-			log.Println("User already exists")
-			err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginRequest.Password))
-			if err != nil {
-				http.Error(w, "Invalid password", http.StatusBadRequest)
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+	if addon.OrganizationId != nil {
+		_, err := store.GetOrganizationMember(*addon.OrganizationId, addon.UserId)
+		if err != nil {
+			if err == ErrNotFound {
+				writeError(w, r, http.StatusBadRequest, api.ErrorCodeValidationFailed, "Validation failed: unknown organization")
 				return
 			}
+			writeInternalError(w, r, err)
+			return
 		}
+	}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"sub":   user.Id,
-			"exp":   time.Now().AddDate(1, 0, 0).Unix(),
-			"email": user.Email,
-		})
-		tokenString, err := token.SignedString([]byte(os.Getenv("JWT_KEY")))
-		if err != nil {
-			log.Println("Error", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+	status, err := store.SaveAddon(&addon, expectedRevision)
+	if err != nil {
+		if err == ErrConflict {
+			writeError(w, r, http.StatusPreconditionFailed, api.ErrorCodeRevisionMismatch, "The addon was modified by someone else")
 			return
 		}
-		w.Write([]byte(tokenString))
+		writeInternalError(w, r, err)
+		return
 	}
-}
 
-func getUserIdFromRequest(w http.ResponseWriter, r *http.Request) string {
-	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-	if len(tokenString) == 0 {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return ""
+	setAddonETag(w, &addon)
+	w.Header().Set("Content-Type", "application/json")
+	if status == SaveStatusCreated {
+		w.WriteHeader(http.StatusCreated)
 	}
-	parsedToken, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		// Ensure the token's signing method is what you expect
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(os.Getenv("JWT_KEY")), nil
-	})
-	if err != nil || !parsedToken.Valid {
-		log.Println("Error", err, parsedToken.Valid)
-		http.Error(w, "Unauthorized (invalid token)", http.StatusUnauthorized)
-		return ""
-	}
-	userId, err := parsedToken.Claims.GetSubject()
+	err = json.NewEncoder(w).Encode(toApiAddon(addon))
 	if err != nil {
-		log.Println("Error", err)
-		http.Error(w, "Unauthorized (invalid token)", http.StatusUnauthorized)
-		return ""
+		slog.ErrorContext(r.Context(), "Failed to write the response", "error", err)
 	}
-	return userId
 }
 
-func createAddonHandler(db *gorm.DB, validate *validator.Validate) http.HandlerFunc {
+func createAddonHandler(store Store, validate *validator.Validate) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userId := getUserIdFromRequest(w, r)
-		if len(userId) == 0 {
-			return
-		}
+		userId := getUserId(r)
 
-		var addAddonRequest AddAddonRequest
+		var addAddonRequest api.AddAddonRequest
 		if err := json.NewDecoder(r.Body).Decode(&addAddonRequest); err != nil {
-			http.Error(w, "Bad request", http.StatusBadRequest)
+			writeBadRequest(w, r)
 			return
 		}
 		if err := validate.Struct(addAddonRequest); err != nil {
-			http.Error(w, fmt.Sprintf("Validation failed: %v", err), http.StatusBadRequest)
+			writeValidationError(w, r, err)
 			return
 		}
 
-		addonId := "addon_" + uuid.New().String()
-		addon := Addon{
-			Id:          addonId,
-			UserId:      userId,
-			GameVersion: addAddonRequest.GameVersion,
-			Slug:        addAddonRequest.Slug,
-			Name:        addAddonRequest.Name,
-			Author:      addAddonRequest.Author,
-			Provider:    addAddonRequest.Provider,
-			ExternalId:  addAddonRequest.ExternalId,
-			Url:         addAddonRequest.Url,
+		saveAddon(store, w, r, newAddon(userId, addAddonRequest.GameVersion, addAddonRequest.Slug, addAddonRequest.PutAddonRequest))
+	}
+}
+
+func getAddonsHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		addons, err := store.GetAddons(userId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
 		}
-		result := db.Create(&addon)
-		if result.Error != nil {
-			if result.Error == gorm.ErrDuplicatedKey {
-				// TODO: Check if everything is the same and not throw?
-				http.Error(w, "Addon already exists", http.StatusConflict)
-				return
+
+		// Only keep the addons to install on the given device
+		if deviceId := r.URL.Query().Get("device_id"); deviceId != "" {
+			deviceAddons := []Addon{}
+			for _, addon := range addons {
+				if addon.DeviceId == nil || *addon.DeviceId == deviceId {
+					deviceAddons = append(deviceAddons, addon)
+				}
 			}
-			log.Println("Error", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
+			addons = deviceAddons
 		}
-		err := json.NewEncoder(w).Encode(&addon)
+		err = json.NewEncoder(w).Encode(toApiAddons(addons))
 		if err != nil {
-			log.Println("Error", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeInternalError(w, r, err)
 			return
 		}
 	}
+
 }
 
-func getAddonsHandler(db *gorm.DB) http.HandlerFunc {
+func getAddonHandler(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userId := getUserIdFromRequest(w, r)
-		if len(userId) == 0 {
-			return
-		}
+		userId := getUserId(r)
+
+		vars := mux.Vars(r)
+		gameVersion := GameVersion(vars["game_version"])
+		slug := vars["slug"]
 
-		var addons []Addon
-		result := db.Where("user_id = ?", userId).Find(&addons)
-		if result.Error != nil {
-			log.Println("Error", result.Error)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		addon, err := store.GetAddon(userId, gameVersion, slug)
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
 			return
 		}
-		log.Println(addons)
-		err := json.NewEncoder(w).Encode(&addons)
+		setAddonETag(w, addon)
+		err = json.NewEncoder(w).Encode(toApiAddon(*addon))
 		if err != nil {
-			log.Println("Error", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeInternalError(w, r, err)
 			return
 		}
 	}
-
 }
 
-func getAddonHandler(db *gorm.DB) http.HandlerFunc {
+// putAddonHandler creates the addon, or replaces it with what is currently installed.
+// Like POST /addons, it only fails on a real conflict, when If-Match does not match the stored revision.
+func putAddonHandler(store Store, validate *validator.Validate) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userId := getUserIdFromRequest(w, r)
-		if len(userId) == 0 {
-			return
-		}
+		userId := getUserId(r)
 
 		vars := mux.Vars(r)
-		gameVersion := vars["game_version"]
+		gameVersion := GameVersion(vars["game_version"])
 		slug := vars["slug"]
+		if err := validate.Var(gameVersion, "oneof=retail classic"); err != nil {
+			writeNotFound(w, r)
+			return
+		}
 
-		var addon Addon
-		result := db.Where("user_id = ? AND game_version = ? AND slug = ?", userId, gameVersion, slug).First(&addon)
-		if result.Error != nil {
-			if result.Error == gorm.ErrRecordNotFound {
-				http.Error(w, "Not found error", http.StatusNotFound)
-				return
-			}
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		var putAddonRequest api.PutAddonRequest
+		if err := json.NewDecoder(r.Body).Decode(&putAddonRequest); err != nil {
+			writeBadRequest(w, r)
 			return
 		}
-		err := json.NewEncoder(w).Encode(&addon)
-		if err != nil {
-			log.Println("Error", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		if err := validate.Struct(putAddonRequest); err != nil {
+			writeValidationError(w, r, err)
 			return
 		}
+
+		saveAddon(store, w, r, newAddon(userId, gameVersion, slug, putAddonRequest))
 	}
 }
 
-func deleteAddonHandler(db *gorm.DB) http.HandlerFunc {
+// getAddonChangesHandler returns the addons saved and deleted after the cursor, so clients only fetch deltas.
+func getAddonChangesHandler(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userId := getUserIdFromRequest(w, r)
-		if len(userId) == 0 {
+		userId := getUserId(r)
+
+		var cursor int64
+		if rawCursor := r.URL.Query().Get("cursor"); rawCursor != "" {
+			var err error
+			cursor, err = strconv.ParseInt(rawCursor, 10, 64)
+			if err != nil || cursor < 0 {
+				writeError(w, r, http.StatusBadRequest, api.ErrorCodeBadRequest, "Bad request (invalid cursor)")
+				return
+			}
+		}
+
+		changes, err := store.GetAddonChanges(userId, cursor)
+		if err != nil {
+			writeInternalError(w, r, err)
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(api.AddonChanges{
+			Cursor:  changes.Cursor,
+			Addons:  toApiAddons(changes.Addons),
+			Deleted: changes.Deleted,
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to write the response", "error", err)
+		}
+	}
+}
+
+func deleteAddonHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
 
 		vars := mux.Vars(r)
-		gameVersion := vars["game_version"]
+		gameVersion := GameVersion(vars["game_version"])
 		slug := vars["slug"]
 
-		result := db.Where("user_id = ? AND game_version = ? AND slug = ?", userId, gameVersion, slug).Delete(&Addon{})
-		if result.Error != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		if result.RowsAffected == 0 {
-			http.Error(w, "Not found error", http.StatusNotFound)
+		err := store.DeleteAddon(userId, gameVersion, slug)
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
 			return
 		}
 	}
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Healthy"))
+// openApiHandler serves the OpenAPI document of the API.
+func openApiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(api.OpenAPI); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write the response", "error", err)
+	}
+}
+
+// newRouter creates the components of the routes from the config, and registers the routes.
+func newRouter(config Config, store Store, ready *atomic.Bool) (*mux.Router, error) {
+	jwtKey := []byte(config.JwtKey)
+
+	// Create the json validator
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	// Create the mailer
+	mailer, err := newMailerFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the login and password reset rate limiters
+	loginLimiter, passwordResetLimiter, err := newLimitersFromConfig(config, store)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the metrics
+	metrics, err := NewMetrics(store)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the addon resolver, nil when the server has no provider key
+	addonResolver := newAddonResolverFromConfig(config, store)
+
+	// Setup the routes
+	middlewares := []mux.MiddlewareFunc{requestIdMiddleware, accessLogMiddleware, metrics.middleware, recoveryMiddleware}
+	r := mux.NewRouter()
+	r.Use(middlewares...)
+	r.NotFoundHandler = withMiddlewares(http.HandlerFunc(writeNotFound), middlewares...)
+	r.MethodNotAllowedHandler = withMiddlewares(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusMethodNotAllowed, api.ErrorCodeMethodNotAllowed, "Method not allowed")
+	}), middlewares...)
+
+	// Public routes
+	r.HandleFunc("/shared/collections/{code}", getSharedCollectionHandler(store)).Methods("GET")
+	r.HandleFunc("/register", registerHandler(store, validate, jwtKey)).Methods("POST")
+	r.HandleFunc("/login", metrics.countLogins(limitLogins(loginLimiter, loginHandler(store, validate, jwtKey)))).Methods("POST")
+	r.HandleFunc("/token/refresh", refreshTokenHandler(store, validate, jwtKey)).Methods("POST")
+	r.HandleFunc("/logout", logoutHandler(store, validate)).Methods("POST")
+	r.HandleFunc("/password/reset/request", limitPasswordResets(passwordResetLimiter, requestPasswordResetHandler(store, validate, mailer))).Methods("POST")
+	r.HandleFunc("/password/reset", limitPasswordResets(passwordResetLimiter, resetPasswordHandler(store, validate))).Methods("POST")
+	r.HandleFunc("/health", healthHandler(store, ready)).Methods("GET")
+	r.HandleFunc("/health/ready", readinessHandler(store, ready)).Methods("GET")
+	r.HandleFunc("/metrics", metrics.handler(config.MetricsToken)).Methods("GET")
+	r.HandleFunc("/openapi.json", openApiHandler).Methods("GET")
+
+	// Authenticated routes, registered last since their subrouter matches every path
+	authenticated := r.NewRoute().Subrouter()
+	authenticated.Use(authenticate(store, jwtKey))
+	authenticated.HandleFunc("/addons/changes", requireScope(ScopeAddonsRead, getAddonChangesHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/addons/{game_version}/{slug}", requireScope(ScopeAddonsRead, getAddonHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/addons/{game_version}/{slug}", requireScope(ScopeAddonsWrite, putAddonHandler(store, validate))).Methods("PUT")
+	authenticated.HandleFunc("/addons/{game_version}/{slug}", requireScope(ScopeAddonsWrite, deleteAddonHandler(store))).Methods("DELETE")
+	authenticated.HandleFunc("/tokens/{id}", requireScope(ScopeAccount, deletePersonalAccessTokenHandler(store))).Methods("DELETE")
+	authenticated.HandleFunc("/tokens", requireScope(ScopeAccount, getPersonalAccessTokensHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/tokens", requireScope(ScopeAccount, createPersonalAccessTokenHandler(store, validate))).Methods("POST")
+	authenticated.HandleFunc("/addons", requireScope(ScopeAddonsRead, getAddonsHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/addons", requireScope(ScopeAddonsWrite, createAddonHandler(store, validate))).Methods("POST")
+	authenticated.HandleFunc("/collections", requireScope(ScopeAddonsRead, getCollectionsHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/collections", requireScope(ScopeAddonsWrite, createCollectionHandler(store, validate))).Methods("POST")
+	authenticated.HandleFunc("/collections/{id}", requireScope(ScopeAddonsRead, getCollectionHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/collections/{id}/addons", requireScope(ScopeAddonsWrite, addCollectionAddonHandler(store, validate))).Methods("POST")
+	authenticated.HandleFunc("/collections/{id}/addons/{game_version}/{slug}", requireScope(ScopeAddonsWrite, deleteCollectionAddonHandler(store))).Methods("DELETE")
+	authenticated.HandleFunc("/collections/{id}/share", requireScope(ScopeAddonsWrite, shareCollectionHandler(store))).Methods("POST")
+	authenticated.HandleFunc("/collections/{id}/share", requireScope(ScopeAddonsWrite, unshareCollectionHandler(store))).Methods("DELETE")
+	authenticated.HandleFunc("/shared/collections/{code}/subscribe", requireScope(ScopeAddonsWrite, subscribeToCollectionHandler(store))).Methods("POST")
+	authenticated.HandleFunc("/devices", requireScope(ScopeAddonsRead, getDevicesHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/devices", requireScope(ScopeAddonsWrite, registerDeviceHandler(store, validate))).Methods("POST")
+	authenticated.HandleFunc("/devices/{id}/addons", requireScope(ScopeAddonsWrite, reportDeviceAddonsHandler(store, validate))).Methods("PUT")
+	authenticated.HandleFunc("/orgs", requireScope(ScopeAddonsRead, getOrganizationsHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/orgs", requireScope(ScopeAddonsWrite, createOrganizationHandler(store, validate))).Methods("POST")
+	authenticated.HandleFunc("/orgs/{id}", requireScope(ScopeAddonsRead, getOrganizationHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/orgs/{id}/members", requireScope(ScopeAddonsWrite, saveOrganizationMemberHandler(store, validate))).Methods("POST")
+	authenticated.HandleFunc("/orgs/{id}/invitations", requireScope(ScopeAddonsRead, getOrganizationInvitationsHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/orgs/{id}/invitations", requireScope(ScopeAddonsWrite, inviteOrganizationMemberHandler(store, validate, mailer))).Methods("POST")
+	authenticated.HandleFunc("/orgs/{id}/invitations/{invitation_id}", requireScope(ScopeAddonsWrite, deleteOrganizationInvitationHandler(store))).Methods("DELETE")
+	authenticated.HandleFunc("/invitations", requireScope(ScopeAddonsRead, getInvitationsHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/invitations/{id}/accept", requireScope(ScopeAddonsWrite, acceptInvitationHandler(store, validate))).Methods("POST")
+	authenticated.HandleFunc("/invitations/{id}", requireScope(ScopeAddonsWrite, declineInvitationHandler(store))).Methods("DELETE")
+	authenticated.HandleFunc("/orgs/{id}/members/{user_id}", requireScope(ScopeAddonsWrite, deleteOrganizationMemberHandler(store))).Methods("DELETE")
+	authenticated.HandleFunc("/orgs/{id}/addons/{game_version}/{slug}", requireScope(ScopeAddonsWrite, putOrganizationAddonHandler(store, validate))).Methods("PUT")
+	authenticated.HandleFunc("/orgs/{id}/addons/{game_version}/{slug}", requireScope(ScopeAddonsWrite, deleteOrganizationAddonHandler(store))).Methods("DELETE")
+	authenticated.HandleFunc("/orgs/{id}/compliance", requireScope(ScopeAddonsRead, getOrganizationComplianceHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/password/change", requireScope(ScopeAccount, changePasswordHandler(store, validate, jwtKey))).Methods("POST")
+	authenticated.HandleFunc("/me/export", requireScope(ScopeAccount, exportAccountHandler(store))).Methods("GET")
+	authenticated.HandleFunc("/me", requireScope(ScopeAccount, deleteAccountHandler(store, validate))).Methods("DELETE")
+	if addonResolver != nil {
+		// Without it the route is missing, and the clients ask the providers themselves
+		authenticated.HandleFunc("/providers/resolve", requireScope(ScopeAddonsRead, resolveAddonsHandler(addonResolver, validate))).Methods("POST")
+	}
+
+	return r, nil
 }
 
 func main() {
+	config, args, err := loadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Setup logging, the standard logger writes through it too
+	logger, err := newLoggerFromConfig(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := config.validateDatabase(); err != nil {
+			log.Fatal(err)
+		}
+		store, err := newStoreFromConfig(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		code := runMigrateCommand(store, args[1:])
+		_ = store.Close()
+		os.Exit(code)
+	}
+	if len(args) > 0 && args[0] == "healthcheck" {
+		os.Exit(runHealthcheckCommand(config))
+	}
+	if len(args) > 0 {
+		log.Fatalf("unknown command: %s", args[0])
+	}
+
+	if err := config.Validate(); err != nil {
+		log.Fatal(err)
+	}
 	// Setup database
-	dsn := os.Getenv("PG_DSN")
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		// DryRun: true
-		TranslateError: true,
-	})
+	store, err := newStoreFromConfig(config)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer store.Close()
 
-	err = db.AutoMigrate(&User{}, &Addon{})
+	// Refuses to start if the schema was migrated by a newer server
+	applied, err := store.MigrateUp()
 	if err != nil {
 		log.Fatal(err)
 	}
+	for _, migration := range applied {
+		slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+	}
 
-	// Create the json validator
-	validate := validator.New(validator.WithRequiredStructEnabled())
+	// Whether the server accepts traffic, until it shuts down
+	var ready atomic.Bool
 
-	// Start http server
-	r := mux.NewRouter()
-	r.HandleFunc("/addons/{game_version}/{slug}", getAddonHandler(db)).Methods("GET")
-	r.HandleFunc("/addons/{game_version}/{slug}", deleteAddonHandler(db)).Methods("DELETE")
-	r.HandleFunc("/addons", getAddonsHandler(db)).Methods("GET")
-	r.HandleFunc("/addons", createAddonHandler(db, validate)).Methods("POST")
-	r.HandleFunc("/login", loginHandler(db, validate)).Methods("POST")
-	r.HandleFunc("/health", healthHandler).Methods("GET")
-	http.Handle("/", r)
-
-	address := "0.0.0.0:8888"
-	log.Println("Server started at", address)
-	log.Fatal(http.ListenAndServe(address, nil))
+	r, err := newRouter(config, store, &ready)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Start the http server, until SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Addr:              config.Address,
+		Handler:           r,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+	listener, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	serveErrors := make(chan error, 1)
+	go func() {
+		if config.TlsCertFile != "" {
+			serveErrors <- server.ServeTLS(listener, config.TlsCertFile, config.TlsKeyFile)
+		} else {
+			serveErrors <- server.Serve(listener)
+		}
+	}()
+	ready.Store(true)
+	slog.Info("Server started", "address", config.Address, "tls", config.TlsCertFile != "")
+
+	select {
+	case err := <-serveErrors:
+		slog.Error("Server failed", "error", err)
+		_ = store.Close()
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	// Fail the readiness check and keep serving until the load balancers notice, then stop accepting
+	// requests and wait for the ones in progress. A second signal skips the delay.
+	ready.Store(false)
+	stop()
+	if config.ShutdownDrainDelay > 0 {
+		slog.Info("Draining the server", "delay", config.ShutdownDrainDelay)
+		drainCtx, stopDrain := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		select {
+		case <-time.After(config.ShutdownDrainDelay):
+		case <-drainCtx.Done():
+		}
+		stopDrain()
+	}
+	slog.Info("Shutting down the server", "timeout", config.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shut down the server gracefully", "error", err)
+	}
+	slog.Info("Server stopped")
 }
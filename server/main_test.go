@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"wowa-api"
+)
+
+// newTestStore opens a migrated SQLite store in memory, closed at the end of the test.
+func newTestStore(t *testing.T) *GormStore {
+	t.Helper()
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	if _, err := store.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// The key signing the access tokens of the test servers
+const testJwtKey = "a test key that is long enough to sign tokens"
+
+// newTestServer serves the routes of the server on the store.
+func newTestServer(t *testing.T, store Store) *httptest.Server {
+	t.Helper()
+	server, _ := newTestServerWithMails(t, store)
+	return server
+}
+
+// newTestServerWithMails serves the routes of the server on the store, and returns the directory where
+// the file mailer writes the mails it sends.
+func newTestServerWithMails(t *testing.T, store Store) (*httptest.Server, string) {
+	t.Helper()
+	mailDir := t.TempDir()
+	config := defaultConfig()
+	config.JwtKey = testJwtKey
+	config.Mailer = "file"
+	config.MailerDir = mailDir
+	var ready atomic.Bool
+	ready.Store(true)
+	router, err := newRouter(config, store, &ready)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, mailDir
+}
+
+// readMails waits for the server to send count mails to the email, since they are sent in the background,
+// and returns their bodies from the oldest.
+func readMails(t *testing.T, mailDir string, to string, count int) []string {
+	t.Helper()
+	suffix := strings.ReplaceAll(to, "@", "_at_") + ".eml"
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		entries, err := os.ReadDir(mailDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var bodies []string
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Name(), suffix) {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(mailDir, entry.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The file mailer ends the mails with a new line, so a mail being written is read again later
+			_, body, found := strings.Cut(string(content), "\r\n\r\n")
+			if found && strings.HasSuffix(body, "\r\n") {
+				bodies = append(bodies, strings.TrimSuffix(body, "\r\n"))
+			}
+		}
+		if len(bodies) >= count {
+			return bodies
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d mails to %s, got %d", count, to, len(bodies))
+		}
+	}
+}
+
+// newJsonRequest creates a request with the body as JSON, and the access token when not empty.
+func newJsonRequest(t *testing.T, server *httptest.Server, method string, path string, accessToken string, body interface{}) *http.Request {
+	t.Helper()
+	var rawBody []byte
+	if body != nil {
+		var err error
+		rawBody, err = json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(rawBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return req
+}
+
+// do sends the request and decodes the response into dest, when not nil and successful.
+// It returns the response, with its body already read.
+func do(t *testing.T, server *httptest.Server, req *http.Request, dest interface{}) *http.Response {
+	t.Helper()
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if dest != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+// doError sends the request and decodes its error response.
+func doError(t *testing.T, server *httptest.Server, req *http.Request) (*http.Response, api.ErrorResponse) {
+	t.Helper()
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var errorResponse api.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
+		t.Fatal(err)
+	}
+	return resp, errorResponse
+}
+
+// doJson sends the body as JSON, see do.
+func doJson(t *testing.T, server *httptest.Server, method string, path string, accessToken string, body interface{}, dest interface{}) *http.Response {
+	t.Helper()
+	return do(t, server, newJsonRequest(t, server, method, path, accessToken, body), dest)
+}
+
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("expected status %d, got %d", status, resp.StatusCode)
+	}
+}
+
+// register creates an account and returns its access token.
+func register(t *testing.T, server *httptest.Server, email string) string {
+	t.Helper()
+	var tokens TokenResponse
+	resp := doJson(t, server, "POST", "/register", "", RegisterRequest{Email: email, Password: "password123"}, &tokens)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("failed to register %s: %d", email, resp.StatusCode)
+	}
+	return tokens.AccessToken
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	server := newTestServer(t, newTestStore(t))
+
+	accessToken := register(t, server, "user@example.com")
+	if accessToken == "" {
+		t.Fatal("expected an access token")
+	}
+
+	resp := doJson(t, server, "POST", "/register", "", RegisterRequest{Email: "user@example.com", Password: "password123"}, nil)
+	expectStatus(t, resp, http.StatusConflict)
+	resp = doJson(t, server, "POST", "/register", "", RegisterRequest{Email: "User@Example.com", Password: "password123"}, nil)
+	expectStatus(t, resp, http.StatusConflict)
+
+	resp = doJson(t, server, "POST", "/register", "", RegisterRequest{Email: "not an email", Password: "password123"}, nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	var tokens TokenResponse
+	resp = doJson(t, server, "POST", "/login", "", LoginRequest{Email: "user@example.com", Password: "password123"}, &tokens)
+	expectStatus(t, resp, http.StatusOK)
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatal("expected an access token and a refresh token")
+	}
+
+	resp = doJson(t, server, "GET", "/addons", tokens.AccessToken, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the access token to be accepted, got %d", resp.StatusCode)
+	}
+
+	resp = doJson(t, server, "POST", "/login", "", LoginRequest{Email: "USER@example.com", Password: "password123"}, nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	resp = doJson(t, server, "POST", "/login", "", LoginRequest{Email: "user@example.com", Password: "wrong password"}, nil)
+	expectStatus(t, resp, http.StatusUnauthorized)
+
+	resp = doJson(t, server, "POST", "/login", "", LoginRequest{Email: "unknown@example.com", Password: "password123"}, nil)
+	expectStatus(t, resp, http.StatusUnauthorized)
+
+	resp = doJson(t, server, "GET", "/addons", "", nil, nil)
+	expectStatus(t, resp, http.StatusUnauthorized)
+}
+
+func TestAddonCrud(t *testing.T) {
+	server := newTestServer(t, newTestStore(t))
+	accessToken := register(t, server, "user@example.com")
+	otherAccessToken := register(t, server, "other@example.com")
+
+	addAddonRequest := api.AddAddonRequest{
+		GameVersion: api.Retail,
+		Slug:        "details",
+		PutAddonRequest: api.PutAddonRequest{
+			Name:       "Details! Damage Meter",
+			Author:     "Terciob",
+			Provider:   api.Curse,
+			ExternalId: "61284",
+			Url:        "https://www.curseforge.com/wow/addons/details",
+			Version:    "1.0.0",
+		},
+	}
+	var created api.Addon
+	resp := doJson(t, server, "POST", "/addons", accessToken, addAddonRequest, &created)
+	expectStatus(t, resp, http.StatusCreated)
+	if created.Channel != api.ChannelRelease || created.Revision != 1 {
+		t.Fatalf("unexpected created addon: %+v", created)
+	}
+
+	var addon api.Addon
+	resp = doJson(t, server, "GET", "/addons/retail/details", accessToken, nil, &addon)
+	expectStatus(t, resp, http.StatusOK)
+	if addon.Id != created.Id || resp.Header.Get("ETag") != `"1"` {
+		t.Fatalf("unexpected addon %+v with ETag %s", addon, resp.Header.Get("ETag"))
+	}
+
+	// The addons of a user are not visible to the others
+	resp = doJson(t, server, "GET", "/addons/retail/details", otherAccessToken, nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	putAddonRequest := addAddonRequest.PutAddonRequest
+	putAddonRequest.Version = "1.1.0"
+	var updated api.Addon
+	resp = doJson(t, server, "PUT", "/addons/retail/details", accessToken, putAddonRequest, &updated)
+	expectStatus(t, resp, http.StatusOK)
+	if updated.Version != "1.1.0" || updated.Revision != 2 {
+		t.Fatalf("unexpected updated addon: %+v", updated)
+	}
+
+	// Saving the same addon again does not bump the revision
+	resp = doJson(t, server, "PUT", "/addons/retail/details", accessToken, putAddonRequest, &updated)
+	if resp.StatusCode != http.StatusOK || updated.Revision != 2 {
+		t.Fatalf("expected revision 2, got %d with status %d", updated.Revision, resp.StatusCode)
+	}
+
+	var addons []api.Addon
+	resp = doJson(t, server, "GET", "/addons", accessToken, nil, &addons)
+	if resp.StatusCode != http.StatusOK || len(addons) != 1 {
+		t.Fatalf("expected 1 addon, got %d with status %d", len(addons), resp.StatusCode)
+	}
+
+	resp = doJson(t, server, "PUT", "/addons/retail/details", accessToken, api.PutAddonRequest{Name: "Details!"}, nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = doJson(t, server, "DELETE", "/addons/retail/details", accessToken, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	resp = doJson(t, server, "DELETE", "/addons/retail/details", accessToken, nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+	resp = doJson(t, server, "GET", "/addons/retail/details", accessToken, nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestAddonRevisionMismatch(t *testing.T) {
+	server := newTestServer(t, newTestStore(t))
+	accessToken := register(t, server, "user@example.com")
+
+	putAddonRequest := api.PutAddonRequest{
+		Name:       "WeakAuras",
+		Author:     "WeakAuras Team",
+		Provider:   api.Github,
+		ExternalId: "WeakAuras/WeakAuras2",
+		Url:        "https://github.com/WeakAuras/WeakAuras2",
+	}
+	resp := doJson(t, server, "PUT", "/addons/classic/weakauras", accessToken, putAddonRequest, nil)
+	expectStatus(t, resp, http.StatusCreated)
+
+	// Updating with a stale revision fails instead of overwriting the other change
+	putAddonRequest.Version = "5.0.0"
+	req := newJsonRequest(t, server, "PUT", "/addons/classic/weakauras", accessToken, putAddonRequest)
+	req.Header.Set("If-Match", `"5"`)
+	resp = do(t, server, req, nil)
+	expectStatus(t, resp, http.StatusPreconditionFailed)
+
+	req = newJsonRequest(t, server, "PUT", "/addons/classic/weakauras", accessToken, putAddonRequest)
+	req.Header.Set("If-Match", `"1"`)
+	var updated api.Addon
+	resp = do(t, server, req, &updated)
+	expectStatus(t, resp, http.StatusOK)
+	if updated.Revision != 2 || resp.Header.Get("ETag") != `"2"` {
+		t.Fatalf("expected revision 2, got %d with ETag %s", updated.Revision, resp.Header.Get("ETag"))
+	}
+}
+
+func TestAddonChanges(t *testing.T) {
+	server := newTestServer(t, newTestStore(t))
+	accessToken := register(t, server, "user@example.com")
+
+	putAddonRequest := api.PutAddonRequest{
+		Name:       "WeakAuras",
+		Author:     "WeakAuras Team",
+		Provider:   api.Github,
+		ExternalId: "WeakAuras/WeakAuras2",
+		Url:        "https://github.com/WeakAuras/WeakAuras2",
+	}
+	resp := doJson(t, server, "PUT", "/addons/retail/weakauras", accessToken, putAddonRequest, nil)
+	expectStatus(t, resp, http.StatusCreated)
+	resp = doJson(t, server, "PUT", "/addons/classic/weakauras", accessToken, putAddonRequest, nil)
+	expectStatus(t, resp, http.StatusCreated)
+
+	var changes api.AddonChanges
+	resp = doJson(t, server, "GET", "/addons/changes", accessToken, nil, &changes)
+	expectStatus(t, resp, http.StatusOK)
+	if changes.Cursor != 2 || len(changes.Addons) != 2 || len(changes.Deleted) != 0 {
+		t.Fatalf("expected the 2 addons at cursor 2, got %+v", changes)
+	}
+
+	resp = doJson(t, server, "DELETE", "/addons/classic/weakauras", accessToken, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	resp = doJson(t, server, "GET", "/addons/changes?cursor=2", accessToken, nil, &changes)
+	expectStatus(t, resp, http.StatusOK)
+	if changes.Cursor != 3 || len(changes.Addons) != 0 || len(changes.Deleted) != 1 || changes.Deleted[0].GameVersion != api.Classic {
+		t.Fatalf("expected the classic addon deleted at cursor 3, got %+v", changes)
+	}
+
+	resp = doJson(t, server, "GET", "/addons/changes?cursor=-1", accessToken, nil, nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"wowa-api"
+)
+
+// The route label of the requests that did not match any route, so scanners do not create a label per path
+const unmatchedRoute = "unmatched"
+
+// Metrics are the Prometheus metrics of the server, in a registry of their own.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	logins          *prometheus.CounterVec
+}
+
+func NewMetrics(store Store) (*Metrics, error) {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wowa_http_requests_total",
+			Help: "The number of HTTP requests, by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "wowa_http_request_duration_seconds",
+			Help:    "The duration of the HTTP requests, by method, route template and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wowa_logins_total",
+			Help: "The number of login attempts, by result: success, failure or locked_out.",
+		}, []string{"result"}),
+	}
+	for _, result := range []string{"success", "failure", "locked_out"} {
+		m.logins.WithLabelValues(result)
+	}
+
+	sqlDB, err := store.DB()
+	if err != nil {
+		return nil, err
+	}
+	err = registerAll(m.registry,
+		m.requests,
+		m.requestDuration,
+		m.logins,
+		addonCollector{store: store},
+		collectors.NewDBStatsCollector(sqlDB, "wowa"),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func registerAll(registry *prometheus.Registry, collectors ...prometheus.Collector) error {
+	for _, collector := range collectors {
+		if err := registry.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addonCollector counts the addons in the database on every scrape.
+type addonCollector struct {
+	store Store
+}
+
+var addonsDesc = prometheus.NewDesc("wowa_addons", "The number of addons saved by the users, by provider and game version.", []string{"provider", "game_version"}, nil)
+
+func (c addonCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- addonsDesc
+}
+
+func (c addonCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := c.store.CountAddons()
+	if err != nil {
+		slog.Error("Failed to count the addons", "error", err)
+		ch <- prometheus.NewInvalidMetric(addonsDesc, err)
+		return
+	}
+	for _, count := range counts {
+		ch <- prometheus.MustNewConstMetric(addonsDesc, prometheus.GaugeValue, float64(count.Count), string(count.Provider), string(count.GameVersion))
+	}
+}
+
+// middleware counts the requests and their duration, labelled by the template of their route.
+func (m *Metrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := newStatusRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		route := unmatchedRoute
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		status := strconv.Itoa(recorder.status)
+		m.requests.WithLabelValues(r.Method, route, status).Inc()
+		m.requestDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// countLogins counts the login attempts by the status of the login handler.
+func (m *Metrics) countLogins(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := newStatusRecorder(w)
+		next(recorder, r)
+
+		switch recorder.status {
+		case http.StatusOK:
+			m.logins.WithLabelValues("success").Inc()
+		case http.StatusUnauthorized, http.StatusBadRequest:
+			m.logins.WithLabelValues("failure").Inc()
+		case http.StatusTooManyRequests:
+			m.logins.WithLabelValues("locked_out").Inc()
+		}
+	}
+}
+
+// handler serves the metrics, only to the requests with the bearer token when one is configured.
+func (m *Metrics) handler(token string) http.HandlerFunc {
+	promHandler := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		// Serve the other metrics when the addons cannot be counted
+		ErrorHandling: promhttp.ContinueOnError,
+		ErrorLog:      slog.NewLogLogger(slog.Default().Handler(), slog.LevelError),
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			requestToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) != 1 {
+				writeError(w, r, http.StatusUnauthorized, api.ErrorCodeUnauthorized, "Unauthorized")
+				return
+			}
+		}
+		promHandler.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wowa-api"
+)
+
+type contextKey int
+
+const requestInfoKey contextKey = iota
+
+// requestInfo is shared by the middlewares of a request, the authentication fills in the user.
+type requestInfo struct {
+	id     string
+	userId string
+	// The scope granted to a personal access token, empty for a session which can do everything
+	scope Scope
+}
+
+func getRequestInfo(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(requestInfoKey).(*requestInfo)
+	if info == nil {
+		return &requestInfo{}
+	}
+	return info
+}
+
+func getRequestId(r *http.Request) string {
+	return getRequestInfo(r).id
+}
+
+// getUserId returns the user authenticated by the authenticate middleware.
+func getUserId(r *http.Request) string {
+	return getRequestInfo(r).userId
+}
+
+// requestLogHandler adds the ID of the request to the records logged with its context.
+type requestLogHandler struct {
+	slog.Handler
+}
+
+func (h requestLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		record.AddAttrs(slog.String("request_id", info.id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestLogHandler) WithGroup(name string) slog.Handler {
+	return requestLogHandler{h.Handler.WithGroup(name)}
+}
+
+// newLoggerFromConfig creates the logger of the server, writing JSON lines unless the log format is "text".
+func newLoggerFromConfig(config Config) (*slog.Logger, error) {
+	switch config.LogFormat {
+	case "json":
+		return slog.New(requestLogHandler{slog.NewJSONHandler(os.Stderr, nil)}), nil
+	case "text":
+		return slog.New(requestLogHandler{slog.NewTextHandler(os.Stderr, nil)}), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s", config.LogFormat)
+	}
+}
+
+// The request IDs accepted from the clients, others are replaced so they cannot forge log lines
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestIdMiddleware gives every request an ID, the X-Request-Id header of the client when valid,
+// and returns it in the X-Request-Id response header.
+func requestIdMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if !validRequestId.MatchString(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set("X-Request-Id", id)
+		ctx := context.WithValue(r.Context(), requestInfoKey, &requestInfo{id: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// statusRecorder remembers the status code and the size of the response written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	size, err := r.ResponseWriter.Write(data)
+	r.size += size
+	return size, err
+}
+
+// accessLogMiddleware logs every request once it is answered.
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := newStatusRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		info := getRequestInfo(r)
+		slog.LogAttrs(r.Context(), level, "Request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Int("size", recorder.size),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("user_id", info.userId),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
+
+// recoveryMiddleware turns a panic of a handler into an internal server error, instead of a dropped connection.
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := newStatusRecorder(w)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			slog.ErrorContext(r.Context(), "Handler panicked", "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+			if !recorder.wroteHeader {
+				writeError(recorder, r, http.StatusInternalServerError, api.ErrorCodeInternal, "Internal server error")
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// withMiddlewares wraps a handler that mux calls without its middlewares, like the not found handler.
+func withMiddlewares(handler http.Handler, middlewares ...mux.MiddlewareFunc) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// authenticate is the middleware of the routes that need a user. It accepts session access tokens and
+// personal access tokens, and puts the user and the scope granted to the token in the request.
+func authenticate(store Store, jwtKey []byte) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if len(tokenString) == 0 {
+				writeError(w, r, http.StatusUnauthorized, api.ErrorCodeUnauthorized, "Unauthorized")
+				return
+			}
+
+			info := getRequestInfo(r)
+			if strings.HasPrefix(tokenString, personalAccessTokenPrefix) {
+				personalAccessToken := authenticatePersonalAccessToken(store, w, r, tokenString)
+				if personalAccessToken == nil {
+					return
+				}
+				info.userId = personalAccessToken.UserId
+				info.scope = personalAccessToken.Scope
+			} else {
+				userId, err := authenticateAccessToken(store, jwtKey, tokenString)
+				if errors.Is(err, errInvalidSession) {
+					slog.InfoContext(r.Context(), "Invalid access token", "error", err)
+					writeError(w, r, http.StatusUnauthorized, api.ErrorCodeInvalidToken, "Unauthorized (invalid token)")
+					return
+				}
+				if err != nil {
+					writeInternalError(w, r, err)
+					return
+				}
+				info.userId = userId
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// errInvalidSession is returned for an access token that is invalid, or whose session ended.
+var errInvalidSession = errors.New("invalid session")
+
+// sessionClaims are the claims of a session access token.
+type sessionClaims struct {
+	SessionId string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// parseAccessToken returns the user and the session of a session access token. The tokens without a session,
+// signed before the sessions could be revoked, are rejected.
+func parseAccessToken(jwtKey []byte, tokenString string) (string, string, error) {
+	var claims sessionClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", "", err
+	}
+	if claims.Subject == "" || claims.SessionId == "" {
+		return "", "", errors.New("the token has no user or session")
+	}
+	return claims.Subject, claims.SessionId, nil
+}
+
+// authenticateAccessToken returns the user of a session access token, or errInvalidSession when the token
+// is invalid or its session was revoked, expired or deleted with its user.
+func authenticateAccessToken(store Store, jwtKey []byte, tokenString string) (string, error) {
+	userId, sessionId, err := parseAccessToken(jwtKey, tokenString)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errInvalidSession, err)
+	}
+
+	session, err := store.GetSession(sessionId)
+	if err == ErrNotFound {
+		return "", fmt.Errorf("%w: the session does not exist", errInvalidSession)
+	}
+	if err != nil {
+		return "", err
+	}
+	if session.UserId != userId || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return "", fmt.Errorf("%w: the session ended", errInvalidSession)
+	}
+	return userId, nil
+}
+
+// requireScope rejects the personal access tokens that were not granted the scope required by the handler.
+func requireScope(requiredScope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		grantedScope := getRequestInfo(r).scope
+		if grantedScope != "" && !hasScope(grantedScope, requiredScope) {
+			writeError(w, r, http.StatusForbidden, api.ErrorCodeInsufficientScope, fmt.Sprintf("Forbidden (the token is missing the %s scope)", requiredScope))
+			return
+		}
+		next(w, r)
+	}
+}
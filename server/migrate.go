@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+const migrateUsage = `Usage: wowa-server migrate <command>
+
+Commands:
+  up                Apply every pending migration
+  down [-steps N]   Roll back the last N applied migrations (default 1)
+  status            List the migrations and whether they are applied
+`
+
+// runMigrateCommand runs the "migrate" subcommand and returns the process exit code.
+func runMigrateCommand(store Store, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := store.MigrateUp()
+		for _, migration := range applied {
+			fmt.Printf("Applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("The schema is up to date")
+		}
+	case "down":
+		flags := flag.NewFlagSet("down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to roll back")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if *steps < 1 {
+			fmt.Fprintln(os.Stderr, "Error: -steps must be at least 1")
+			return 2
+		}
+
+		rolledBack, err := store.MigrateDown(*steps)
+		for _, migration := range rolledBack {
+			fmt.Printf("Rolled back %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("No migration to roll back")
+		}
+	case "status":
+		statuses, err := store.MigrationStatus()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		_ = w.Flush()
+
+		if len(statuses) > 0 && statuses[len(statuses)-1].Version > latestMigrationVersion() {
+			fmt.Fprintln(os.Stderr, "Warning:", ErrSchemaTooNew)
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
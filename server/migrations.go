@@ -0,0 +1,728 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is one versioned change to the database schema.
+// Migrations must never be edited once released, add a new one instead.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration in the schema_migrations table.
+type SchemaMigration struct {
+	Version   int       `gorm:"primarykey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+var ErrSchemaTooNew = errors.New("the database schema is newer than this server")
+
+// The models of each migration are snapshots of the structs at the time, so that changing
+// the structs later does not change what an old migration does.
+
+type userV1 struct {
+	Id        string    `gorm:"primarykey;not null"`
+	Email     string    `gorm:"unique;not null"`
+	Password  string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+func (userV1) TableName() string { return "users" }
+
+type addonV1 struct {
+	Id          string    `gorm:"primarykey;not null"`
+	UserId      string    `gorm:"uniqueIndex:idx_unique_user_addon;not null"`
+	GameVersion string    `gorm:"uniqueIndex:idx_unique_user_addon;not null"`
+	Slug        string    `gorm:"uniqueIndex:idx_unique_user_addon;not null"`
+	Name        string    `gorm:"not null"`
+	Author      string    `gorm:"not null"`
+	Provider    string    `gorm:"not null"`
+	ExternalId  string    `gorm:"not null"`
+	Url         string    `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+	UpdatedAt   time.Time `gorm:"not null"`
+	User        userV1
+}
+
+func (addonV1) TableName() string { return "addons" }
+
+type sessionV1 struct {
+	Id               string    `gorm:"primarykey;not null"`
+	UserId           string    `gorm:"index;not null"`
+	RefreshTokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt        time.Time `gorm:"not null"`
+	RevokedAt        *time.Time
+	CreatedAt        time.Time `gorm:"not null"`
+	UpdatedAt        time.Time
+	User             userV1
+}
+
+func (sessionV1) TableName() string { return "sessions" }
+
+type personalAccessTokenV1 struct {
+	Id         string `gorm:"primarykey;not null"`
+	UserId     string `gorm:"index;not null"`
+	Name       string `gorm:"not null"`
+	Scope      string `gorm:"not null"`
+	TokenHash  string `gorm:"uniqueIndex;not null"`
+	LastUsedAt *time.Time
+	CreatedAt  time.Time `gorm:"not null"`
+	UpdatedAt  time.Time
+	User       userV1
+}
+
+func (personalAccessTokenV1) TableName() string { return "personal_access_tokens" }
+
+type passwordResetTokenV1 struct {
+	Id        string    `gorm:"primarykey;not null"`
+	UserId    string    `gorm:"index;not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"not null"`
+	User      userV1
+}
+
+func (passwordResetTokenV1) TableName() string { return "password_reset_tokens" }
+
+type addonV2 struct {
+	Id          string    `gorm:"primarykey;not null"`
+	UserId      string    `gorm:"uniqueIndex:idx_unique_user_addon;not null"`
+	GameVersion string    `gorm:"uniqueIndex:idx_unique_user_addon;not null"`
+	Slug        string    `gorm:"uniqueIndex:idx_unique_user_addon;not null"`
+	Name        string    `gorm:"not null"`
+	Author      string    `gorm:"not null"`
+	Provider    string    `gorm:"not null"`
+	ExternalId  string    `gorm:"not null"`
+	Url         string    `gorm:"not null"`
+	Version     string    `gorm:"not null;default:''"`
+	FileId      string    `gorm:"not null;default:''"`
+	Channel     string    `gorm:"not null;default:'release'"`
+	Pinned      bool      `gorm:"not null;default:false"`
+	Directories string    `gorm:"type:text;not null;default:'[]'"`
+	CreatedAt   time.Time `gorm:"not null"`
+	UpdatedAt   time.Time `gorm:"not null"`
+}
+
+func (addonV2) TableName() string { return "addons" }
+
+var addonV2InstallColumns = []string{"Version", "FileId", "Channel", "Pinned", "Directories"}
+
+type addonV3 struct {
+	Revision int `gorm:"not null;default:1"`
+}
+
+func (addonV3) TableName() string { return "addons" }
+
+type addonChangeV4 struct {
+	Id          int64     `gorm:"primarykey;autoIncrement;index:idx_addon_changes_user_cursor,priority:2"`
+	UserId      string    `gorm:"index:idx_addon_changes_user_cursor,priority:1;not null"`
+	GameVersion string    `gorm:"not null"`
+	Slug        string    `gorm:"not null"`
+	Deleted     bool      `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+}
+
+func (addonChangeV4) TableName() string { return "addon_changes" }
+
+type collectionV5 struct {
+	Id        string    `gorm:"primarykey;not null"`
+	UserId    string    `gorm:"index;not null"`
+	Name      string    `gorm:"not null"`
+	ShareCode *string   `gorm:"uniqueIndex"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time
+	User      userV1
+}
+
+func (collectionV5) TableName() string { return "collections" }
+
+type collectionAddonV5 struct {
+	Id           string    `gorm:"primarykey;not null"`
+	CollectionId string    `gorm:"uniqueIndex:idx_unique_collection_addon;not null"`
+	GameVersion  string    `gorm:"uniqueIndex:idx_unique_collection_addon;not null"`
+	Slug         string    `gorm:"uniqueIndex:idx_unique_collection_addon;not null"`
+	Name         string    `gorm:"not null"`
+	Author       string    `gorm:"not null"`
+	Provider     string    `gorm:"not null"`
+	ExternalId   string    `gorm:"not null"`
+	Url          string    `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"not null"`
+	Collection   collectionV5
+}
+
+func (collectionAddonV5) TableName() string { return "collection_addons" }
+
+type collectionSubscriptionV5 struct {
+	UserId       string    `gorm:"primarykey;not null"`
+	CollectionId string    `gorm:"primarykey;not null;index"`
+	CreatedAt    time.Time `gorm:"not null"`
+	User         userV1
+	Collection   collectionV5
+}
+
+func (collectionSubscriptionV5) TableName() string { return "collection_subscriptions" }
+
+type organizationV6 struct {
+	Id        string    `gorm:"primarykey;not null"`
+	Name      string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+func (organizationV6) TableName() string { return "organizations" }
+
+type organizationMemberV6 struct {
+	OrganizationId string    `gorm:"primarykey;not null"`
+	UserId         string    `gorm:"primarykey;not null;index"`
+	Role           string    `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"not null"`
+	Organization   organizationV6
+	User           userV1
+}
+
+func (organizationMemberV6) TableName() string { return "organization_members" }
+
+type organizationAddonV6 struct {
+	Id             string    `gorm:"primarykey;not null"`
+	OrganizationId string    `gorm:"uniqueIndex:idx_unique_organization_addon;not null"`
+	GameVersion    string    `gorm:"uniqueIndex:idx_unique_organization_addon;not null"`
+	Slug           string    `gorm:"uniqueIndex:idx_unique_organization_addon;not null"`
+	Name           string    `gorm:"not null"`
+	Author         string    `gorm:"not null"`
+	Provider       string    `gorm:"not null"`
+	ExternalId     string    `gorm:"not null"`
+	Url            string    `gorm:"not null"`
+	Requirement    string    `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"not null"`
+	UpdatedAt      time.Time
+	Organization   organizationV6
+}
+
+func (organizationAddonV6) TableName() string { return "organization_addons" }
+
+type organizationInvitationV7 struct {
+	Id             string    `gorm:"primarykey;not null"`
+	OrganizationId string    `gorm:"uniqueIndex:idx_unique_organization_invitation;not null"`
+	Email          string    `gorm:"uniqueIndex:idx_unique_organization_invitation;not null;index"`
+	Role           string    `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"not null"`
+	UpdatedAt      time.Time
+	Organization   organizationV6
+}
+
+func (organizationInvitationV7) TableName() string { return "organization_invitations" }
+
+type deviceV8 struct {
+	Id         string    `gorm:"primarykey;not null"`
+	UserId     string    `gorm:"uniqueIndex:idx_unique_user_device;not null"`
+	Name       string    `gorm:"uniqueIndex:idx_unique_user_device;not null"`
+	Platform   string    `gorm:"not null"`
+	LastSeenAt time.Time `gorm:"not null"`
+	CreatedAt  time.Time `gorm:"not null"`
+	UpdatedAt  time.Time
+	User       userV1
+}
+
+func (deviceV8) TableName() string { return "devices" }
+
+type deviceAddonV8 struct {
+	DeviceId    string    `gorm:"primarykey;not null"`
+	GameVersion string    `gorm:"primarykey;not null"`
+	Slug        string    `gorm:"primarykey;not null"`
+	Version     string    `gorm:"not null"`
+	ReportedAt  time.Time `gorm:"not null"`
+	Device      deviceV8
+}
+
+func (deviceAddonV8) TableName() string { return "device_addons" }
+
+type addonV8 struct {
+	DeviceId *string `gorm:"index"`
+}
+
+func (addonV8) TableName() string { return "addons" }
+
+type loginThrottleV9 struct {
+	Key         string    `gorm:"primarykey;not null"`
+	Failures    int       `gorm:"not null"`
+	LockedUntil time.Time `gorm:"not null"`
+	UpdatedAt   time.Time `gorm:"not null"`
+}
+
+func (loginThrottleV9) TableName() string { return "login_throttles" }
+
+type providerCacheEntryV10 struct {
+	Key       string    `gorm:"primarykey;not null"`
+	Value     string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+func (providerCacheEntryV10) TableName() string { return "provider_cache_entries" }
+
+type organizationInvitationV12 struct {
+	TokenHash string `gorm:"not null;default:''"`
+}
+
+func (organizationInvitationV12) TableName() string { return "organization_invitations" }
+
+type addonV13 struct {
+	OrganizationId *string
+}
+
+func (addonV13) TableName() string { return "addons" }
+
+type addonChangeV14 struct {
+	UserId string `gorm:"uniqueIndex:idx_unique_addon_change_cursor,priority:1;not null"`
+	Cursor int64  `gorm:"uniqueIndex:idx_unique_addon_change_cursor,priority:2;not null;default:0"`
+}
+
+func (addonChangeV14) TableName() string { return "addon_changes" }
+
+type addonChangeCounterV14 struct {
+	UserId     string `gorm:"primarykey;not null"`
+	LastCursor int64  `gorm:"not null"`
+	User       userV1
+}
+
+func (addonChangeCounterV14) TableName() string { return "addon_change_counters" }
+
+// normalizeUserEmails lowercases the emails stored before they were normalized on registration. It fails
+// on accounts whose emails only differ by case, since they cannot be merged without losing data.
+func normalizeUserEmails(tx *gorm.DB) error {
+	var users []userV1
+	if err := tx.Select("id", "email").Order("created_at").Find(&users).Error; err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	var duplicates []string
+	for _, user := range users {
+		email := normalizeEmail(user.Email)
+		if seen[email] {
+			duplicates = append(duplicates, email)
+		}
+		seen[email] = true
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("several accounts have the same email in a different case, change or delete them first: %s", strings.Join(duplicates, ", "))
+	}
+
+	for _, user := range users {
+		if email := normalizeEmail(user.Email); email != user.Email {
+			if err := tx.Model(&userV1{}).Where("id = ?", user.Id).Update("email", email).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restoreAddonIndexes recreates the indexes of the addons table after dropping a column,
+// since SQLite drops a column by recreating the table, which loses its indexes.
+func restoreAddonIndexes(tx *gorm.DB) error {
+	if !tx.Migrator().HasIndex(&addonV1{}, "idx_unique_user_addon") {
+		return tx.Migrator().CreateIndex(&addonV1{}, "idx_unique_user_addon")
+	}
+	return nil
+}
+
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: func(tx *gorm.DB) error {
+			// AutoMigrate, unlike CreateTable, also adopts the tables of databases created before versioned migrations
+			return tx.Migrator().AutoMigrate(&userV1{}, &addonV1{}, &sessionV1{}, &personalAccessTokenV1{}, &passwordResetTokenV1{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&passwordResetTokenV1{}, &personalAccessTokenV1{}, &sessionV1{}, &addonV1{}, &userV1{})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "addon install metadata",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range addonV2InstallColumns {
+				if err := tx.Migrator().AddColumn(&addonV2{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range addonV2InstallColumns {
+				if err := tx.Migrator().DropColumn(&addonV2{}, column); err != nil {
+					return err
+				}
+			}
+			return restoreAddonIndexes(tx)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "addon revision",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&addonV3{}, "Revision")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&addonV3{}, "Revision"); err != nil {
+				return err
+			}
+			return restoreAddonIndexes(tx)
+		},
+	},
+	{
+		Version: 4,
+		Name:    "addon change feed",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&addonChangeV4{}); err != nil {
+				return err
+			}
+			// The existing addons are the first changes, so a client starting from cursor 0 gets all of them
+			return tx.Exec(
+				"INSERT INTO addon_changes (user_id, game_version, slug, deleted, created_at) SELECT user_id, game_version, slug, ?, updated_at FROM addons ORDER BY updated_at",
+				false,
+			).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&addonChangeV4{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "addon collections",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&collectionV5{}, &collectionAddonV5{}, &collectionSubscriptionV5{})
+		},
+		Down: func(tx *gorm.DB) error {
+			// One at a time and children first, since the SQLite migrator may reorder the tables and break foreign keys
+			for _, model := range []interface{}{&collectionSubscriptionV5{}, &collectionAddonV5{}, &collectionV5{}} {
+				if err := tx.Migrator().DropTable(model); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 6,
+		Name:    "organizations",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&organizationV6{}, &organizationMemberV6{}, &organizationAddonV6{})
+		},
+		Down: func(tx *gorm.DB) error {
+			// One at a time and children first, like the collections
+			for _, model := range []interface{}{&organizationAddonV6{}, &organizationMemberV6{}, &organizationV6{}} {
+				if err := tx.Migrator().DropTable(model); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 7,
+		Name:    "organization invitations",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&organizationInvitationV7{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&organizationInvitationV7{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "devices",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&deviceV8{}, &deviceAddonV8{}); err != nil {
+				return err
+			}
+			if err := tx.Migrator().AddColumn(&addonV8{}, "DeviceId"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&addonV8{}, "DeviceId")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&addonV8{}, "DeviceId"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&addonV8{}, "DeviceId"); err != nil {
+				return err
+			}
+			if err := restoreAddonIndexes(tx); err != nil {
+				return err
+			}
+			for _, model := range []interface{}{&deviceAddonV8{}, &deviceV8{}} {
+				if err := tx.Migrator().DropTable(model); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 9,
+		Name:    "login throttles",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&loginThrottleV9{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&loginThrottleV9{})
+		},
+	},
+	{
+		Version: 10,
+		Name:    "provider cache",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&providerCacheEntryV10{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&providerCacheEntryV10{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "normalized user emails",
+		Up: func(tx *gorm.DB) error {
+			if err := normalizeUserEmails(tx); err != nil {
+				return err
+			}
+			// Also rejects the emails written in another case by anything that does not normalize them
+			return tx.Exec("CREATE UNIQUE INDEX idx_users_lower_email ON users (LOWER(email))").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			// The emails stay normalized, their original case is lost
+			return tx.Exec("DROP INDEX idx_users_lower_email").Error
+		},
+	},
+	{
+		Version: 12,
+		Name:    "organization invitation tokens",
+		// The pending invitations get an empty token, which no code matches, so they must be sent again
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&organizationInvitationV12{}, "TokenHash")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&organizationInvitationV12{}, "TokenHash"); err != nil {
+				return err
+			}
+			// SQLite drops a column by recreating the table, which loses its indexes
+			for _, index := range []string{"idx_unique_organization_invitation", "idx_organization_invitations_email"} {
+				if !tx.Migrator().HasIndex(&organizationInvitationV7{}, index) {
+					if err := tx.Migrator().CreateIndex(&organizationInvitationV7{}, index); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 13,
+		Name:    "organization addons",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&addonV13{}, "OrganizationId")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&addonV13{}, "OrganizationId"); err != nil {
+				return err
+			}
+			if err := restoreAddonIndexes(tx); err != nil {
+				return err
+			}
+			if !tx.Migrator().HasIndex(&addonV8{}, "DeviceId") {
+				return tx.Migrator().CreateIndex(&addonV8{}, "DeviceId")
+			}
+			return nil
+		},
+	},
+	{
+		Version: 14,
+		Name:    "addon change cursors by user",
+		// The ids given as cursors so far are kept, so the clients carry on from where they are
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&addonChangeCounterV14{}); err != nil {
+				return err
+			}
+			if err := tx.Migrator().AddColumn(&addonChangeV14{}, "Cursor"); err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE addon_changes SET cursor = id").Error; err != nil {
+				return err
+			}
+			err := tx.Exec("INSERT INTO addon_change_counters (user_id, last_cursor) SELECT user_id, MAX(id) FROM addon_changes GROUP BY user_id").Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropIndex(&addonChangeV4{}, "idx_addon_changes_user_cursor"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&addonChangeV14{}, "idx_unique_addon_change_cursor")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&addonChangeV14{}, "idx_unique_addon_change_cursor"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&addonChangeV14{}, "Cursor"); err != nil {
+				return err
+			}
+			// SQLite drops a column by recreating the table, which loses its indexes
+			if !tx.Migrator().HasIndex(&addonChangeV4{}, "idx_addon_changes_user_cursor") {
+				if err := tx.Migrator().CreateIndex(&addonChangeV4{}, "idx_addon_changes_user_cursor"); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropTable(&addonChangeCounterV14{})
+		},
+	},
+}
+
+func latestMigrationVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// getAppliedMigrations returns the applied migrations, ordered by version.
+func getAppliedMigrations(db *gorm.DB) ([]SchemaMigration, error) {
+	err := db.Migrator().AutoMigrate(&SchemaMigration{})
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []SchemaMigration
+	result := db.Order("version").Find(&applied)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return applied, nil
+}
+
+// checkSchemaVersion returns ErrSchemaTooNew if a migration unknown to this binary was applied.
+func checkSchemaVersion(applied []SchemaMigration) error {
+	if len(applied) > 0 && applied[len(applied)-1].Version > latestMigrationVersion() {
+		return fmt.Errorf("%w (schema version %d, latest known version %d)", ErrSchemaTooNew, applied[len(applied)-1].Version, latestMigrationVersion())
+	}
+	return nil
+}
+
+func getMigrationStatus(db *gorm.DB) ([]MigrationStatus, error) {
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := make(map[int]time.Time)
+	for _, schemaMigration := range applied {
+		appliedAt[schemaMigration.Version] = schemaMigration.AppliedAt
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+			delete(appliedAt, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	// Migrations applied by a newer server
+	for _, schemaMigration := range applied {
+		if _, ok := appliedAt[schemaMigration.Version]; ok {
+			at := schemaMigration.AppliedAt
+			statuses = append(statuses, MigrationStatus{Version: schemaMigration.Version, Name: schemaMigration.Name, AppliedAt: &at})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// migrateUp applies every pending migration in order, each one in its own transaction.
+func migrateUp(db *gorm.DB) ([]Migration, error) {
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchemaVersion(applied); err != nil {
+		return nil, err
+	}
+
+	isApplied := make(map[int]bool)
+	for _, schemaMigration := range applied {
+		isApplied[schemaMigration.Version] = true
+	}
+
+	var done []Migration
+	for _, migration := range migrations {
+		if isApplied[migration.Version] {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// migrateDown rolls back the last applied migrations, newest first.
+func migrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchemaVersion(applied); err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]Migration)
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var done []Migration
+	for i := len(applied) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := byVersion[applied[i].Version]
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, "version = ?", migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("rollback of migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"wowa-api"
+)
+
+// openApiDocument is the part of the OpenAPI document checked against the server.
+type openApiDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Type       interface{}                `json:"type"`
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func readOpenApiDocument(t *testing.T) openApiDocument {
+	t.Helper()
+	var document openApiDocument
+	if err := json.Unmarshal(api.OpenAPI, &document); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+// The structs sent or returned as each object schema of the OpenAPI document
+var openApiSchemaTypes = map[string]interface{}{
+	"ErrorResponse":                    api.ErrorResponse{},
+	"Addon":                            api.Addon{},
+	"DeletedAddon":                     api.DeletedAddon{},
+	"AddonChanges":                     api.AddonChanges{},
+	"PutAddonRequest":                  api.PutAddonRequest{},
+	"AddAddonRequest":                  api.AddAddonRequest{},
+	"Credentials":                      RegisterRequest{},
+	"TokenResponse":                    TokenResponse{},
+	"RefreshTokenRequest":              RefreshTokenRequest{},
+	"ChangePasswordRequest":            ChangePasswordRequest{},
+	"RequestPasswordResetRequest":      RequestPasswordResetRequest{},
+	"ResetPasswordRequest":             ResetPasswordRequest{},
+	"PersonalAccessToken":              api.PersonalAccessToken{},
+	"CreatePersonalAccessTokenRequest": api.CreatePersonalAccessTokenRequest{},
+	"CreatedPersonalAccessToken":       api.CreatedPersonalAccessToken{},
+	"CollectionAddon":                  api.CollectionAddon{},
+	"Collection":                       api.Collection{},
+	"CreateCollectionRequest":          api.CreateCollectionRequest{},
+	"AddCollectionAddonRequest":        api.AddCollectionAddonRequest{},
+	"DeviceAddon":                      api.DeviceAddon{},
+	"Device":                           api.Device{},
+	"RegisterDeviceRequest":            api.RegisterDeviceRequest{},
+	"DeviceAddonReport":                api.DeviceAddonReport{},
+	"ReportDeviceAddonsRequest":        api.ReportDeviceAddonsRequest{},
+	"OrganizationAddon":                api.OrganizationAddon{},
+	"Organization":                     api.Organization{},
+	"OrganizationMember":               api.OrganizationMember{},
+	"CreateOrganizationRequest":        api.CreateOrganizationRequest{},
+	"SaveOrganizationMemberRequest":    api.SaveOrganizationMemberRequest{},
+	"OrganizationInvitation":           api.OrganizationInvitation{},
+	"InviteOrganizationMemberRequest":  api.InviteOrganizationMemberRequest{},
+	"AcceptInvitationRequest":          api.AcceptInvitationRequest{},
+	"PutOrganizationAddonRequest":      api.PutOrganizationAddonRequest{},
+	"AddonCompliance":                  api.AddonCompliance{},
+	"MemberCompliance":                 api.MemberCompliance{},
+	"OrganizationCompliance":           api.OrganizationCompliance{},
+	"AccountProfile":                   AccountProfile{},
+	"AccountExport":                    AccountExport{},
+	"DeleteAccountRequest":             DeleteAccountRequest{},
+	"AddonLookup":                      api.AddonLookup{},
+	"ResolveAddonsRequest":             api.ResolveAddonsRequest{},
+	"ResolvedAddon":                    api.ResolvedAddon{},
+	"AddonResolution":                  api.AddonResolution{},
+	"ResolveAddonsResponse":            api.ResolveAddonsResponse{},
+	"Health":                           HealthResponse{},
+}
+
+// getJsonFields returns the JSON names of the fields of a struct, including the ones of its embedded structs.
+func getJsonFields(structType reflect.Type) []string {
+	var fields []string
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" {
+			fields = append(fields, getJsonFields(field.Type)...)
+			continue
+		}
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestOpenApiPathsMatchTheRouter(t *testing.T) {
+	config := defaultConfig()
+	config.JwtKey = testJwtKey
+	// Registers the route resolving the addons
+	config.GithubToken = "token"
+	var ready atomic.Bool
+	router, err := newRouter(config, newTestStore(t), &ready)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var routes []string
+	err = router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			// The subrouter of the authenticated routes has no path
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			routes = append(routes, method+" "+path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var documented []string
+	for path, operations := range readOpenApiDocument(t).Paths {
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	for _, route := range routes {
+		if !slices.Contains(documented, route) {
+			t.Errorf("%s is not documented", route)
+		}
+	}
+	for _, operation := range documented {
+		if !slices.Contains(routes, operation) {
+			t.Errorf("%s is documented but not routed", operation)
+		}
+	}
+}
+
+func TestOpenApiSchemasMatchTheStructs(t *testing.T) {
+	for name, schema := range readOpenApiDocument(t).Components.Schemas {
+		if schema.Type != "object" {
+			continue
+		}
+		value, ok := openApiSchemaTypes[name]
+		if !ok {
+			t.Errorf("%s: no struct is checked against the schema", name)
+			continue
+		}
+
+		var properties []string
+		for property := range schema.Properties {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+		fields := getJsonFields(reflect.TypeOf(value))
+		if !slices.Equal(properties, fields) {
+			t.Errorf("%s: the schema has the properties %v, but the struct has the fields %v", name, properties, fields)
+		}
+	}
+}
@@ -0,0 +1,783 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wowa-api"
+)
+
+type OrganizationRole = api.OrganizationRole
+
+const (
+	RoleOwner   = api.RoleOwner
+	RoleOfficer = api.RoleOfficer
+	RoleMember  = api.RoleMember
+)
+
+// roleRanks orders the roles, an officer can do everything a member can do.
+var roleRanks = map[OrganizationRole]int{
+	RoleMember:  1,
+	RoleOfficer: 2,
+	RoleOwner:   3,
+}
+
+func hasRole(granted OrganizationRole, required OrganizationRole) bool {
+	return roleRanks[granted] >= roleRanks[required]
+}
+
+type AddonRequirement = api.AddonRequirement
+
+const (
+	RequirementRequired    = api.RequirementRequired
+	RequirementRecommended = api.RequirementRecommended
+)
+
+// Organization is a guild or a team, whose officers maintain the addon sets of its members.
+type Organization struct {
+	Id        string              `gorm:"primarykey;not null" json:"id"`
+	Name      string              `gorm:"not null" json:"name"`
+	CreatedAt time.Time           `gorm:"not null" json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Addons    []OrganizationAddon `json:"addons"`
+	// The role of the user who requested the organization
+	Role OrganizationRole `gorm:"-" json:"role"`
+}
+
+type OrganizationMember struct {
+	OrganizationId string           `gorm:"primarykey;not null" json:"organization_id"`
+	UserId         string           `gorm:"primarykey;not null;index" json:"user_id"`
+	Role           OrganizationRole `gorm:"not null" json:"role"`
+	CreatedAt      time.Time        `gorm:"not null" json:"created_at"`
+	User           User             `json:"-"`
+}
+
+// OrganizationInvitation lets the user with the email join the organization with the role, once they accept it.
+// Until then they are not a member, so they are neither checked for compliance nor given the required addons.
+type OrganizationInvitation struct {
+	Id             string `gorm:"primarykey;not null" json:"id"`
+	OrganizationId string `gorm:"uniqueIndex:idx_unique_organization_invitation;not null" json:"organization_id"`
+	// Lowercased, so the same email is only invited once
+	Email string           `gorm:"uniqueIndex:idx_unique_organization_invitation;not null;index" json:"email"`
+	Role  OrganizationRole `gorm:"not null" json:"role"`
+	// The hash of the code mailed to the email, required to accept, since the emails of the accounts are not verified
+	TokenHash    string       `gorm:"not null" json:"-"`
+	CreatedAt    time.Time    `gorm:"not null" json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	Organization Organization `json:"-"`
+	// The name of the organization, which the invited user cannot get yet
+	OrganizationName string `gorm:"-" json:"organization_name"`
+}
+
+type OrganizationAddon struct {
+	Id             string           `gorm:"primarykey;not null" json:"id"`
+	OrganizationId string           `gorm:"uniqueIndex:idx_unique_organization_addon;not null" json:"organization_id"`
+	GameVersion    GameVersion      `gorm:"uniqueIndex:idx_unique_organization_addon;not null" json:"game_version"`
+	Slug           string           `gorm:"uniqueIndex:idx_unique_organization_addon;not null" json:"slug"`
+	Name           string           `gorm:"not null" json:"name"`
+	Author         string           `gorm:"not null" json:"author"`
+	Provider       Provider         `gorm:"not null" json:"provider"`
+	ExternalId     string           `gorm:"not null" json:"external_id"`
+	Url            string           `gorm:"not null" json:"url"`
+	Requirement    AddonRequirement `gorm:"not null" json:"requirement"`
+	CreatedAt      time.Time        `gorm:"not null" json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+func toApiOrganizationAddon(addon OrganizationAddon) api.OrganizationAddon {
+	return api.OrganizationAddon{
+		Id:             addon.Id,
+		OrganizationId: addon.OrganizationId,
+		AddonReference: api.AddonReference{
+			GameVersion: addon.GameVersion,
+			Slug:        addon.Slug,
+			Name:        addon.Name,
+			Author:      addon.Author,
+			Provider:    addon.Provider,
+			ExternalId:  addon.ExternalId,
+			Url:         addon.Url,
+		},
+		Requirement: addon.Requirement,
+		CreatedAt:   addon.CreatedAt,
+		UpdatedAt:   addon.UpdatedAt,
+	}
+}
+
+// toApiOrganization returns the organization as sent to the clients, without its members.
+func toApiOrganization(organization Organization) api.Organization {
+	addons := []api.OrganizationAddon{}
+	for _, addon := range organization.Addons {
+		addons = append(addons, toApiOrganizationAddon(addon))
+	}
+	return api.Organization{
+		Id:        organization.Id,
+		Name:      organization.Name,
+		Addons:    addons,
+		Role:      organization.Role,
+		CreatedAt: organization.CreatedAt,
+		UpdatedAt: organization.UpdatedAt,
+	}
+}
+
+func toApiOrganizations(organizations []Organization) []api.Organization {
+	apiOrganizations := []api.Organization{}
+	for _, organization := range organizations {
+		apiOrganizations = append(apiOrganizations, toApiOrganization(organization))
+	}
+	return apiOrganizations
+}
+
+func toApiOrganizationInvitation(invitation OrganizationInvitation) api.OrganizationInvitation {
+	return api.OrganizationInvitation{
+		Id:               invitation.Id,
+		OrganizationId:   invitation.OrganizationId,
+		OrganizationName: invitation.OrganizationName,
+		Email:            invitation.Email,
+		Role:             invitation.Role,
+		CreatedAt:        invitation.CreatedAt,
+		UpdatedAt:        invitation.UpdatedAt,
+	}
+}
+
+func toApiOrganizationInvitations(invitations []OrganizationInvitation) []api.OrganizationInvitation {
+	apiInvitations := []api.OrganizationInvitation{}
+	for _, invitation := range invitations {
+		apiInvitations = append(apiInvitations, toApiOrganizationInvitation(invitation))
+	}
+	return apiInvitations
+}
+
+// requireOrganizationRole returns the membership of the user if it has at least the required role.
+// It writes the error response and returns nil otherwise.
+func requireOrganizationRole(store Store, w http.ResponseWriter, r *http.Request, userId string, organizationId string, requiredRole OrganizationRole) *OrganizationMember {
+	member, err := store.GetOrganizationMember(organizationId, userId)
+	if err != nil {
+		if err == ErrNotFound {
+			// Do not reveal that the organization exists
+			writeNotFound(w, r)
+			return nil
+		}
+		writeInternalError(w, r, err)
+		return nil
+	}
+
+	if !hasRole(member.Role, requiredRole) {
+		writeError(w, r, http.StatusForbidden, api.ErrorCodeForbidden, fmt.Sprintf("Forbidden, the %s role is required", requiredRole))
+		return nil
+	}
+	return member
+}
+
+// computeCompliance checks the addons reported by each member against the required addons of the organization.
+// The latest version of an addon is the one of the member who changed it most recently, among the members
+// who installed it from the required source.
+func computeCompliance(organizationId string, requiredAddons []OrganizationAddon, members []OrganizationMember, memberAddons []Addon) api.OrganizationCompliance {
+	type addonKey struct {
+		userId      string
+		gameVersion GameVersion
+		slug        string
+	}
+	type sourceKey struct {
+		gameVersion GameVersion
+		slug        string
+		provider    Provider
+		externalId  string
+	}
+	installed := make(map[addonKey]Addon)
+	latest := make(map[sourceKey]Addon)
+	for _, addon := range memberAddons {
+		installed[addonKey{addon.UserId, addon.GameVersion, addon.Slug}] = addon
+		key := sourceKey{addon.GameVersion, addon.Slug, addon.Provider, addon.ExternalId}
+		if current, ok := latest[key]; !ok || addon.UpdatedAt.After(current.UpdatedAt) {
+			latest[key] = addon
+		}
+	}
+
+	compliance := api.OrganizationCompliance{OrganizationId: organizationId, Members: []api.MemberCompliance{}}
+	for _, member := range members {
+		memberCompliance := api.MemberCompliance{
+			UserId: member.UserId, Email: member.User.Email, Role: member.Role, Compliant: true, Addons: []api.AddonCompliance{},
+		}
+		for _, required := range requiredAddons {
+			addonCompliance := api.AddonCompliance{GameVersion: required.GameVersion, Slug: required.Slug, Status: api.ComplianceOk}
+			if latestAddon, ok := latest[sourceKey{required.GameVersion, required.Slug, required.Provider, required.ExternalId}]; ok {
+				addonCompliance.LatestVersion = latestAddon.Version
+			}
+
+			addon, ok := installed[addonKey{member.UserId, required.GameVersion, required.Slug}]
+			switch {
+			case !ok:
+				addonCompliance.Status = api.ComplianceMissing
+			case addon.Provider != required.Provider || addon.ExternalId != required.ExternalId:
+				addonCompliance.Status = api.ComplianceWrongSource
+				addonCompliance.InstalledVersion = addon.Version
+			default:
+				addonCompliance.InstalledVersion = addon.Version
+				if addon.Version != addonCompliance.LatestVersion {
+					addonCompliance.Status = api.ComplianceOutdated
+				}
+			}
+
+			if addonCompliance.Status != api.ComplianceOk {
+				memberCompliance.Compliant = false
+			}
+			memberCompliance.Addons = append(memberCompliance.Addons, addonCompliance)
+		}
+		compliance.Members = append(compliance.Members, memberCompliance)
+	}
+	return compliance
+}
+
+func createOrganizationHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var createRequest api.CreateOrganizationRequest
+		if err := json.NewDecoder(r.Body).Decode(&createRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(createRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		organization := Organization{
+			Id:     "org_" + uuid.New().String(),
+			Name:   createRequest.Name,
+			Addons: []OrganizationAddon{},
+			Role:   RoleOwner,
+		}
+		err := store.CreateOrganization(&organization, userId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		writeJson(w, toApiOrganization(organization))
+	}
+}
+
+// getOrganizationsHandler returns the organizations of the user, with their addons and the role of the user.
+func getOrganizationsHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		organizations, err := store.GetOrganizations(userId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		writeJson(w, toApiOrganizations(organizations))
+	}
+}
+
+func getOrganizationHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		organizationId := mux.Vars(r)["id"]
+		member := requireOrganizationRole(store, w, r, userId, organizationId, RoleMember)
+		if member == nil {
+			return
+		}
+
+		organization, err := store.GetOrganization(organizationId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		organization.Role = member.Role
+
+		members, err := store.GetOrganizationMembers(organizationId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		response := toApiOrganization(*organization)
+		response.Members = []api.OrganizationMember{}
+		for _, member := range members {
+			response.Members = append(response.Members, api.OrganizationMember{
+				UserId: member.UserId, Email: member.User.Email, Role: member.Role, CreatedAt: member.CreatedAt,
+			})
+		}
+		writeJson(w, response)
+	}
+}
+
+// saveOrganizationMemberHandler changes the role of a member, who must have joined with an invitation first.
+// Officers can only manage members, and only the owner can manage officers.
+func saveOrganizationMemberHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var saveRequest api.SaveOrganizationMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&saveRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(saveRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		organizationId := mux.Vars(r)["id"]
+		requiredRole := RoleOfficer
+		if saveRequest.Role == RoleOfficer {
+			requiredRole = RoleOwner
+		}
+		manager := requireOrganizationRole(store, w, r, userId, organizationId, requiredRole)
+		if manager == nil {
+			return
+		}
+
+		// Unknown emails and users who are not members get the same answer, so it does not tell who has an account
+		user, err := store.GetUserByEmail(normalizeEmail(saveRequest.Email))
+		if err != nil && err != ErrNotFound {
+			writeInternalError(w, r, err)
+			return
+		}
+		var existing *OrganizationMember
+		if user != nil {
+			existing, err = store.GetOrganizationMember(organizationId, user.Id)
+			if err != nil && err != ErrNotFound {
+				writeInternalError(w, r, err)
+				return
+			}
+		}
+		if existing == nil {
+			writeError(w, r, http.StatusNotFound, api.ErrorCodeNotFound, "Not a member, invite them first")
+			return
+		}
+		if existing.Role == RoleOwner {
+			writeError(w, r, http.StatusBadRequest, api.ErrorCodeBadRequest, "The role of the owner cannot be changed")
+			return
+		}
+		if existing.Role == RoleOfficer && !hasRole(manager.Role, RoleOwner) {
+			writeError(w, r, http.StatusForbidden, api.ErrorCodeForbidden, "Forbidden, only the owner can change the role of officers")
+			return
+		}
+
+		member := OrganizationMember{OrganizationId: organizationId, UserId: user.Id, Role: saveRequest.Role}
+		err = store.SaveOrganizationMember(&member)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		writeJson(w, api.OrganizationMember{UserId: user.Id, Email: user.Email, Role: member.Role, CreatedAt: member.CreatedAt})
+	}
+}
+
+// sendOrganizationInvitation tells the invited email how to join the organization, with the code to accept.
+func sendOrganizationInvitation(mailer Mailer, invitation OrganizationInvitation, token string) {
+	err := mailer.Send(MailMessage{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("Join %s on wowa", invitation.OrganizationName),
+		Body: fmt.Sprintf("You were invited to join %s on wowa as %s.\n\n", invitation.OrganizationName, invitation.Role) +
+			"Run \"wowa org join " + invitation.Id + " " + token + "\" to accept, or \"wowa org decline " + invitation.Id + "\" to decline. " +
+			"Create a wowa account with this email first if you do not have one.\n\n" +
+			"If you do not know this organization, you can ignore this email.",
+	})
+	if err != nil {
+		slog.Error("Failed to send the organization invitation", "invitation_id", invitation.Id, "error", err)
+	}
+}
+
+// inviteOrganizationMemberHandler invites an email to join the organization, or changes the role of its
+// invitation. The answer does not depend on whether the email has an account, and the invited user only
+// becomes a member once they accept. Officers can only invite members, and only the owner can invite officers.
+func inviteOrganizationMemberHandler(store Store, validate *validator.Validate, mailer Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var inviteRequest api.InviteOrganizationMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&inviteRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(inviteRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		organizationId := mux.Vars(r)["id"]
+		requiredRole := RoleOfficer
+		if inviteRequest.Role == RoleOfficer {
+			requiredRole = RoleOwner
+		}
+		if requireOrganizationRole(store, w, r, userId, organizationId, requiredRole) == nil {
+			return
+		}
+
+		// The members are already visible to the officers, so this does not tell who has an account
+		email := normalizeEmail(inviteRequest.Email)
+		members, err := store.GetOrganizationMembers(organizationId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		for _, member := range members {
+			if normalizeEmail(member.User.Email) == email {
+				writeError(w, r, http.StatusConflict, api.ErrorCodeConflict, "Already a member, change their role instead")
+				return
+			}
+		}
+
+		// Inviting again replaces the code, so only the last mail can be used to accept
+		token, tokenHash, err := generateSecret("")
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		invitation := OrganizationInvitation{
+			Id:             "org_invitation_" + uuid.New().String(),
+			OrganizationId: organizationId,
+			Email:          email,
+			Role:           inviteRequest.Role,
+			TokenHash:      tokenHash,
+		}
+		err = store.SaveOrganizationInvitation(&invitation)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		organization, err := store.GetOrganization(organizationId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		invitation.OrganizationName = organization.Name
+
+		go sendOrganizationInvitation(mailer, invitation, token)
+		writeJson(w, toApiOrganizationInvitation(invitation))
+	}
+}
+
+// getOrganizationInvitationsHandler returns the pending invitations of the organization, to the officers.
+func getOrganizationInvitationsHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		organizationId := mux.Vars(r)["id"]
+		if requireOrganizationRole(store, w, r, userId, organizationId, RoleOfficer) == nil {
+			return
+		}
+
+		invitations, err := store.GetOrganizationInvitations(organizationId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		writeJson(w, toApiOrganizationInvitations(invitations))
+	}
+}
+
+// deleteOrganizationInvitationHandler cancels an invitation, with the same roles required as to send it.
+func deleteOrganizationInvitationHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		vars := mux.Vars(r)
+		organizationId := vars["id"]
+		member := requireOrganizationRole(store, w, r, userId, organizationId, RoleOfficer)
+		if member == nil {
+			return
+		}
+
+		invitation, err := store.GetOrganizationInvitation(vars["invitation_id"])
+		if err != nil && err != ErrNotFound {
+			writeInternalError(w, r, err)
+			return
+		}
+		if invitation == nil || invitation.OrganizationId != organizationId {
+			writeNotFound(w, r)
+			return
+		}
+		if invitation.Role == RoleOfficer && !hasRole(member.Role, RoleOwner) {
+			writeError(w, r, http.StatusForbidden, api.ErrorCodeForbidden, "Forbidden, only the owner can cancel the invitations of officers")
+			return
+		}
+
+		err = store.DeleteOrganizationInvitation(invitation.Id)
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+}
+
+// getInvitationForUser returns the invitation if it was sent to the email of the user.
+// It writes the error response and returns nil otherwise.
+func getInvitationForUser(store Store, w http.ResponseWriter, r *http.Request, userId string, invitationId string) *OrganizationInvitation {
+	user, err := store.GetUserById(userId)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return nil
+	}
+	invitation, err := store.GetOrganizationInvitation(invitationId)
+	if err != nil {
+		if err == ErrNotFound {
+			writeNotFound(w, r)
+			return nil
+		}
+		writeInternalError(w, r, err)
+		return nil
+	}
+	if invitation.Email != normalizeEmail(user.Email) {
+		// Do not reveal the invitations of the others
+		writeNotFound(w, r)
+		return nil
+	}
+	return invitation
+}
+
+// getInvitationsHandler returns the pending invitations of the user.
+func getInvitationsHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := store.GetUserById(getUserId(r))
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		invitations, err := store.GetInvitationsByEmail(normalizeEmail(user.Email))
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		writeJson(w, toApiOrganizationInvitations(invitations))
+	}
+}
+
+// acceptInvitationHandler makes the user a member of the organization, and returns it. The code mailed with
+// the invitation is required, since matching the email of the account does not prove that the user owns it.
+func acceptInvitationHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var acceptRequest api.AcceptInvitationRequest
+		if err := json.NewDecoder(r.Body).Decode(&acceptRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(acceptRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		invitation := getInvitationForUser(store, w, r, userId, mux.Vars(r)["id"])
+		if invitation == nil {
+			return
+		}
+		if invitation.TokenHash != hashSecret(acceptRequest.Token) {
+			writeError(w, r, http.StatusBadRequest, api.ErrorCodeInvalidToken, "Invalid invitation code")
+			return
+		}
+
+		err := store.AcceptOrganizationInvitation(invitation.Id, userId)
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+
+		organization, err := store.GetOrganization(invitation.OrganizationId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		member, err := store.GetOrganizationMember(invitation.OrganizationId, userId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		organization.Role = member.Role
+		writeJson(w, toApiOrganization(*organization))
+	}
+}
+
+// declineInvitationHandler deletes an invitation of the user.
+func declineInvitationHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		invitation := getInvitationForUser(store, w, r, userId, mux.Vars(r)["id"])
+		if invitation == nil {
+			return
+		}
+
+		err := store.DeleteOrganizationInvitation(invitation.Id)
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+}
+
+// deleteOrganizationMemberHandler removes a member, or lets a member leave the organization.
+func deleteOrganizationMemberHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		vars := mux.Vars(r)
+		organizationId := vars["id"]
+		member, err := store.GetOrganizationMember(organizationId, vars["user_id"])
+		if err != nil && err != ErrNotFound {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		requiredRole := RoleOfficer
+		if member != nil && member.Role == RoleOfficer {
+			requiredRole = RoleOwner
+		}
+		if member == nil || member.UserId != userId {
+			if requireOrganizationRole(store, w, r, userId, organizationId, requiredRole) == nil {
+				return
+			}
+		}
+		if member == nil {
+			writeNotFound(w, r)
+			return
+		}
+		if member.Role == RoleOwner {
+			writeError(w, r, http.StatusBadRequest, api.ErrorCodeBadRequest, "The owner cannot leave the organization")
+			return
+		}
+
+		err = store.DeleteOrganizationMember(organizationId, member.UserId)
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+}
+
+func putOrganizationAddonHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var putRequest api.PutOrganizationAddonRequest
+		if err := json.NewDecoder(r.Body).Decode(&putRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(putRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		vars := mux.Vars(r)
+		gameVersion := GameVersion(vars["game_version"])
+		if gameVersion != Retail && gameVersion != Classic {
+			writeError(w, r, http.StatusBadRequest, api.ErrorCodeValidationFailed, "Validation failed: game_version must be retail or classic")
+			return
+		}
+		if requireOrganizationRole(store, w, r, userId, vars["id"], RoleOfficer) == nil {
+			return
+		}
+
+		addon := OrganizationAddon{
+			Id:             "org_addon_" + uuid.New().String(),
+			OrganizationId: vars["id"],
+			GameVersion:    gameVersion,
+			Slug:           vars["slug"],
+			Name:           putRequest.Name,
+			Author:         putRequest.Author,
+			Provider:       putRequest.Provider,
+			ExternalId:     putRequest.ExternalId,
+			Url:            putRequest.Url,
+			Requirement:    putRequest.Requirement,
+		}
+		err := store.SaveOrganizationAddon(&addon)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		writeJson(w, toApiOrganizationAddon(addon))
+	}
+}
+
+func deleteOrganizationAddonHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		vars := mux.Vars(r)
+		if requireOrganizationRole(store, w, r, userId, vars["id"], RoleOfficer) == nil {
+			return
+		}
+
+		err := store.DeleteOrganizationAddon(vars["id"], GameVersion(vars["game_version"]), vars["slug"])
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+}
+
+// getOrganizationComplianceHandler reports, to the officers, the members missing required addons.
+func getOrganizationComplianceHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		organizationId := mux.Vars(r)["id"]
+		if requireOrganizationRole(store, w, r, userId, organizationId, RoleOfficer) == nil {
+			return
+		}
+
+		organization, err := store.GetOrganization(organizationId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		members, err := store.GetOrganizationMembers(organizationId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		memberAddons, err := store.GetOrganizationMemberAddons(organizationId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		var requiredAddons []OrganizationAddon
+		for _, addon := range organization.Addons {
+			if addon.Requirement == RequirementRequired {
+				requiredAddons = append(requiredAddons, addon)
+			}
+		}
+
+		compliance := computeCompliance(organizationId, requiredAddons, members, memberAddons)
+		writeJson(w, compliance)
+	}
+}
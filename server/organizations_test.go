@@ -0,0 +1,275 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"wowa-api"
+)
+
+// invitationCodePattern finds the code in the invitation mails.
+var invitationCodePattern = regexp.MustCompile(`wowa org join \S+ (\S+)"`)
+
+// readInvitationCode returns the code of the nth invitation mailed to the email, from 1.
+func readInvitationCode(t *testing.T, mailDir string, email string, nth int) string {
+	t.Helper()
+	body := readMails(t, mailDir, email, nth)[nth-1]
+	match := invitationCodePattern.FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("expected an invitation code in the mail, got %q", body)
+	}
+	return match[1]
+}
+
+func TestOrganizationInvitations(t *testing.T) {
+	server, mailDir := newTestServerWithMails(t, newTestStore(t))
+	ownerAccessToken := register(t, server, "owner@example.com")
+	invitedAccessToken := register(t, server, "Invited@example.com")
+	otherAccessToken := register(t, server, "other@example.com")
+
+	var organization api.Organization
+	resp := doJson(t, server, "POST", "/orgs", ownerAccessToken, api.CreateOrganizationRequest{Name: "Guild"}, &organization)
+	expectStatus(t, resp, http.StatusCreated)
+	invitationsPath := "/orgs/" + organization.Id + "/invitations"
+
+	// Inviting an account and an unknown email answers the same way
+	var invitation api.OrganizationInvitation
+	resp = doJson(t, server, "POST", invitationsPath, ownerAccessToken, api.InviteOrganizationMemberRequest{Email: "invited@example.com", Role: api.RoleMember}, &invitation)
+	expectStatus(t, resp, http.StatusOK)
+	var unknownInvitation api.OrganizationInvitation
+	resp = doJson(t, server, "POST", invitationsPath, ownerAccessToken, api.InviteOrganizationMemberRequest{Email: "unknown@example.com", Role: api.RoleMember}, &unknownInvitation)
+	expectStatus(t, resp, http.StatusOK)
+	if invitation.OrganizationName != "Guild" || unknownInvitation.OrganizationName != "Guild" || invitation.Role != unknownInvitation.Role {
+		t.Fatalf("expected the same invitations, got %+v and %+v", invitation, unknownInvitation)
+	}
+
+	// Inviting again updates the invitation
+	var updated api.OrganizationInvitation
+	resp = doJson(t, server, "POST", invitationsPath, ownerAccessToken, api.InviteOrganizationMemberRequest{Email: "INVITED@example.com", Role: api.RoleOfficer}, &updated)
+	expectStatus(t, resp, http.StatusOK)
+	if updated.Id != invitation.Id || updated.Role != api.RoleOfficer {
+		t.Fatalf("expected the invitation to be updated, got %+v", updated)
+	}
+
+	// The invited user is not a member until they accept
+	resp = doJson(t, server, "GET", "/orgs/"+organization.Id, invitedAccessToken, nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+	var compliance api.OrganizationCompliance
+	resp = doJson(t, server, "GET", "/orgs/"+organization.Id+"/compliance", ownerAccessToken, nil, &compliance)
+	expectStatus(t, resp, http.StatusOK)
+	if len(compliance.Members) != 1 {
+		t.Fatalf("expected only the owner in the compliance report, got %d members", len(compliance.Members))
+	}
+
+	// Neither an invited user nor an unknown email can be given a role before joining, and both get the same error
+	membersPath := "/orgs/" + organization.Id + "/members"
+	resp, invitedError := doError(t, server, newJsonRequest(t, server, "POST", membersPath, ownerAccessToken, api.SaveOrganizationMemberRequest{Email: "Invited@example.com", Role: api.RoleMember}))
+	expectStatus(t, resp, http.StatusNotFound)
+	resp, unknownError := doError(t, server, newJsonRequest(t, server, "POST", membersPath, ownerAccessToken, api.SaveOrganizationMemberRequest{Email: "unknown@example.com", Role: api.RoleMember}))
+	expectStatus(t, resp, http.StatusNotFound)
+	if invitedError.Code != unknownError.Code || invitedError.Message != unknownError.Message {
+		t.Fatalf("expected the same errors, got %+v and %+v", invitedError, unknownError)
+	}
+
+	var invitations []api.OrganizationInvitation
+	resp = doJson(t, server, "GET", "/invitations", invitedAccessToken, nil, &invitations)
+	expectStatus(t, resp, http.StatusOK)
+	if len(invitations) != 1 || invitations[0].Id != invitation.Id {
+		t.Fatalf("expected the invitation, got %+v", invitations)
+	}
+
+	// Only the invited user can accept, with the code of the last invitation mail
+	readInvitationCode(t, mailDir, "unknown@example.com", 1)
+	firstCode := readInvitationCode(t, mailDir, "invited@example.com", 1)
+	code := readInvitationCode(t, mailDir, "invited@example.com", 2)
+	acceptPath := "/invitations/" + invitation.Id + "/accept"
+	resp = doJson(t, server, "POST", acceptPath, otherAccessToken, api.AcceptInvitationRequest{Token: code}, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+	resp = doJson(t, server, "POST", acceptPath, invitedAccessToken, nil, nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+	resp, invalidCodeError := doError(t, server, newJsonRequest(t, server, "POST", acceptPath, invitedAccessToken, api.AcceptInvitationRequest{Token: firstCode}))
+	expectStatus(t, resp, http.StatusBadRequest)
+	if invalidCodeError.Code != api.ErrorCodeInvalidToken {
+		t.Fatalf("expected an invalid token error, got %+v", invalidCodeError)
+	}
+
+	var joined api.Organization
+	resp = doJson(t, server, "POST", acceptPath, invitedAccessToken, api.AcceptInvitationRequest{Token: code}, &joined)
+	expectStatus(t, resp, http.StatusOK)
+	if joined.Id != organization.Id || joined.Role != api.RoleOfficer {
+		t.Fatalf("expected to join as officer, got %+v", joined)
+	}
+	resp = doJson(t, server, "GET", "/orgs/"+organization.Id+"/compliance", ownerAccessToken, nil, &compliance)
+	expectStatus(t, resp, http.StatusOK)
+	if len(compliance.Members) != 2 {
+		t.Fatalf("expected 2 members in the compliance report, got %d", len(compliance.Members))
+	}
+	resp = doJson(t, server, "POST", invitationsPath, ownerAccessToken, api.InviteOrganizationMemberRequest{Email: "invited@example.com", Role: api.RoleMember}, nil)
+	expectStatus(t, resp, http.StatusConflict)
+
+	// The pending invitations can be cancelled by the officers
+	resp = doJson(t, server, "GET", invitationsPath, ownerAccessToken, nil, &invitations)
+	expectStatus(t, resp, http.StatusOK)
+	if len(invitations) != 1 || invitations[0].Id != unknownInvitation.Id {
+		t.Fatalf("expected the invitation of the unknown email, got %+v", invitations)
+	}
+	resp = doJson(t, server, "DELETE", invitationsPath+"/"+unknownInvitation.Id, ownerAccessToken, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	resp = doJson(t, server, "DELETE", invitationsPath+"/"+unknownInvitation.Id, ownerAccessToken, nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestDeclineOrganizationInvitation(t *testing.T) {
+	server, mailDir := newTestServerWithMails(t, newTestStore(t))
+	ownerAccessToken := register(t, server, "owner@example.com")
+	invitedAccessToken := register(t, server, "invited@example.com")
+
+	var organization api.Organization
+	resp := doJson(t, server, "POST", "/orgs", ownerAccessToken, api.CreateOrganizationRequest{Name: "Guild"}, &organization)
+	expectStatus(t, resp, http.StatusCreated)
+	var invitation api.OrganizationInvitation
+	resp = doJson(t, server, "POST", "/orgs/"+organization.Id+"/invitations", ownerAccessToken, api.InviteOrganizationMemberRequest{Email: "invited@example.com", Role: api.RoleMember}, &invitation)
+	expectStatus(t, resp, http.StatusOK)
+
+	resp = doJson(t, server, "DELETE", "/invitations/"+invitation.Id, invitedAccessToken, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	code := readInvitationCode(t, mailDir, "invited@example.com", 1)
+	resp = doJson(t, server, "POST", "/invitations/"+invitation.Id+"/accept", invitedAccessToken, api.AcceptInvitationRequest{Token: code}, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	var organizations []api.Organization
+	resp = doJson(t, server, "GET", "/orgs", invitedAccessToken, nil, &organizations)
+	expectStatus(t, resp, http.StatusOK)
+	if len(organizations) != 0 {
+		t.Fatalf("expected no organization, got %d", len(organizations))
+	}
+}
+
+// joinOrganization invites the user to the organization with the role for the first time, and accepts the invitation
+// with the mailed code.
+func joinOrganization(t *testing.T, server *httptest.Server, mailDir string, ownerAccessToken string, organizationId string, email string, accessToken string, role api.OrganizationRole) {
+	t.Helper()
+	var invitation api.OrganizationInvitation
+	resp := doJson(t, server, "POST", "/orgs/"+organizationId+"/invitations", ownerAccessToken, api.InviteOrganizationMemberRequest{Email: email, Role: role}, &invitation)
+	expectStatus(t, resp, http.StatusOK)
+	code := readInvitationCode(t, mailDir, email, 1)
+	resp = doJson(t, server, "POST", "/invitations/"+invitation.Id+"/accept", accessToken, api.AcceptInvitationRequest{Token: code}, nil)
+	expectStatus(t, resp, http.StatusOK)
+}
+
+func TestOrganizationMemberRoles(t *testing.T) {
+	server, mailDir := newTestServerWithMails(t, newTestStore(t))
+	ownerAccessToken := register(t, server, "owner@example.com")
+	officerAccessToken := register(t, server, "officer@example.com")
+	otherOfficerAccessToken := register(t, server, "other-officer@example.com")
+	memberAccessToken := register(t, server, "member@example.com")
+
+	var organization api.Organization
+	resp := doJson(t, server, "POST", "/orgs", ownerAccessToken, api.CreateOrganizationRequest{Name: "Guild"}, &organization)
+	expectStatus(t, resp, http.StatusCreated)
+	joinOrganization(t, server, mailDir, ownerAccessToken, organization.Id, "officer@example.com", officerAccessToken, api.RoleOfficer)
+	joinOrganization(t, server, mailDir, ownerAccessToken, organization.Id, "other-officer@example.com", otherOfficerAccessToken, api.RoleOfficer)
+	joinOrganization(t, server, mailDir, ownerAccessToken, organization.Id, "member@example.com", memberAccessToken, api.RoleMember)
+	membersPath := "/orgs/" + organization.Id + "/members"
+
+	tests := []struct {
+		name        string
+		accessToken string
+		email       string
+		role        api.OrganizationRole
+		status      int
+	}{
+		{"a member cannot change roles", memberAccessToken, "member@example.com", api.RoleMember, http.StatusForbidden},
+		{"an officer cannot promote a member", officerAccessToken, "member@example.com", api.RoleOfficer, http.StatusForbidden},
+		{"an officer cannot demote another officer", officerAccessToken, "other-officer@example.com", api.RoleMember, http.StatusForbidden},
+		{"an officer can manage a member", officerAccessToken, "member@example.com", api.RoleMember, http.StatusOK},
+		{"the role of the owner cannot be changed", ownerAccessToken, "owner@example.com", api.RoleMember, http.StatusBadRequest},
+		{"the owner can demote an officer", ownerAccessToken, "other-officer@example.com", api.RoleMember, http.StatusOK},
+		{"the owner can promote a member", ownerAccessToken, "member@example.com", api.RoleOfficer, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := doJson(t, server, "POST", membersPath, test.accessToken, api.SaveOrganizationMemberRequest{Email: test.email, Role: test.role}, nil)
+			expectStatus(t, resp, test.status)
+		})
+	}
+
+	var saved api.Organization
+	resp = doJson(t, server, "GET", "/orgs/"+organization.Id, ownerAccessToken, nil, &saved)
+	expectStatus(t, resp, http.StatusOK)
+	roles := make(map[string]api.OrganizationRole)
+	for _, member := range saved.Members {
+		roles[member.Email] = member.Role
+	}
+	if roles["other-officer@example.com"] != api.RoleMember || roles["member@example.com"] != api.RoleOfficer {
+		t.Fatalf("expected the roles changed by the owner only, got %v", roles)
+	}
+}
+
+func TestComputeComplianceLatestVersionFromRequiredSource(t *testing.T) {
+	required := OrganizationAddon{GameVersion: Retail, Slug: "weakauras", Provider: Github, ExternalId: "WeakAuras/WeakAuras2", Requirement: RequirementRequired}
+	members := []OrganizationMember{
+		{UserId: "user_1", User: User{Email: "first@example.com"}, Role: RoleOwner},
+		{UserId: "user_2", User: User{Email: "second@example.com"}, Role: RoleMember},
+	}
+	now := time.Now()
+	memberAddons := []Addon{
+		{UserId: "user_1", GameVersion: Retail, Slug: "weakauras", Provider: Github, ExternalId: "WeakAuras/WeakAuras2", Version: "5.0.0", UpdatedAt: now.Add(-time.Hour)},
+		// A fork installed more recently does not make the version from the required source outdated
+		{UserId: "user_2", GameVersion: Retail, Slug: "weakauras", Provider: Github, ExternalId: "someone/WeakAuras2", Version: "9.9.9", UpdatedAt: now},
+	}
+
+	compliance := computeCompliance("org_1", []OrganizationAddon{required}, members, memberAddons)
+	statuses := make(map[string]api.AddonCompliance)
+	for _, member := range compliance.Members {
+		statuses[member.UserId] = member.Addons[0]
+	}
+	if first := statuses["user_1"]; first.Status != api.ComplianceOk || first.LatestVersion != "5.0.0" {
+		t.Errorf("expected the addon from the required source to be up to date, got %+v", first)
+	}
+	if second := statuses["user_2"]; second.Status != api.ComplianceWrongSource || second.LatestVersion != "5.0.0" {
+		t.Errorf("expected the fork to be reported as the wrong source, got %+v", second)
+	}
+}
+
+func TestAddonOfOrganization(t *testing.T) {
+	server, mailDir := newTestServerWithMails(t, newTestStore(t))
+	ownerAccessToken := register(t, server, "owner@example.com")
+	memberAccessToken := register(t, server, "member@example.com")
+	otherAccessToken := register(t, server, "other@example.com")
+
+	var organization api.Organization
+	resp := doJson(t, server, "POST", "/orgs", ownerAccessToken, api.CreateOrganizationRequest{Name: "Guild"}, &organization)
+	expectStatus(t, resp, http.StatusCreated)
+	joinOrganization(t, server, mailDir, ownerAccessToken, organization.Id, "member@example.com", memberAccessToken, api.RoleMember)
+
+	putAddonRequest := api.PutAddonRequest{
+		Name:           "WeakAuras",
+		Author:         "WeakAuras Team",
+		Provider:       api.Github,
+		ExternalId:     "WeakAuras/WeakAuras2",
+		Url:            "https://github.com/WeakAuras/WeakAuras2",
+		OrganizationId: &organization.Id,
+	}
+	var addon api.Addon
+	resp = doJson(t, server, "PUT", "/addons/retail/weakauras", memberAccessToken, putAddonRequest, &addon)
+	expectStatus(t, resp, http.StatusCreated)
+	if addon.OrganizationId == nil || *addon.OrganizationId != organization.Id {
+		t.Fatalf("expected the addon to be marked for the organization, got %v", addon.OrganizationId)
+	}
+
+	// Only the members can install addons for the organization
+	resp = doJson(t, server, "PUT", "/addons/retail/weakauras", otherAccessToken, putAddonRequest, nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	// Adding the addon again as the user clears the mark
+	putAddonRequest.OrganizationId = nil
+	resp = doJson(t, server, "PUT", "/addons/retail/weakauras", memberAccessToken, putAddonRequest, &addon)
+	expectStatus(t, resp, http.StatusOK)
+	if addon.OrganizationId != nil || addon.Revision != 2 {
+		t.Fatalf("expected the mark to be cleared in a new revision, got %+v", addon)
+	}
+}
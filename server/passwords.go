@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"wowa-api"
+)
+
+const passwordResetTokenTTL = time.Hour
+
+type PasswordResetToken struct {
+	Id        string    `gorm:"primarykey;not null"`
+	UserId    string    `gorm:"index;not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"not null"`
+	User      User
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=4"`
+}
+
+type RequestPasswordResetRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=4"`
+}
+
+func hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+func changePasswordHandler(store Store, validate *validator.Validate, jwtKey []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var changePasswordRequest ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&changePasswordRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(changePasswordRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		user, err := store.GetUserById(userId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(changePasswordRequest.CurrentPassword))
+		if err != nil {
+			writeError(w, r, http.StatusForbidden, api.ErrorCodeInvalidCredentials, "Invalid password")
+			return
+		}
+
+		hashedPassword, err := hashPassword(changePasswordRequest.NewPassword)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		err = store.UpdateUserPassword(user.Id, hashedPassword)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		// Every session was revoked, so start a new one for the client that changed the password
+		createSession(store, jwtKey, w, r, *user)
+	}
+}
+
+func requestPasswordResetHandler(store Store, validate *validator.Validate, mailer Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var resetRequest RequestPasswordResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&resetRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(resetRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Always answer the same way and at once, so neither the status nor the response time tells
+		// which emails are registered
+		go sendPasswordReset(store, mailer, resetRequest.Email)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// sendPasswordReset mails a reset code to the account of the email, if there is one.
+func sendPasswordReset(store Store, mailer Mailer, email string) {
+	user, err := store.GetUserByEmail(email)
+	if err != nil {
+		if err != ErrNotFound {
+			slog.Error("Failed to find the account to reset", "error", err)
+		}
+		return
+	}
+
+	token, tokenHash, err := generateSecret("")
+	if err != nil {
+		slog.Error("Failed to generate the reset code", "error", err)
+		return
+	}
+	resetToken := PasswordResetToken{
+		Id:        "reset_" + uuid.New().String(),
+		UserId:    user.Id,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(passwordResetTokenTTL),
+	}
+	err = store.CreatePasswordResetToken(&resetToken)
+	if err != nil {
+		slog.Error("Failed to save the reset code", "error", err)
+		return
+	}
+
+	err = mailer.Send(MailMessage{
+		To:      user.Email,
+		Subject: "Reset your wowa password",
+		Body: "Someone asked to reset the password of your wowa account.\n\n" +
+			"Paste this code in wowa to choose a new password. It expires in one hour and can only be used once.\n\n" +
+			token + "\n\n" +
+			"If it was not you, you can ignore this email.",
+	})
+	if err != nil {
+		slog.Error("Failed to send the reset code", "user_id", user.Id, "error", err)
+	}
+}
+
+func resetPasswordHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var resetPasswordRequest ResetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&resetPasswordRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(resetPasswordRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		hashedPassword, err := hashPassword(resetPasswordRequest.NewPassword)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		err = store.ConsumePasswordResetToken(hashSecret(resetPasswordRequest.Token), hashedPassword)
+		if err != nil {
+			if err == ErrNotFound {
+				writeError(w, r, http.StatusBadRequest, api.ErrorCodeInvalidToken, "Invalid or expired reset code")
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+}
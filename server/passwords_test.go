@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"wowa-api"
+)
+
+// resetCodePattern finds the code in the password reset mails, alone on its line.
+var resetCodePattern = regexp.MustCompile(`(?m)^(\S+)$`)
+
+// requestResetCode asks for a password reset code, and returns the nth mailed to the email, from 1.
+func requestResetCode(t *testing.T, server *httptest.Server, mailDir string, email string, nth int) string {
+	t.Helper()
+	resp := doJson(t, server, "POST", "/password/reset/request", "", RequestPasswordResetRequest{Email: email}, nil)
+	expectStatus(t, resp, http.StatusAccepted)
+	mails := readMails(t, mailDir, email, nth)
+	match := resetCodePattern.FindStringSubmatch(mails[nth-1])
+	if match == nil {
+		t.Fatalf("expected a code in the mail: %s", mails[nth-1])
+	}
+	return match[1]
+}
+
+func TestPasswordResetInvalidatesTheOtherCodes(t *testing.T) {
+	server, mailDir := newTestServerWithMails(t, newTestStore(t))
+	register(t, server, "user@example.com")
+
+	firstCode := requestResetCode(t, server, mailDir, "user@example.com", 1)
+	secondCode := requestResetCode(t, server, mailDir, "user@example.com", 2)
+
+	resp := doJson(t, server, "POST", "/password/reset", "", ResetPasswordRequest{Token: secondCode, NewPassword: "new password"}, nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	for _, code := range []string{secondCode, firstCode} {
+		resp, errorResponse := doError(t, server, newJsonRequest(t, server, "POST", "/password/reset", "", ResetPasswordRequest{Token: code, NewPassword: "other password"}))
+		if resp.StatusCode != http.StatusBadRequest || errorResponse.Code != api.ErrorCodeInvalidToken {
+			t.Fatalf("expected the code to be invalid once a code was used, got %d %s", resp.StatusCode, errorResponse.Code)
+		}
+	}
+
+	resp = doJson(t, server, "POST", "/login", "", LoginRequest{Email: "user@example.com", Password: "new password"}, nil)
+	expectStatus(t, resp, http.StatusOK)
+}
+
+func TestLogMailerOnlyLogsBodiesWhenAsked(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+	})
+
+	message := MailMessage{To: "user@example.com", Subject: "Reset your wowa password", Body: "secret-code"}
+	if err := (&LogMailer{}).Send(message); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logs.String(), "secret-code") || !strings.Contains(logs.String(), "user@example.com") {
+		t.Fatalf("expected only the recipient and subject to be logged, got %s", logs.String())
+	}
+
+	if err := (&LogMailer{logBodies: true}).Send(message); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "secret-code") {
+		t.Fatalf("expected the body to be logged when asked, got %s", logs.String())
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+
+	"wowa-api"
+)
+
+// ProviderCacheEntry caches the latest release of an addon at its provider, shared by all the users.
+type ProviderCacheEntry struct {
+	// The provider, game version and ID of the lookup
+	Key string `gorm:"primarykey;not null"`
+	// The JSON of the resolved addon, empty when the provider does not have the addon
+	Value     string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+var (
+	errAddonNotFound         = errors.New("addon not found at its provider")
+	errProviderNotConfigured = errors.New("provider not configured")
+)
+
+var (
+	curseSlugPattern        = regexp.MustCompile(`^[a-zA-Z0-9-_]+$`)
+	githubRepositoryPattern = regexp.MustCompile(`^[a-zA-Z0-9-_.]+/[a-zA-Z0-9-_.]+$`)
+)
+
+// The number of lookups of a batch asked to the providers at the same time
+const resolverConcurrency = 8
+
+// AddonResolver resolves the latest release of the addons with the provider keys of the server,
+// so the clients need no key of their own, and caches the releases in the database.
+type AddonResolver struct {
+	store       Store
+	httpClient  *http.Client
+	curseApiKey string
+	githubToken string
+	// How long a release is served from the cache before asking its provider again
+	ttl time.Duration
+	now func() time.Time
+}
+
+func NewAddonResolver(store Store, curseApiKey string, githubToken string, ttl time.Duration) *AddonResolver {
+	return &AddonResolver{
+		store:       store,
+		httpClient:  &http.Client{Timeout: 15 * time.Second},
+		curseApiKey: curseApiKey,
+		githubToken: githubToken,
+		ttl:         ttl,
+		now:         time.Now,
+	}
+}
+
+// newAddonResolverFromConfig returns the addon resolver, or nil when the server has no provider key.
+func newAddonResolverFromConfig(config Config, store Store) *AddonResolver {
+	if config.CurseApiKey == "" && config.GithubToken == "" {
+		return nil
+	}
+	return NewAddonResolver(store, config.CurseApiKey, config.GithubToken, config.ProviderCacheTtl)
+}
+
+func providerCacheKey(lookup api.AddonLookup) string {
+	return fmt.Sprintf("%s:%s:%s", lookup.Provider, lookup.GameVersion, lookup.Id)
+}
+
+func resolutionError(lookup api.AddonLookup, code api.ErrorCode, message string) api.AddonResolution {
+	return api.AddonResolution{AddonLookup: lookup, Error: &api.ErrorResponse{Code: code, Message: message}}
+}
+
+// cachedResolution returns the resolution held by a cache entry.
+func cachedResolution(lookup api.AddonLookup, entry *ProviderCacheEntry) (api.AddonResolution, error) {
+	if entry.Value == "" {
+		return resolutionError(lookup, api.ErrorCodeNotFound, "Addon not found"), nil
+	}
+	var addon api.ResolvedAddon
+	if err := json.Unmarshal([]byte(entry.Value), &addon); err != nil {
+		return api.AddonResolution{}, err
+	}
+	return api.AddonResolution{AddonLookup: lookup, Addon: &addon}, nil
+}
+
+// ResolveAll resolves the lookups a few at a time, and returns their resolutions in the same order.
+func (ar *AddonResolver) ResolveAll(ctx context.Context, lookups []api.AddonLookup) []api.AddonResolution {
+	resolutions := make([]api.AddonResolution, len(lookups))
+	semaphore := make(chan struct{}, resolverConcurrency)
+	var wg sync.WaitGroup
+	for i, lookup := range lookups {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			resolutions[i] = ar.Resolve(ctx, lookup)
+		}()
+	}
+	wg.Wait()
+	return resolutions
+}
+
+// Resolve returns the cached release of the addon, else asks its provider and caches the answer. The addons
+// missing at their provider are cached too, while the provider failures are not, and are answered with the
+// expired release when there is one.
+func (ar *AddonResolver) Resolve(ctx context.Context, lookup api.AddonLookup) api.AddonResolution {
+	if !isValidAddonLookupId(lookup) {
+		return resolutionError(lookup, api.ErrorCodeNotFound, "Addon not found")
+	}
+
+	key := providerCacheKey(lookup)
+	cached, err := ar.store.GetProviderCacheEntry(key)
+	if err != nil && err != ErrNotFound {
+		slog.WarnContext(ctx, "Failed to read the provider cache", "key", key, "error", err)
+	}
+	if err == nil && cached.ExpiresAt.After(ar.now()) {
+		resolution, err := cachedResolution(lookup, cached)
+		if err == nil {
+			return resolution
+		}
+		slog.WarnContext(ctx, "Failed to decode the provider cache", "key", key, "error", err)
+	}
+
+	addon, fetchErr := ar.fetch(ctx, lookup)
+	if fetchErr != nil && !errors.Is(fetchErr, errAddonNotFound) {
+		if errors.Is(fetchErr, errProviderNotConfigured) {
+			return resolutionError(lookup, api.ErrorCodeProviderUnavailable, fmt.Sprintf("The %s provider is not configured on this server", lookup.Provider))
+		}
+		slog.WarnContext(ctx, "Failed to ask the addon provider", "key", key, "error", fetchErr)
+		// An outdated release is better than none while the provider is down
+		if cached != nil {
+			if resolution, err := cachedResolution(lookup, cached); err == nil {
+				return resolution
+			}
+		}
+		return resolutionError(lookup, api.ErrorCodeProviderUnavailable, fmt.Sprintf("The %s provider is unavailable", lookup.Provider))
+	}
+
+	ar.save(ctx, key, addon)
+	if addon == nil {
+		return resolutionError(lookup, api.ErrorCodeNotFound, "Addon not found")
+	}
+	return api.AddonResolution{AddonLookup: lookup, Addon: addon}
+}
+
+// save caches the resolved addon, or that the provider does not have it when addon is nil.
+// The resolution is answered anyway, so a failure is only logged.
+func (ar *AddonResolver) save(ctx context.Context, key string, addon *api.ResolvedAddon) {
+	entry := ProviderCacheEntry{Key: key, ExpiresAt: ar.now().Add(ar.ttl)}
+	if addon != nil {
+		value, err := json.Marshal(addon)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to encode the resolved addon", "key", key, "error", err)
+			return
+		}
+		entry.Value = string(value)
+	}
+	if err := ar.store.SaveProviderCacheEntry(&entry); err != nil {
+		slog.WarnContext(ctx, "Failed to save the provider cache", "key", key, "error", err)
+	}
+}
+
+// isValidAddonLookupId checks the ID of a lookup before building the provider URLs with it.
+func isValidAddonLookupId(lookup api.AddonLookup) bool {
+	switch lookup.Provider {
+	case api.Curse:
+		return curseSlugPattern.MatchString(lookup.Id)
+	case api.Github:
+		return githubRepositoryPattern.MatchString(lookup.Id)
+	default:
+		return false
+	}
+}
+
+func (ar *AddonResolver) fetch(ctx context.Context, lookup api.AddonLookup) (*api.ResolvedAddon, error) {
+	switch lookup.Provider {
+	case api.Curse:
+		if ar.curseApiKey == "" {
+			return nil, errProviderNotConfigured
+		}
+		return ar.fetchCurse(ctx, lookup.Id, lookup.GameVersion)
+	case api.Github:
+		if ar.githubToken == "" {
+			return nil, errProviderNotConfigured
+		}
+		return ar.fetchGithub(ctx, lookup.Id, lookup.GameVersion)
+	default:
+		return nil, errAddonNotFound
+	}
+}
+
+// getJson decodes the response of a provider, returning errAddonNotFound on 404.
+func (ar *AddonResolver) getJson(ctx context.Context, requestUrl string, query url.Values, headers map[string]string, target interface{}) error {
+	if query != nil {
+		requestUrl += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", requestUrl, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := ar.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(resp.Body).Decode(target)
+	case http.StatusNotFound:
+		return errAddonNotFound
+	default:
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+}
+
+// fetchCurse returns the latest release file of a CurseForge addon for the game version.
+func (ar *AddonResolver) fetchCurse(ctx context.Context, slug string, gameVersion GameVersion) (*api.ResolvedAddon, error) {
+	type curseModFileIndex struct {
+		FileId            int `json:"fileId"`
+		GameVersionTypeId int `json:"gameVersionTypeId"`
+		ReleaseType       int `json:"releaseType"`
+	}
+	type curseMod struct {
+		Id                 int                 `json:"id"`
+		Slug               string              `json:"slug"`
+		Name               string              `json:"name"`
+		LatestFilesIndexes []curseModFileIndex `json:"latestFilesIndexes"`
+		Authors            []struct {
+			Name string `json:"name"`
+		} `json:"authors"`
+	}
+
+	var gameVersionTypeId int
+	switch gameVersion {
+	case Retail:
+		gameVersionTypeId = 517
+	case Classic:
+		gameVersionTypeId = 67408
+	}
+	headers := map[string]string{"x-api-key": ar.curseApiKey}
+
+	var searchResponse struct {
+		Data []curseMod `json:"data"`
+	}
+	err := ar.getJson(ctx, "https://api.curseforge.com/v1/mods/search", url.Values{
+		"gameId":            {"1"},
+		"gameVersionTypeId": {strconv.Itoa(gameVersionTypeId)},
+		"slug":              {slug},
+		"index":             {"0"},
+		"sortField":         {"2"}, // popularity
+		"sortOrder":         {"desc"},
+	}, headers, &searchResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	var mod *curseMod
+	for i := range searchResponse.Data {
+		if searchResponse.Data[i].Slug == slug {
+			mod = &searchResponse.Data[i]
+			break
+		}
+	}
+	if mod == nil {
+		return nil, errAddonNotFound
+	}
+
+	// The latest release file of the game version
+	var fileIndex *curseModFileIndex
+	for i := range mod.LatestFilesIndexes {
+		index := &mod.LatestFilesIndexes[i]
+		if index.ReleaseType == 1 && index.GameVersionTypeId == gameVersionTypeId {
+			fileIndex = index
+			break
+		}
+	}
+	if fileIndex == nil {
+		return nil, errAddonNotFound
+	}
+
+	var fileResponse struct {
+		Data struct {
+			DisplayName string `json:"displayName"`
+			DownloadUrl string `json:"downloadUrl"`
+		} `json:"data"`
+	}
+	fileUrl := fmt.Sprintf("https://api.curseforge.com/v1/mods/%d/files/%d", mod.Id, fileIndex.FileId)
+	if err := ar.getJson(ctx, fileUrl, nil, headers, &fileResponse); err != nil {
+		return nil, err
+	}
+
+	author := ""
+	if len(mod.Authors) > 0 {
+		author = mod.Authors[0].Name
+	}
+	return &api.ResolvedAddon{
+		Slug:        slug,
+		Name:        mod.Name,
+		Author:      author,
+		GameVersion: gameVersion,
+		Version:     fileResponse.Data.DisplayName,
+		Provider:    api.Curse,
+		ExternalId:  strconv.Itoa(mod.Id),
+		FileId:      strconv.Itoa(fileIndex.FileId),
+		Channel:     api.ChannelRelease,
+		Url:         "https://www.curseforge.com/wow/addons/" + mod.Slug,
+		DownloadUrl: fileResponse.Data.DownloadUrl,
+	}, nil
+}
+
+// fetchGithub returns the zip asset of the latest release of a GitHub repository, by its "owner/repository".
+func (ar *AddonResolver) fetchGithub(ctx context.Context, ownerAndRepository string, gameVersion GameVersion) (*api.ResolvedAddon, error) {
+	var release struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Id                 int    `json:"id"`
+			BrowserDownloadUrl string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	releaseUrl := fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", ownerAndRepository)
+	headers := map[string]string{"Authorization": "token " + ar.githubToken}
+	if err := ar.getJson(ctx, releaseUrl, nil, headers, &release); err != nil {
+		return nil, err
+	}
+
+	owner, repository, _ := strings.Cut(ownerAndRepository, "/")
+	for _, asset := range release.Assets {
+		if !strings.HasSuffix(asset.BrowserDownloadUrl, ".zip") {
+			continue
+		}
+		return &api.ResolvedAddon{
+			Slug:        repository,
+			Name:        repository,
+			Author:      owner,
+			GameVersion: gameVersion,
+			Version:     release.TagName,
+			Provider:    api.Github,
+			ExternalId:  ownerAndRepository,
+			FileId:      strconv.Itoa(asset.Id),
+			Channel:     api.ChannelRelease,
+			Url:         "https://github.com/" + ownerAndRepository,
+			// Unlike the API asset URL, the browser URL of a public repository needs no token
+			DownloadUrl: asset.BrowserDownloadUrl,
+		}, nil
+	}
+	return nil, errAddonNotFound
+}
+
+// resolveAddonsHandler resolves the latest release of a batch of addons, each with its addon or its error.
+func resolveAddonsHandler(resolver *AddonResolver, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var resolveRequest api.ResolveAddonsRequest
+		if err := json.NewDecoder(r.Body).Decode(&resolveRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(resolveRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		writeJson(w, &api.ResolveAddonsResponse{Addons: resolver.ResolveAll(r.Context(), resolveRequest.Addons)})
+	}
+}
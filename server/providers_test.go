@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"wowa-api"
+)
+
+// The GitHub token expected by the provider stub
+const testGithubToken = "github-token"
+
+// providerStub answers the GitHub release requests sent to the providers, with its status.
+type providerStub struct {
+	status   atomic.Int32
+	requests atomic.Int32
+}
+
+// redirectTransport sends the requests to the providers to a test server instead.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rt.target.Scheme
+	req.URL.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestResolver returns a resolver with a GitHub token, asking the stub instead of GitHub, at the time of now.
+func newTestResolver(t *testing.T, githubToken string, now *time.Time) (*AddonResolver, *providerStub) {
+	t.Helper()
+	stub := &providerStub{}
+	stub.status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.requests.Add(1)
+		if r.URL.Path != "/repos/Tercioo/Details-Damage-Meter/releases/latest" || r.Header.Get("Authorization") != "token "+testGithubToken {
+			http.NotFound(w, r)
+			return
+		}
+		if status := int(stub.status.Load()); status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"tag_name": "1.0.0",
+			"assets": []map[string]interface{}{
+				{"id": 12, "browser_download_url": "https://github.com/Tercioo/Details-Damage-Meter/releases/download/1.0.0/Details.zip"},
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := NewAddonResolver(newTestStore(t), "", githubToken, time.Hour)
+	resolver.httpClient = &http.Client{Transport: redirectTransport{target: target}}
+	resolver.now = func() time.Time { return *now }
+	return resolver, stub
+}
+
+var detailsLookup = api.AddonLookup{Provider: api.Github, Id: "Tercioo/Details-Damage-Meter", GameVersion: api.Retail}
+
+func expectResolvedVersion(t *testing.T, resolution api.AddonResolution, version string) {
+	t.Helper()
+	if resolution.Error != nil {
+		t.Fatalf("expected the addon, got %+v", resolution.Error)
+	}
+	if resolution.Addon.Version != version || resolution.Addon.ExternalId != detailsLookup.Id {
+		t.Fatalf("expected version %s of the addon, got %+v", version, resolution.Addon)
+	}
+}
+
+func expectResolutionError(t *testing.T, resolution api.AddonResolution, code api.ErrorCode) {
+	t.Helper()
+	if resolution.Error == nil || resolution.Error.Code != code {
+		t.Fatalf("expected the error %s, got %+v", code, resolution)
+	}
+}
+
+func expectProviderRequests(t *testing.T, stub *providerStub, count int) {
+	t.Helper()
+	if requests := int(stub.requests.Load()); requests != count {
+		t.Fatalf("expected %d requests to the provider, got %d", count, requests)
+	}
+}
+
+func TestResolveCachesTheReleases(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	resolver, stub := newTestResolver(t, testGithubToken, &now)
+
+	expectResolvedVersion(t, resolver.Resolve(context.Background(), detailsLookup), "1.0.0")
+	expectProviderRequests(t, stub, 1)
+
+	// The release is served from the cache until it expires
+	now = now.Add(59 * time.Minute)
+	expectResolvedVersion(t, resolver.Resolve(context.Background(), detailsLookup), "1.0.0")
+	expectProviderRequests(t, stub, 1)
+
+	now = now.Add(2 * time.Minute)
+	expectResolvedVersion(t, resolver.Resolve(context.Background(), detailsLookup), "1.0.0")
+	expectProviderRequests(t, stub, 2)
+}
+
+func TestResolveCachesTheMissingAddons(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	resolver, stub := newTestResolver(t, testGithubToken, &now)
+	stub.status.Store(http.StatusNotFound)
+
+	expectResolutionError(t, resolver.Resolve(context.Background(), detailsLookup), api.ErrorCodeNotFound)
+	expectResolutionError(t, resolver.Resolve(context.Background(), detailsLookup), api.ErrorCodeNotFound)
+	expectProviderRequests(t, stub, 1)
+
+	// The addon is asked again once the answer expires
+	stub.status.Store(http.StatusOK)
+	now = now.Add(2 * time.Hour)
+	expectResolvedVersion(t, resolver.Resolve(context.Background(), detailsLookup), "1.0.0")
+	expectProviderRequests(t, stub, 2)
+}
+
+func TestResolveFallsBackToTheExpiredRelease(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	resolver, stub := newTestResolver(t, testGithubToken, &now)
+
+	// Without a cached release, a provider failure is answered as such
+	stub.status.Store(http.StatusBadGateway)
+	expectResolutionError(t, resolver.Resolve(context.Background(), detailsLookup), api.ErrorCodeProviderUnavailable)
+
+	stub.status.Store(http.StatusOK)
+	expectResolvedVersion(t, resolver.Resolve(context.Background(), detailsLookup), "1.0.0")
+
+	// The failures are not cached, so the provider is asked each time, and the expired release is answered
+	stub.status.Store(http.StatusBadGateway)
+	now = now.Add(2 * time.Hour)
+	expectResolvedVersion(t, resolver.Resolve(context.Background(), detailsLookup), "1.0.0")
+	expectResolvedVersion(t, resolver.Resolve(context.Background(), detailsLookup), "1.0.0")
+	expectProviderRequests(t, stub, 4)
+}
+
+func TestResolveWithoutProviderKey(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	resolver, stub := newTestResolver(t, "", &now)
+
+	expectResolutionError(t, resolver.Resolve(context.Background(), detailsLookup), api.ErrorCodeProviderUnavailable)
+	curseLookup := api.AddonLookup{Provider: api.Curse, Id: "details", GameVersion: api.Retail}
+	expectResolutionError(t, resolver.Resolve(context.Background(), curseLookup), api.ErrorCodeProviderUnavailable)
+	expectProviderRequests(t, stub, 0)
+
+	// The answer is not cached, so the addon resolves once the provider is configured
+	resolver.githubToken = testGithubToken
+	expectResolvedVersion(t, resolver.Resolve(context.Background(), detailsLookup), "1.0.0")
+}
+
+func TestResolveRejectsInvalidIds(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	resolver, stub := newTestResolver(t, testGithubToken, &now)
+
+	invalidLookup := api.AddonLookup{Provider: api.Github, Id: "../../users", GameVersion: api.Retail}
+	expectResolutionError(t, resolver.Resolve(context.Background(), invalidLookup), api.ErrorCodeNotFound)
+	expectProviderRequests(t, stub, 0)
+}
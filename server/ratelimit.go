@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wowa-api"
+)
+
+// LoginThrottle counts the failed logins of a client IP address or of an account, and holds its lockout.
+type LoginThrottle struct {
+	Key         string    `gorm:"primarykey;not null"`
+	Failures    int       `gorm:"not null"`
+	LockedUntil time.Time `gorm:"not null"`
+	UpdatedAt   time.Time `gorm:"not null"`
+}
+
+// LimiterStore keeps the login throttles. GetLoginThrottle returns ErrNotFound for a key without failures.
+type LimiterStore interface {
+	GetLoginThrottle(key string) (*LoginThrottle, error)
+	// RecordLoginFailure atomically counts a failure of the key, starting over when the last one is older than
+	// the policy allows, and locks the key out when the policy says so. It returns the updated throttle.
+	RecordLoginFailure(key string, policy LoginLimitPolicy, now time.Time) (*LoginThrottle, error)
+	DeleteLoginThrottle(key string) error
+}
+
+// MemoryLimiterStore keeps the login throttles in memory, so they are lost on restart and not shared between servers.
+type MemoryLimiterStore struct {
+	mu        sync.Mutex
+	throttles map[string]LoginThrottle
+}
+
+// The number of throttles over which the stale ones are dropped from memory
+const memoryLimiterStorePruneSize = 10000
+
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	return &MemoryLimiterStore{throttles: make(map[string]LoginThrottle)}
+}
+
+func (s *MemoryLimiterStore) GetLoginThrottle(key string) (*LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle, ok := s.throttles[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &throttle, nil
+}
+
+func (s *MemoryLimiterStore) RecordLoginFailure(key string, policy LoginLimitPolicy, now time.Time) (*LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.throttles) >= memoryLimiterStorePruneSize {
+		staleBefore := time.Now().Add(-24 * time.Hour)
+		for staleKey, stored := range s.throttles {
+			if stored.UpdatedAt.Before(staleBefore) && stored.LockedUntil.Before(time.Now()) {
+				delete(s.throttles, staleKey)
+			}
+		}
+	}
+
+	throttle, ok := s.throttles[key]
+	if !ok || now.Sub(throttle.UpdatedAt) > policy.ResetAfter {
+		throttle = LoginThrottle{Key: key}
+	}
+	throttle.Failures++
+	throttle.UpdatedAt = now
+	if lockout := policy.lockout(throttle.Failures); lockout > 0 {
+		throttle.LockedUntil = now.Add(lockout)
+	}
+	s.throttles[key] = throttle
+	return &throttle, nil
+}
+
+func (s *MemoryLimiterStore) DeleteLoginThrottle(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.throttles, key)
+	return nil
+}
+
+// newLimiterStoreFromConfig picks where the login throttles are kept, "memory" or "database"
+// to share them between servers.
+func newLimiterStoreFromConfig(config Config, store Store) (LimiterStore, error) {
+	switch config.RateLimitStore {
+	case "memory":
+		return NewMemoryLimiterStore(), nil
+	case "database":
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unsupported rate limit store: %s", config.RateLimitStore)
+	}
+}
+
+// LoginLimitPolicy is how many failed logins are allowed, and how long the lockouts that follow last.
+type LoginLimitPolicy struct {
+	// The failures allowed before the first lockout
+	MaxFailures int
+	// The first lockout, doubled by every following failure up to MaxLockout
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// The failures are forgotten after this long without a new one
+	ResetAfter time.Duration
+}
+
+// lockout returns how long to lock out after the given number of failures, zero when still allowed.
+func (p LoginLimitPolicy) lockout(failures int) time.Duration {
+	if failures < p.MaxFailures {
+		return 0
+	}
+	lockout := p.BaseLockout
+	for i := p.MaxFailures; i < failures && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, p.MaxLockout)
+}
+
+var (
+	// An IP address may be shared by many users, so it gets more attempts than an account
+	defaultIpLoginLimitPolicy = LoginLimitPolicy{
+		MaxFailures: 20, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour,
+	}
+	defaultAccountLoginLimitPolicy = LoginLimitPolicy{
+		MaxFailures: 5, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour,
+	}
+
+	// Every password reset request sends a mail, so an account only gets a few a day
+	defaultIpPasswordResetLimitPolicy = LoginLimitPolicy{
+		MaxFailures: 20, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour,
+	}
+	defaultAccountPasswordResetLimitPolicy = LoginLimitPolicy{
+		MaxFailures: 3, BaseLockout: 15 * time.Minute, MaxLockout: 24 * time.Hour, ResetAfter: 24 * time.Hour,
+	}
+)
+
+// LoginLimiter locks out the IP addresses and the accounts with too many failed logins, or with too many
+// attempts at another route limited the same way.
+type LoginLimiter struct {
+	// Prefixes the throttled keys, so the limiters can share a store
+	name          string
+	store         LimiterStore
+	ipPolicy      LoginLimitPolicy
+	accountPolicy LoginLimitPolicy
+	// The number of reverse proxies appending the client IP address to X-Forwarded-For, zero to use the
+	// address of the connection instead
+	trustedProxies int
+	now            func() time.Time
+}
+
+func NewLoginLimiter(name string, store LimiterStore, ipPolicy LoginLimitPolicy, accountPolicy LoginLimitPolicy, trustedProxies int) *LoginLimiter {
+	return &LoginLimiter{name: name, store: store, ipPolicy: ipPolicy, accountPolicy: accountPolicy, trustedProxies: trustedProxies, now: time.Now}
+}
+
+// newLimitersFromConfig creates the login and the password reset limiters with the default policies,
+// sharing the configured store.
+func newLimitersFromConfig(config Config, store Store) (*LoginLimiter, *LoginLimiter, error) {
+	limiterStore, err := newLimiterStoreFromConfig(config, store)
+	if err != nil {
+		return nil, nil, err
+	}
+	trustedProxies := 0
+	if config.RateLimitTrustProxy {
+		trustedProxies = config.RateLimitProxyHops
+	}
+	loginLimiter := NewLoginLimiter("login", limiterStore, defaultIpLoginLimitPolicy, defaultAccountLoginLimitPolicy, trustedProxies)
+	passwordResetLimiter := NewLoginLimiter("password-reset", limiterStore, defaultIpPasswordResetLimitPolicy, defaultAccountPasswordResetLimitPolicy, trustedProxies)
+	return loginLimiter, passwordResetLimiter, nil
+}
+
+// limiterKey is a throttled key with the policy that applies to it.
+type limiterKey struct {
+	key    string
+	policy LoginLimitPolicy
+	// Whether a successful login forgives the failures of the key
+	forgiven bool
+}
+
+func (l *LoginLimiter) getClientIp(r *http.Request) string {
+	if l.trustedProxies > 0 {
+		// Each proxy appends the address it received the request from, so the client is the address added
+		// by the first trusted proxy. The addresses before it are sent by the client, and can be anything.
+		if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+			addresses := strings.Split(strings.Join(forwardedFor, ","), ",")
+			return strings.TrimSpace(addresses[max(len(addresses)-l.trustedProxies, 0)])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// keys returns the throttled keys of a login, the account only when the email is known.
+// The email is hashed, since anything can be sent as an email before the validation.
+func (l *LoginLimiter) keys(r *http.Request, email string) []limiterKey {
+	keys := []limiterKey{{key: l.name + ":ip:" + l.getClientIp(r), policy: l.ipPolicy}}
+	if email != "" {
+		accountKey := l.name + ":account:" + hashSecret(normalizeEmail(email))
+		keys = append(keys, limiterKey{key: accountKey, policy: l.accountPolicy, forgiven: true})
+	}
+	return keys
+}
+
+// getLockedUntil returns the end of the longest lockout of the keys, or the zero time.
+func (l *LoginLimiter) getLockedUntil(keys []limiterKey) (time.Time, error) {
+	var lockedUntil time.Time
+	for _, limited := range keys {
+		throttle, err := l.store.GetLoginThrottle(limited.key)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if throttle.LockedUntil.After(lockedUntil) {
+			lockedUntil = throttle.LockedUntil
+		}
+	}
+	return lockedUntil, nil
+}
+
+// recordFailure counts a failed login for each key, and locks out the ones over their policy.
+// The store counts atomically, so the failures sent at once to several servers are all counted.
+func (l *LoginLimiter) recordFailure(keys []limiterKey) error {
+	now := l.now()
+	for _, limited := range keys {
+		if _, err := l.store.RecordLoginFailure(limited.key, limited.policy, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordSuccess forgives the failures of the keys that allow it.
+func (l *LoginLimiter) recordSuccess(keys []limiterKey) error {
+	for _, limited := range keys {
+		if !limited.forgiven {
+			continue
+		}
+		if err := l.store.DeleteLoginThrottle(limited.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitLogins rejects the logins from a locked out IP address or to a locked out account, with the same
+// response either way so it does not tell whether the account exists. The failed logins of the handler
+// are counted, and a successful one forgives the failures of the account.
+func limitLogins(limiter *LoginLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return limitAttempts(limiter, func(status int) bool {
+		return status == http.StatusUnauthorized || status == http.StatusBadRequest
+	}, next)
+}
+
+// limitPasswordResets counts every password reset request, since each one sends a mail, and every invalid
+// reset code, so neither an inbox can be flooded nor the codes guessed.
+func limitPasswordResets(limiter *LoginLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return limitAttempts(limiter, func(status int) bool {
+		return status == http.StatusAccepted || status == http.StatusBadRequest
+	}, next)
+}
+
+// limitAttempts rejects the requests from a locked out IP address or for a locked out account, taken from
+// the email of the body. The responses for which isFailure is true are counted against them, and a 200
+// forgives the failures of the account.
+func limitAttempts(limiter *LoginLimiter, isFailure func(status int) bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The body is read twice, here for the email and then by the handler
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var credentials struct {
+			Email string `json:"email"`
+		}
+		// An invalid body is rejected by the handler, and is still counted against the IP address
+		_ = json.Unmarshal(body, &credentials)
+		keys := limiter.keys(r, credentials.Email)
+
+		lockedUntil, err := limiter.getLockedUntil(keys)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		if now := limiter.now(); lockedUntil.After(now) {
+			retryAfter := int(lockedUntil.Sub(now).Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeError(w, r, http.StatusTooManyRequests, api.ErrorCodeTooManyRequests, "Too many attempts, try again later")
+			return
+		}
+
+		recorder := newStatusRecorder(w)
+		next(recorder, r)
+
+		switch {
+		case isFailure(recorder.status):
+			err = limiter.recordFailure(keys)
+		case recorder.status == http.StatusOK:
+			err = limiter.recordSuccess(keys)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to record the attempt", "limiter", limiter.name, "error", err)
+		}
+	}
+}
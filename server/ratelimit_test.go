@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/crypto/bcrypt"
+
+	"wowa-api"
+)
+
+// The account is locked out for 1m after 2 failures, then 2m, then 4m at most
+var testAccountLimitPolicy = LoginLimitPolicy{MaxFailures: 2, BaseLockout: time.Minute, MaxLockout: 4 * time.Minute, ResetAfter: time.Hour}
+
+// testLoginServer serves the limited login route, with a clock that only moves when told to.
+type testLoginServer struct {
+	limiter *LoginLimiter
+	handler http.HandlerFunc
+	now     time.Time
+}
+
+// forEachLimiterStore runs the test with the throttles kept in memory, then in the database.
+func forEachLimiterStore(t *testing.T, test func(t *testing.T, server *testLoginServer)) {
+	limiterStores := map[string]func(store Store) LimiterStore{
+		"memory":   func(store Store) LimiterStore { return NewMemoryLimiterStore() },
+		"database": func(store Store) LimiterStore { return store },
+	}
+	for name, newLimiterStore := range limiterStores {
+		t.Run(name, func(t *testing.T) {
+			store := newTestStore(t)
+			server := &testLoginServer{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+			server.limiter = NewLoginLimiter("login", newLimiterStore(store), defaultIpLoginLimitPolicy, testAccountLimitPolicy, 1)
+			server.limiter.now = func() time.Time { return server.now }
+			validate := validator.New(validator.WithRequiredStructEnabled())
+			server.handler = limitLogins(server.limiter, loginHandler(store, validate, []byte(testJwtKey)))
+
+			passwordHash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.CreateUser(&User{Id: "user_1", Email: "user@example.com", Password: string(passwordHash)}); err != nil {
+				t.Fatal(err)
+			}
+			test(t, server)
+		})
+	}
+}
+
+func (s *testLoginServer) login(t *testing.T, email string, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(LoginRequest{Email: email, Password: password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(string(body)))
+	req.RemoteAddr = "192.0.2.1:1234"
+	recorder := httptest.NewRecorder()
+	s.handler(recorder, req)
+	return recorder
+}
+
+func expectLoginStatus(t *testing.T, recorder *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, recorder.Code, recorder.Body.String())
+	}
+}
+
+func expectLockedOut(t *testing.T, recorder *httptest.ResponseRecorder, retryAfter time.Duration) {
+	t.Helper()
+	expectLoginStatus(t, recorder, http.StatusTooManyRequests)
+	// Rounded up, so clients never retry too early
+	expected := int(retryAfter.Seconds()) + 1
+	if recorder.Header().Get("Retry-After") != strconv.Itoa(expected) {
+		t.Fatalf("expected Retry-After %d, got %s", expected, recorder.Header().Get("Retry-After"))
+	}
+}
+
+func TestLoginLockoutGrows(t *testing.T) {
+	forEachLimiterStore(t, func(t *testing.T, server *testLoginServer) {
+		expectLoginStatus(t, server.login(t, "user@example.com", "wrong"), http.StatusUnauthorized)
+		expectLoginStatus(t, server.login(t, "user@example.com", "wrong"), http.StatusUnauthorized)
+
+		// Even the right password is rejected while locked out
+		expectLockedOut(t, server.login(t, "user@example.com", "password123"), time.Minute)
+		server.now = server.now.Add(30 * time.Second)
+		expectLockedOut(t, server.login(t, "user@example.com", "wrong"), 30*time.Second)
+
+		// Every failure after a lockout doubles the next one, up to the maximum
+		for _, lockout := range []time.Duration{2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+			server.now = server.now.Add(5 * time.Minute)
+			expectLoginStatus(t, server.login(t, "user@example.com", "wrong"), http.StatusUnauthorized)
+			expectLockedOut(t, server.login(t, "user@example.com", "wrong"), lockout)
+		}
+
+		server.now = server.now.Add(5 * time.Minute)
+		expectLoginStatus(t, server.login(t, "user@example.com", "password123"), http.StatusOK)
+	})
+}
+
+func TestLoginLockoutIsTheSameForUnknownAccounts(t *testing.T) {
+	forEachLimiterStore(t, func(t *testing.T, server *testLoginServer) {
+		responses := make(map[string]*httptest.ResponseRecorder)
+		for _, email := range []string{"user@example.com", "unknown@example.com"} {
+			first := server.login(t, email, "wrong")
+			second := server.login(t, email, "wrong")
+			expectLoginStatus(t, first, http.StatusUnauthorized)
+			expectLoginStatus(t, second, http.StatusUnauthorized)
+			if errorOf(t, first) != errorOf(t, second) {
+				t.Fatalf("expected the same failures for %s", email)
+			}
+			responses[email] = server.login(t, email, "wrong")
+			expectLockedOut(t, responses[email], time.Minute)
+		}
+
+		existing, unknown := responses["user@example.com"], responses["unknown@example.com"]
+		if errorOf(t, existing) != errorOf(t, unknown) {
+			t.Fatalf("expected the same lockouts, got %+v and %+v", errorOf(t, existing), errorOf(t, unknown))
+		}
+	})
+}
+
+func TestSuccessfulLoginForgivesTheAccount(t *testing.T) {
+	forEachLimiterStore(t, func(t *testing.T, server *testLoginServer) {
+		expectLoginStatus(t, server.login(t, "user@example.com", "wrong"), http.StatusUnauthorized)
+		expectLoginStatus(t, server.login(t, "user@example.com", "password123"), http.StatusOK)
+
+		// Without the forgiveness, this second failure would lock the account out
+		expectLoginStatus(t, server.login(t, "user@example.com", "wrong"), http.StatusUnauthorized)
+		expectLoginStatus(t, server.login(t, "user@example.com", "password123"), http.StatusOK)
+
+		// The failures of the IP address are not forgiven, since it may try other accounts
+		throttle, err := server.limiter.store.GetLoginThrottle("login:ip:192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if throttle.Failures != 2 {
+			t.Fatalf("expected 2 failures for the IP address, got %d", throttle.Failures)
+		}
+	})
+}
+
+func TestGetClientIp(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies int
+		forwardedFor   []string
+		expected       string
+	}{
+		{"without a proxy", 0, []string{"203.0.113.9"}, "192.0.2.1"},
+		{"without the header", 1, nil, "192.0.2.1"},
+		{"one proxy", 1, []string{"203.0.113.9"}, "203.0.113.9"},
+		{"one proxy and a spoofed address", 1, []string{"198.51.100.7, 203.0.113.9"}, "203.0.113.9"},
+		{"one proxy and several headers", 1, []string{"198.51.100.7", "203.0.113.9"}, "203.0.113.9"},
+		{"two proxies", 2, []string{"198.51.100.7, 203.0.113.9, 10.0.0.2"}, "203.0.113.9"},
+		{"fewer addresses than proxies", 3, []string{"203.0.113.9, 10.0.0.2"}, "203.0.113.9"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewLoginLimiter("login", NewMemoryLimiterStore(), defaultIpLoginLimitPolicy, defaultAccountLoginLimitPolicy, test.trustedProxies)
+			req := httptest.NewRequest("POST", "/login", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for _, forwardedFor := range test.forwardedFor {
+				req.Header.Add("X-Forwarded-For", forwardedFor)
+			}
+			if ip := limiter.getClientIp(req); ip != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, ip)
+			}
+		})
+	}
+}
+
+// errorOf returns the error response without its request ID, which differs on every request.
+func errorOf(t *testing.T, recorder *httptest.ResponseRecorder) api.ErrorResponse {
+	t.Helper()
+	var errorResponse api.ErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &errorResponse); err != nil {
+		t.Fatal(err)
+	}
+	errorResponse.RequestId = ""
+	return errorResponse
+}
+
+func TestRecordLoginFailureIsAtomic(t *testing.T) {
+	limiterStores := map[string]func(store Store) LimiterStore{
+		"memory":   func(store Store) LimiterStore { return NewMemoryLimiterStore() },
+		"database": func(store Store) LimiterStore { return store },
+	}
+	for name, newLimiterStore := range limiterStores {
+		t.Run(name, func(t *testing.T) {
+			limiterStore := newLimiterStore(newTestStore(t))
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			// The failures sent at once are all counted
+			const attempts = 10
+			errs := make(chan error, attempts)
+			for i := 0; i < attempts; i++ {
+				go func() {
+					_, err := limiterStore.RecordLoginFailure("login:account:hash", testAccountLimitPolicy, now)
+					errs <- err
+				}()
+			}
+			for i := 0; i < attempts; i++ {
+				if err := <-errs; err != nil {
+					t.Fatal(err)
+				}
+			}
+			throttle, err := limiterStore.GetLoginThrottle("login:account:hash")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if throttle.Failures != attempts || !throttle.LockedUntil.Equal(now.Add(testAccountLimitPolicy.MaxLockout)) {
+				t.Fatalf("expected %d failures locked out for the longest lockout, got %+v", attempts, throttle)
+			}
+
+			// The failures start over once the last one is old enough
+			later := now.Add(testAccountLimitPolicy.ResetAfter + time.Second)
+			throttle, err = limiterStore.RecordLoginFailure("login:account:hash", testAccountLimitPolicy, later)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if throttle.Failures != 1 || throttle.LockedUntil.After(later) {
+				t.Fatalf("expected the failures to start over without a lockout, got %+v", throttle)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"wowa-api"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 90 * 24 * time.Hour
+)
+
+type Session struct {
+	Id               string    `gorm:"primarykey;not null"`
+	UserId           string    `gorm:"index;not null"`
+	RefreshTokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt        time.Time `gorm:"not null"`
+	RevokedAt        *time.Time
+	CreatedAt        time.Time `gorm:"not null"`
+	UpdatedAt        time.Time
+	User             User
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// generateSecret returns a random secret and the hash stored in its place.
+func generateSecret(prefix string) (string, string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", "", err
+	}
+	secret := prefix + base64.RawURLEncoding.EncodeToString(randomBytes)
+	return secret, hashSecret(secret), nil
+}
+
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func signAccessToken(jwtKey []byte, user User, sessionId string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   user.Id,
+		"sid":   sessionId,
+		"exp":   time.Now().Add(accessTokenTTL).Unix(),
+		"email": user.Email,
+	})
+	return token.SignedString(jwtKey)
+}
+
+func writeTokenResponse(jwtKey []byte, w http.ResponseWriter, r *http.Request, user User, session Session, refreshToken string) {
+	accessToken, err := signAccessToken(jwtKey, user, session.Id)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write the response", "error", err)
+	}
+}
+
+// createSession starts a new session for the user and writes its tokens.
+func createSession(store Store, jwtKey []byte, w http.ResponseWriter, r *http.Request, user User) {
+	refreshToken, refreshTokenHash, err := generateSecret("")
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	session := Session{
+		Id:               "session_" + uuid.New().String(),
+		UserId:           user.Id,
+		RefreshTokenHash: refreshTokenHash,
+		ExpiresAt:        time.Now().Add(refreshTokenTTL),
+	}
+	err = store.CreateSession(&session)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	writeTokenResponse(jwtKey, w, r, user, session, refreshToken)
+}
+
+// findActiveSession returns the session of a refresh token, or nil if it is unknown, expired or revoked.
+func findActiveSession(store Store, refreshToken string) (*Session, error) {
+	session, err := store.GetSessionByRefreshTokenHash(hashSecret(refreshToken))
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, nil
+	}
+	return session, nil
+}
+
+func refreshTokenHandler(store Store, validate *validator.Validate, jwtKey []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var refreshTokenRequest RefreshTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&refreshTokenRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(refreshTokenRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		session, err := findActiveSession(store, refreshTokenRequest.RefreshToken)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		if session == nil {
+			writeError(w, r, http.StatusUnauthorized, api.ErrorCodeInvalidToken, "Unauthorized (invalid refresh token)")
+			return
+		}
+
+		// Rotate the refresh token, so a leaked one can only be used once
+		refreshToken, refreshTokenHash, err := generateSecret("")
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		err = store.RotateSession(session.Id, session.RefreshTokenHash, refreshTokenHash, time.Now().Add(refreshTokenTTL))
+		if err != nil {
+			if err == ErrNotFound {
+				// Another request rotated the refresh token first
+				writeError(w, r, http.StatusUnauthorized, api.ErrorCodeInvalidToken, "Unauthorized (invalid refresh token)")
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+
+		writeTokenResponse(jwtKey, w, r, session.User, *session, refreshToken)
+	}
+}
+
+func logoutHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var refreshTokenRequest RefreshTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&refreshTokenRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(refreshTokenRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		session, err := findActiveSession(store, refreshTokenRequest.RefreshToken)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		if session == nil {
+			// Already logged out
+			return
+		}
+
+		err = store.RevokeSession(session.Id)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+}
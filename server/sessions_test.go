@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"wowa-api"
+)
+
+// login starts a new session and returns its tokens.
+func login(t *testing.T, server *httptest.Server, email string) TokenResponse {
+	t.Helper()
+	var tokens TokenResponse
+	resp := doJson(t, server, "POST", "/login", "", LoginRequest{Email: email, Password: "password123"}, &tokens)
+	expectStatus(t, resp, http.StatusOK)
+	return tokens
+}
+
+// expectInvalidToken checks that the request is rejected for its token.
+func expectInvalidToken(t *testing.T, server *httptest.Server, req *http.Request) {
+	t.Helper()
+	resp, errorResponse := doError(t, server, req)
+	if resp.StatusCode != http.StatusUnauthorized || errorResponse.Code != api.ErrorCodeInvalidToken {
+		t.Fatalf("expected the token to be invalid, got %d %s", resp.StatusCode, errorResponse.Code)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	server := newTestServer(t, newTestStore(t))
+	register(t, server, "user@example.com")
+	tokens := login(t, server, "user@example.com")
+
+	var refreshed TokenResponse
+	resp := doJson(t, server, "POST", "/token/refresh", "", RefreshTokenRequest{RefreshToken: tokens.RefreshToken}, &refreshed)
+	expectStatus(t, resp, http.StatusOK)
+	if refreshed.AccessToken == "" || refreshed.RefreshToken == "" || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("expected new tokens, got %+v", refreshed)
+	}
+	resp = doJson(t, server, "GET", "/addons", refreshed.AccessToken, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	// A rotated refresh token can only be used once, while the session goes on with the new one
+	expectInvalidToken(t, server, newJsonRequest(t, server, "POST", "/token/refresh", "", RefreshTokenRequest{RefreshToken: tokens.RefreshToken}))
+	resp = doJson(t, server, "POST", "/token/refresh", "", RefreshTokenRequest{RefreshToken: refreshed.RefreshToken}, nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	expectInvalidToken(t, server, newJsonRequest(t, server, "POST", "/token/refresh", "", RefreshTokenRequest{RefreshToken: "unknown"}))
+}
+
+func TestLogoutRevokesTheSession(t *testing.T) {
+	server := newTestServer(t, newTestStore(t))
+	register(t, server, "user@example.com")
+	tokens := login(t, server, "user@example.com")
+	otherTokens := login(t, server, "user@example.com")
+
+	resp := doJson(t, server, "POST", "/logout", "", RefreshTokenRequest{RefreshToken: tokens.RefreshToken}, nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	// Both tokens of the session are rejected, even though the access token has not expired
+	expectInvalidToken(t, server, newJsonRequest(t, server, "GET", "/addons", tokens.AccessToken, nil))
+	expectInvalidToken(t, server, newJsonRequest(t, server, "POST", "/token/refresh", "", RefreshTokenRequest{RefreshToken: tokens.RefreshToken}))
+
+	// Logging out twice is fine, and the other sessions go on
+	resp = doJson(t, server, "POST", "/logout", "", RefreshTokenRequest{RefreshToken: tokens.RefreshToken}, nil)
+	expectStatus(t, resp, http.StatusOK)
+	resp = doJson(t, server, "GET", "/addons", otherTokens.AccessToken, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+}
+
+func TestAccessTokensNeedALiveSession(t *testing.T) {
+	store := newTestStore(t)
+	server := newTestServer(t, store)
+	register(t, server, "user@example.com")
+	tokens := login(t, server, "user@example.com")
+	user, err := store.GetUserByEmail("user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sessionId, err := parseAccessToken([]byte(testJwtKey), tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signToken := func(claims jwt.MapClaims, key string) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	unknownSession, err := signAccessToken([]byte(testJwtKey), *user, "session_unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidTokens := map[string]string{
+		"a token of an unknown session":           unknownSession,
+		"a token without session":                 signToken(jwt.MapClaims{"sub": user.Id, "exp": expiresAt}, testJwtKey),
+		"a token without expiration":              signToken(jwt.MapClaims{"sub": user.Id, "sid": sessionId}, testJwtKey),
+		"a token signed with another key":         signToken(jwt.MapClaims{"sub": user.Id, "sid": sessionId, "exp": expiresAt}, "another key that is long enough to sign"),
+		"a token of another user for the session": signToken(jwt.MapClaims{"sub": "user_unknown", "sid": sessionId, "exp": expiresAt}, testJwtKey),
+	}
+	for name, token := range invalidTokens {
+		t.Run(name, func(t *testing.T) {
+			expectInvalidToken(t, server, newJsonRequest(t, server, "GET", "/addons", token, nil))
+		})
+	}
+
+	// Changing the password ends all the sessions
+	resp := doJson(t, server, "POST", "/password/change", tokens.AccessToken, ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "new password"}, nil)
+	expectStatus(t, resp, http.StatusOK)
+	expectInvalidToken(t, server, newJsonRequest(t, server, "GET", "/addons", tokens.AccessToken, nil))
+	expectInvalidToken(t, server, newJsonRequest(t, server, "POST", "/token/refresh", "", RefreshTokenRequest{RefreshToken: tokens.RefreshToken}))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotFound  = errors.New("record not found")
+	ErrDuplicate = errors.New("duplicated record")
+	// ErrConflict is returned when a record does not have the expected revision.
+	ErrConflict = errors.New("record was modified")
+	// ErrOrganizationHasMembers is returned when deleting a user who owns an organization with other members.
+	ErrOrganizationHasMembers = errors.New("the user owns an organization with other members")
+)
+
+type SaveStatus int
+
+const (
+	SaveStatusCreated SaveStatus = iota
+	SaveStatusUpdated
+	SaveStatusUnchanged
+)
+
+// Store persists everything the server knows about its users.
+// Lookups return ErrNotFound when nothing matches, and creations return ErrDuplicate on unique conflicts.
+type Store interface {
+	CreateUser(user *User) error
+	GetUserById(id string) (*User, error)
+	// GetUserByEmail returns the user of the email whatever its case, since the emails are stored normalized.
+	GetUserByEmail(email string) (*User, error)
+	// UpdateUserPassword replaces the password hash of the user and revokes all of their sessions.
+	UpdateUserPassword(userId string, passwordHash string) error
+	// DeleteUser deletes the user with everything they saved, and the organizations they own. It returns
+	// ErrOrganizationHasMembers when one of these organizations has other members.
+	DeleteUser(userId string) error
+
+	GetAddons(userId string) ([]Addon, error)
+	GetAddon(userId string, gameVersion GameVersion, slug string) (*Addon, error)
+	// SaveAddon creates the addon, or updates the one with the same game version and slug, and then
+	// refreshes the addon with the stored record. The revision is only bumped when something changed.
+	// When expectedRevision is not nil, the addon must exist with that revision or ErrConflict is returned.
+	SaveAddon(addon *Addon, expectedRevision *int) (SaveStatus, error)
+	DeleteAddon(userId string, gameVersion GameVersion, slug string) error
+	// GetAddonChanges returns the latest state of the addons saved or deleted after the cursor.
+	GetAddonChanges(userId string, cursor int64) (*AddonChanges, error)
+	// CountAddons counts the addons of all the users by provider and game version.
+	CountAddons() ([]AddonCount, error)
+
+	// SaveDevice registers the device, or refreshes the one of the user with the same name and then
+	// loads it into device.
+	SaveDevice(device *Device) error
+	GetDevice(userId string, id string) (*Device, error)
+	// GetDevices returns the devices of the user, with their installed addons.
+	GetDevices(userId string) ([]Device, error)
+	// ReplaceDeviceAddons replaces the installed addons of the device, and marks it as seen.
+	ReplaceDeviceAddons(deviceId string, addons []DeviceAddon) error
+
+	CreateCollection(collection *Collection) error
+	// GetCollections returns the collections owned by the user or subscribed to, with their addons.
+	GetCollections(userId string) ([]Collection, error)
+	GetCollection(id string) (*Collection, error)
+	GetCollectionByShareCode(shareCode string) (*Collection, error)
+	// SetCollectionShareCode replaces the share code of the collection, or removes it when nil.
+	SetCollectionShareCode(id string, shareCode *string) error
+	// SaveCollectionAddon adds the addon to its collection, or updates the one with the same game version and slug.
+	SaveCollectionAddon(addon *CollectionAddon) error
+	DeleteCollectionAddon(collectionId string, gameVersion GameVersion, slug string) error
+	// SubscribeToCollection subscribes the user to the collection, and does nothing if already subscribed.
+	SubscribeToCollection(userId string, collectionId string) error
+	IsSubscribedToCollection(userId string, collectionId string) (bool, error)
+
+	// CreateOrganization creates the organization with the given user as its owner.
+	CreateOrganization(organization *Organization, ownerId string) error
+	// GetOrganizations returns the organizations of the user, with their addons and the role of the user.
+	GetOrganizations(userId string) ([]Organization, error)
+	GetOrganization(id string) (*Organization, error)
+	GetOrganizationMember(organizationId string, userId string) (*OrganizationMember, error)
+	// GetOrganizationMembers returns the members of the organization with their user.
+	GetOrganizationMembers(organizationId string) ([]OrganizationMember, error)
+	// SaveOrganizationMember adds the member to its organization, or updates its role.
+	SaveOrganizationMember(member *OrganizationMember) error
+	DeleteOrganizationMember(organizationId string, userId string) error
+	// SaveOrganizationInvitation invites the email to the organization, or updates the role and the token of its
+	// invitation, and then refreshes the invitation with the stored record.
+	SaveOrganizationInvitation(invitation *OrganizationInvitation) error
+	// GetOrganizationInvitation returns the invitation with the name of its organization.
+	GetOrganizationInvitation(id string) (*OrganizationInvitation, error)
+	GetOrganizationInvitations(organizationId string) ([]OrganizationInvitation, error)
+	// GetInvitationsByEmail returns the pending invitations of the email, with the names of their organizations.
+	GetInvitationsByEmail(email string) ([]OrganizationInvitation, error)
+	DeleteOrganizationInvitation(id string) error
+	// AcceptOrganizationInvitation makes the user a member with the role of the invitation, then deletes it.
+	// A user who is already a member keeps their role.
+	AcceptOrganizationInvitation(id string, userId string) error
+	// SaveOrganizationAddon adds the addon to its organization, or updates the one with the same game version and slug.
+	SaveOrganizationAddon(addon *OrganizationAddon) error
+	DeleteOrganizationAddon(organizationId string, gameVersion GameVersion, slug string) error
+	// GetOrganizationMemberAddons returns the addons saved by all the members of the organization.
+	GetOrganizationMemberAddons(organizationId string) ([]Addon, error)
+
+	CreateSession(session *Session) error
+	GetSession(id string) (*Session, error)
+	// GetSessionByRefreshTokenHash returns the session with its user.
+	GetSessionByRefreshTokenHash(refreshTokenHash string) (*Session, error)
+	// RotateSession replaces the refresh token of a session, returning ErrNotFound if it was already rotated.
+	RotateSession(id string, currentRefreshTokenHash string, newRefreshTokenHash string, expiresAt time.Time) error
+	RevokeSession(id string) error
+
+	CreatePersonalAccessToken(token *PersonalAccessToken) error
+	GetPersonalAccessTokenByHash(tokenHash string) (*PersonalAccessToken, error)
+	GetPersonalAccessTokens(userId string) ([]PersonalAccessToken, error)
+	TouchPersonalAccessToken(id string, usedAt time.Time) error
+	DeletePersonalAccessToken(userId string, id string) error
+
+	CreatePasswordResetToken(token *PasswordResetToken) error
+	// ConsumePasswordResetToken marks an unused and unexpired reset token as used, then replaces the password of its user.
+	// The other reset tokens of the user are invalidated, so an older mail cannot change the password again.
+	ConsumePasswordResetToken(tokenHash string, passwordHash string) error
+
+	// The login throttles are kept in the database when RATE_LIMIT_STORE is "database"
+	LimiterStore
+
+	// GetProviderCacheEntry returns the cached release of an addon, even when expired.
+	GetProviderCacheEntry(key string) (*ProviderCacheEntry, error)
+	// SaveProviderCacheEntry creates the cache entry, or replaces the one with the same key.
+	SaveProviderCacheEntry(entry *ProviderCacheEntry) error
+
+	// MigrateUp applies the pending schema migrations, and returns ErrSchemaTooNew if the schema is newer than the server.
+	MigrateUp() ([]Migration, error)
+	// MigrateDown rolls back the given number of applied schema migrations.
+	MigrateDown(steps int) ([]Migration, error)
+	MigrationStatus() ([]MigrationStatus, error)
+
+	Ping() error
+	// DB returns the database connection pool, for its stats.
+	DB() (*sql.DB, error)
+	Close() error
+}
+
+// AddonCount is the number of addons of a provider and game version.
+type AddonCount struct {
+	Provider    Provider
+	GameVersion GameVersion
+	Count       int64
+}
+
+// newStoreFromConfig opens the store of the configured database driver, "postgres" or "sqlite".
+func newStoreFromConfig(config Config) (Store, error) {
+	switch config.DbDriver {
+	case "postgres":
+		return NewPostgresStore(config.PgDsn)
+	case "sqlite":
+		return NewSQLiteStore(config.SqlitePath)
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", config.DbDriver)
+	}
+}
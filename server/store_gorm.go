@@ -0,0 +1,878 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"wowa-api"
+)
+
+// GormStore implements Store on top of gorm, for both the Postgres and the SQLite databases.
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(dsn string) (*GormStore, error) {
+	return newGormStore(postgres.Open(dsn))
+}
+
+// NewSQLiteStore opens a SQLite database file, or an in-memory database with ":memory:".
+func NewSQLiteStore(path string) (*GormStore, error) {
+	store, err := newGormStore(sqlite.Open(path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"))
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only supports one writer at a time, and every connection to :memory: is a new database
+	sqlDB, err := store.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	return store, nil
+}
+
+func newGormStore(dialector gorm.Dialector) (*GormStore, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{
+		// DryRun: true
+		TranslateError: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &GormStore{db: db}, nil
+}
+
+func translateError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// first loads the first record matching the query into dest.
+func (s *GormStore) first(db *gorm.DB, dest interface{}, query string, args ...interface{}) error {
+	return translateError(db.Where(query, args...).First(dest).Error)
+}
+
+// requireRowsAffected turns an update or delete that matched nothing into ErrNotFound.
+func requireRowsAffected(result *gorm.DB) error {
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *GormStore) CreateUser(user *User) error {
+	return translateError(s.db.Create(user).Error)
+}
+
+func (s *GormStore) GetUserById(id string) (*User, error) {
+	var user User
+	if err := s.first(s.db, &user, "id = ?", id); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *GormStore) GetUserByEmail(email string) (*User, error) {
+	var user User
+	if err := s.first(s.db, &user, "email = ?", normalizeEmail(email)); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func updateUserPassword(tx *gorm.DB, userId string, passwordHash string) error {
+	result := tx.Model(&User{}).Where("id = ?", userId).Update("password", passwordHash)
+	if err := requireRowsAffected(result); err != nil {
+		return err
+	}
+
+	result = tx.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", userId).Update("revoked_at", time.Now())
+	return translateError(result.Error)
+}
+
+func (s *GormStore) UpdateUserPassword(userId string, passwordHash string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return updateUserPassword(tx, userId, passwordHash)
+	})
+}
+
+func (s *GormStore) DeleteUser(userId string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var organizationIds []string
+		result := tx.Model(&OrganizationMember{}).Where("user_id = ? AND role = ?", userId, RoleOwner).Pluck("organization_id", &organizationIds)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		var otherMembers int64
+		result = tx.Model(&OrganizationMember{}).Where("organization_id IN ? AND user_id <> ?", organizationIds, userId).Count(&otherMembers)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		if otherMembers > 0 {
+			return ErrOrganizationHasMembers
+		}
+
+		var user User
+		if err := s.first(tx, &user, "id = ?", userId); err != nil {
+			return err
+		}
+		var collectionIds []string
+		result = tx.Model(&Collection{}).Where("user_id = ?", userId).Pluck("id", &collectionIds)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		devices := tx.Model(&Device{}).Select("id").Where("user_id = ?", userId)
+
+		// The rows go before the ones they reference, since the foreign keys are enforced
+		deletions := []struct {
+			model interface{}
+			query string
+			args  []interface{}
+		}{
+			{&OrganizationAddon{}, "organization_id IN ?", []interface{}{organizationIds}},
+			{&OrganizationInvitation{}, "organization_id IN ? OR email = ?", []interface{}{organizationIds, normalizeEmail(user.Email)}},
+			{&OrganizationMember{}, "user_id = ?", []interface{}{userId}},
+			{&Organization{}, "id IN ?", []interface{}{organizationIds}},
+			{&CollectionSubscription{}, "user_id = ? OR collection_id IN ?", []interface{}{userId, collectionIds}},
+			{&CollectionAddon{}, "collection_id IN ?", []interface{}{collectionIds}},
+			{&Collection{}, "user_id = ?", []interface{}{userId}},
+			{&Addon{}, "user_id = ?", []interface{}{userId}},
+			{&AddonChange{}, "user_id = ?", []interface{}{userId}},
+			{&AddonChangeCounter{}, "user_id = ?", []interface{}{userId}},
+			{&DeviceAddon{}, "device_id IN (?)", []interface{}{devices}},
+			{&Device{}, "user_id = ?", []interface{}{userId}},
+			{&Session{}, "user_id = ?", []interface{}{userId}},
+			{&PersonalAccessToken{}, "user_id = ?", []interface{}{userId}},
+			{&PasswordResetToken{}, "user_id = ?", []interface{}{userId}},
+		}
+		for _, deletion := range deletions {
+			if err := tx.Where(deletion.query, deletion.args...).Delete(deletion.model).Error; err != nil {
+				return translateError(err)
+			}
+		}
+
+		result = tx.Where("id = ?", userId).Delete(&User{})
+		return requireRowsAffected(result)
+	})
+}
+
+func (s *GormStore) GetAddons(userId string) ([]Addon, error) {
+	addons := []Addon{}
+	result := s.db.Where("user_id = ?", userId).Find(&addons)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return addons, nil
+}
+
+func (s *GormStore) GetAddon(userId string, gameVersion GameVersion, slug string) (*Addon, error) {
+	var addon Addon
+	err := s.first(s.db, &addon, "user_id = ? AND game_version = ? AND slug = ?", userId, gameVersion, slug)
+	if err != nil {
+		return nil, err
+	}
+	return &addon, nil
+}
+
+func isSameAddon(a Addon, b Addon) bool {
+	return a.Name == b.Name &&
+		a.Author == b.Author &&
+		a.Provider == b.Provider &&
+		a.ExternalId == b.ExternalId &&
+		a.Url == b.Url &&
+		a.Version == b.Version &&
+		a.FileId == b.FileId &&
+		a.Channel == b.Channel &&
+		a.Pinned == b.Pinned &&
+		slices.Equal(a.Directories, b.Directories) &&
+		isSameId(a.DeviceId, b.DeviceId) &&
+		isSameId(a.OrganizationId, b.OrganizationId)
+}
+
+func isSameId(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func (s *GormStore) saveAddon(addon *Addon, expectedRevision *int) (SaveStatus, error) {
+	var status SaveStatus
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var existing Addon
+		err := s.first(tx, &existing, "user_id = ? AND game_version = ? AND slug = ?", addon.UserId, addon.GameVersion, addon.Slug)
+		if err == ErrNotFound {
+			if expectedRevision != nil {
+				return ErrConflict
+			}
+			addon.Revision = 1
+			status = SaveStatusCreated
+			if err := translateError(tx.Omit("User").Create(addon).Error); err != nil {
+				return err
+			}
+			return recordAddonChange(tx, addon.UserId, addon.GameVersion, addon.Slug, false)
+		}
+		if err != nil {
+			return err
+		}
+
+		if expectedRevision != nil && *expectedRevision != existing.Revision {
+			return ErrConflict
+		}
+		if isSameAddon(existing, *addon) {
+			*addon = existing
+			status = SaveStatusUnchanged
+			return nil
+		}
+
+		updated := *addon
+		updated.Id = existing.Id
+		updated.Revision = existing.Revision + 1
+		updated.CreatedAt = existing.CreatedAt
+		updated.UpdatedAt = time.Now()
+		result := tx.Model(&updated).
+			Where("revision = ?", existing.Revision).
+			Select("name", "author", "provider", "external_id", "url", "version", "file_id", "channel", "pinned", "directories", "device_id", "organization_id", "revision", "updated_at").
+			Updates(&updated)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			// Another request updated the addon first
+			return ErrConflict
+		}
+		*addon = updated
+		status = SaveStatusUpdated
+		return recordAddonChange(tx, addon.UserId, addon.GameVersion, addon.Slug, false)
+	})
+	return status, err
+}
+
+func (s *GormStore) SaveAddon(addon *Addon, expectedRevision *int) (SaveStatus, error) {
+	status, err := s.saveAddon(addon, expectedRevision)
+	if err == ErrDuplicate {
+		// Another request created the addon first, so it is now an update
+		return s.saveAddon(addon, expectedRevision)
+	}
+	return status, err
+}
+
+func (s *GormStore) DeleteAddon(userId string, gameVersion GameVersion, slug string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND game_version = ? AND slug = ?", userId, gameVersion, slug).Delete(&Addon{})
+		if err := requireRowsAffected(result); err != nil {
+			return err
+		}
+		return recordAddonChange(tx, userId, gameVersion, slug, true)
+	})
+}
+
+// recordAddonChange appends a change to the feed of the user. A client could skip a change with an
+// autoincremented cursor, if it was committed after a later one, so the cursor is counted under a lock
+// on the counter of the user instead.
+func recordAddonChange(tx *gorm.DB, userId string, gameVersion GameVersion, slug string, deleted bool) error {
+	counter := AddonChangeCounter{UserId: userId, LastCursor: 1}
+	result := tx.Omit("User").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"last_cursor": gorm.Expr("addon_change_counters.last_cursor + 1")}),
+	}).Create(&counter)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if err := tx.Where("user_id = ?", userId).Take(&counter).Error; err != nil {
+		return translateError(err)
+	}
+
+	change := AddonChange{UserId: userId, Cursor: counter.LastCursor, GameVersion: gameVersion, Slug: slug, Deleted: deleted}
+	return translateError(tx.Create(&change).Error)
+}
+
+func (s *GormStore) GetAddonChanges(userId string, cursor int64) (*AddonChanges, error) {
+	changes := &AddonChanges{Cursor: cursor, Addons: []Addon{}, Deleted: []api.DeletedAddon{}}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var addonChanges []AddonChange
+		result := tx.Where("user_id = ? AND cursor > ?", userId, cursor).Order("cursor").Find(&addonChanges)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		if len(addonChanges) == 0 {
+			return nil
+		}
+
+		// Only the last change of each addon matters
+		type addonKey struct {
+			gameVersion GameVersion
+			slug        string
+		}
+		latest := make(map[addonKey]AddonChange)
+		for _, change := range addonChanges {
+			latest[addonKey{change.GameVersion, change.Slug}] = change
+		}
+		changes.Cursor = addonChanges[len(addonChanges)-1].Cursor
+
+		// Only the saved addons are read, by game version
+		savedSlugs := make(map[GameVersion][]string)
+		for _, change := range latest {
+			if change.Deleted {
+				changes.Deleted = append(changes.Deleted, api.DeletedAddon{GameVersion: change.GameVersion, Slug: change.Slug, DeletedAt: change.CreatedAt})
+			} else {
+				savedSlugs[change.GameVersion] = append(savedSlugs[change.GameVersion], change.Slug)
+			}
+		}
+		for gameVersion, slugs := range savedSlugs {
+			var addons []Addon
+			result = tx.Where("user_id = ? AND game_version = ? AND slug IN ?", userId, gameVersion, slugs).Find(&addons)
+			if result.Error != nil {
+				return translateError(result.Error)
+			}
+			changes.Addons = append(changes.Addons, addons...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (s *GormStore) CountAddons() ([]AddonCount, error) {
+	var counts []AddonCount
+	result := s.db.Model(&Addon{}).Select("provider, game_version, count(*) AS count").Group("provider, game_version").Scan(&counts)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return counts, nil
+}
+
+func (s *GormStore) SaveDevice(device *Device) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Omit("User", "Addons").Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"platform", "last_seen_at", "updated_at"}),
+		}).Create(device)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		// The id and creation date are the stored ones when the device was already registered
+		var stored Device
+		if err := s.first(tx, &stored, "user_id = ? AND name = ?", device.UserId, device.Name); err != nil {
+			return err
+		}
+		*device = stored
+		return nil
+	})
+}
+
+func (s *GormStore) GetDevice(userId string, id string) (*Device, error) {
+	var device Device
+	if err := s.first(s.db, &device, "user_id = ? AND id = ?", userId, id); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (s *GormStore) GetDevices(userId string) ([]Device, error) {
+	devices := []Device{}
+	result := s.db.
+		Preload("Addons", func(db *gorm.DB) *gorm.DB {
+			return db.Order("game_version DESC, slug")
+		}).
+		Where("user_id = ?", userId).
+		Order("created_at").
+		Find(&devices)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return devices, nil
+}
+
+func (s *GormStore) ReplaceDeviceAddons(deviceId string, addons []DeviceAddon) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("device_id = ?", deviceId).Delete(&DeviceAddon{})
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		if len(addons) > 0 {
+			if err := translateError(tx.Create(&addons).Error); err != nil {
+				return err
+			}
+		}
+		result = tx.Model(&Device{}).Where("id = ?", deviceId).Update("last_seen_at", time.Now())
+		return requireRowsAffected(result)
+	})
+}
+
+func (s *GormStore) CreateCollection(collection *Collection) error {
+	return translateError(s.db.Omit("User", "Addons").Create(collection).Error)
+}
+
+// preloadCollectionAddons loads the addons of the collections in a stable order.
+func preloadCollectionAddons(db *gorm.DB) *gorm.DB {
+	return db.Preload("Addons", func(db *gorm.DB) *gorm.DB {
+		return db.Order("game_version DESC, slug")
+	})
+}
+
+func (s *GormStore) GetCollections(userId string) ([]Collection, error) {
+	collections := []Collection{}
+	result := preloadCollectionAddons(s.db).
+		Where("user_id = ? OR id IN (?)", userId, s.db.Model(&CollectionSubscription{}).Select("collection_id").Where("user_id = ?", userId)).
+		Order("created_at").
+		Find(&collections)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return collections, nil
+}
+
+func (s *GormStore) GetCollection(id string) (*Collection, error) {
+	var collection Collection
+	if err := s.first(preloadCollectionAddons(s.db), &collection, "id = ?", id); err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+func (s *GormStore) GetCollectionByShareCode(shareCode string) (*Collection, error) {
+	var collection Collection
+	if err := s.first(preloadCollectionAddons(s.db), &collection, "share_code = ?", shareCode); err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+func (s *GormStore) SetCollectionShareCode(id string, shareCode *string) error {
+	result := s.db.Model(&Collection{}).Where("id = ?", id).Update("share_code", shareCode)
+	return requireRowsAffected(result)
+}
+
+func (s *GormStore) SaveCollectionAddon(addon *CollectionAddon) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "collection_id"}, {Name: "game_version"}, {Name: "slug"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "author", "provider", "external_id", "url"}),
+		}).Create(addon)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		result = tx.Model(&Collection{}).Where("id = ?", addon.CollectionId).Update("updated_at", time.Now())
+		return requireRowsAffected(result)
+	})
+}
+
+func (s *GormStore) DeleteCollectionAddon(collectionId string, gameVersion GameVersion, slug string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("collection_id = ? AND game_version = ? AND slug = ?", collectionId, gameVersion, slug).Delete(&CollectionAddon{})
+		if err := requireRowsAffected(result); err != nil {
+			return err
+		}
+		result = tx.Model(&Collection{}).Where("id = ?", collectionId).Update("updated_at", time.Now())
+		return requireRowsAffected(result)
+	})
+}
+
+func (s *GormStore) SubscribeToCollection(userId string, collectionId string) error {
+	subscription := CollectionSubscription{UserId: userId, CollectionId: collectionId}
+	return translateError(s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&subscription).Error)
+}
+
+func (s *GormStore) IsSubscribedToCollection(userId string, collectionId string) (bool, error) {
+	var count int64
+	result := s.db.Model(&CollectionSubscription{}).Where("user_id = ? AND collection_id = ?", userId, collectionId).Count(&count)
+	if result.Error != nil {
+		return false, translateError(result.Error)
+	}
+	return count > 0, nil
+}
+
+func (s *GormStore) CreateOrganization(organization *Organization, ownerId string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := translateError(tx.Omit("Addons").Create(organization).Error); err != nil {
+			return err
+		}
+		owner := OrganizationMember{OrganizationId: organization.Id, UserId: ownerId, Role: RoleOwner}
+		return translateError(tx.Omit("User").Create(&owner).Error)
+	})
+}
+
+// preloadOrganizationAddons loads the addons of the organizations in a stable order.
+func preloadOrganizationAddons(db *gorm.DB) *gorm.DB {
+	return db.Preload("Addons", func(db *gorm.DB) *gorm.DB {
+		return db.Order("game_version DESC, slug")
+	})
+}
+
+func (s *GormStore) GetOrganizations(userId string) ([]Organization, error) {
+	var members []OrganizationMember
+	result := s.db.Where("user_id = ?", userId).Find(&members)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+
+	roles := make(map[string]OrganizationRole)
+	var organizationIds []string
+	for _, member := range members {
+		roles[member.OrganizationId] = member.Role
+		organizationIds = append(organizationIds, member.OrganizationId)
+	}
+
+	organizations := []Organization{}
+	if len(organizationIds) == 0 {
+		return organizations, nil
+	}
+	result = preloadOrganizationAddons(s.db).Where("id IN ?", organizationIds).Order("created_at").Find(&organizations)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	for i := range organizations {
+		organizations[i].Role = roles[organizations[i].Id]
+	}
+	return organizations, nil
+}
+
+func (s *GormStore) GetOrganization(id string) (*Organization, error) {
+	var organization Organization
+	if err := s.first(preloadOrganizationAddons(s.db), &organization, "id = ?", id); err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func (s *GormStore) GetOrganizationMember(organizationId string, userId string) (*OrganizationMember, error) {
+	var member OrganizationMember
+	if err := s.first(s.db, &member, "organization_id = ? AND user_id = ?", organizationId, userId); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (s *GormStore) GetOrganizationMembers(organizationId string) ([]OrganizationMember, error) {
+	members := []OrganizationMember{}
+	result := s.db.Preload("User").Where("organization_id = ?", organizationId).Order("created_at").Find(&members)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return members, nil
+}
+
+func (s *GormStore) SaveOrganizationMember(member *OrganizationMember) error {
+	result := s.db.Omit("User").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "organization_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(member)
+	return translateError(result.Error)
+}
+
+func (s *GormStore) DeleteOrganizationMember(organizationId string, userId string) error {
+	result := s.db.Where("organization_id = ? AND user_id = ?", organizationId, userId).Delete(&OrganizationMember{})
+	return requireRowsAffected(result)
+}
+
+func (s *GormStore) SaveOrganizationInvitation(invitation *OrganizationInvitation) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Omit("Organization").Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "organization_id"}, {Name: "email"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role", "token_hash", "updated_at"}),
+		}).Create(invitation)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		// Refresh the invitation, since its id and creation date are the stored ones on updates
+		var stored OrganizationInvitation
+		if err := s.first(tx, &stored, "organization_id = ? AND email = ?", invitation.OrganizationId, invitation.Email); err != nil {
+			return err
+		}
+		*invitation = stored
+		return nil
+	})
+}
+
+// withOrganizationNames fills the organization names of the invitations from their preloaded organization.
+func withOrganizationNames(invitations []OrganizationInvitation) []OrganizationInvitation {
+	for i := range invitations {
+		invitations[i].OrganizationName = invitations[i].Organization.Name
+	}
+	return invitations
+}
+
+func (s *GormStore) GetOrganizationInvitation(id string) (*OrganizationInvitation, error) {
+	var invitation OrganizationInvitation
+	if err := s.first(s.db.Preload("Organization"), &invitation, "id = ?", id); err != nil {
+		return nil, err
+	}
+	invitation.OrganizationName = invitation.Organization.Name
+	return &invitation, nil
+}
+
+func (s *GormStore) GetOrganizationInvitations(organizationId string) ([]OrganizationInvitation, error) {
+	invitations := []OrganizationInvitation{}
+	result := s.db.Preload("Organization").Where("organization_id = ?", organizationId).Order("created_at").Find(&invitations)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return withOrganizationNames(invitations), nil
+}
+
+func (s *GormStore) GetInvitationsByEmail(email string) ([]OrganizationInvitation, error) {
+	invitations := []OrganizationInvitation{}
+	result := s.db.Preload("Organization").Where("email = ?", email).Order("created_at").Find(&invitations)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return withOrganizationNames(invitations), nil
+}
+
+func (s *GormStore) DeleteOrganizationInvitation(id string) error {
+	result := s.db.Where("id = ?", id).Delete(&OrganizationInvitation{})
+	return requireRowsAffected(result)
+}
+
+func (s *GormStore) AcceptOrganizationInvitation(id string, userId string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var invitation OrganizationInvitation
+		if err := s.first(tx, &invitation, "id = ?", id); err != nil {
+			return err
+		}
+
+		member := OrganizationMember{OrganizationId: invitation.OrganizationId, UserId: userId, Role: invitation.Role}
+		result := tx.Omit("User").Clauses(clause.OnConflict{DoNothing: true}).Create(&member)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+
+		result = tx.Where("id = ?", id).Delete(&OrganizationInvitation{})
+		return requireRowsAffected(result)
+	})
+}
+
+func (s *GormStore) SaveOrganizationAddon(addon *OrganizationAddon) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "organization_id"}, {Name: "game_version"}, {Name: "slug"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "author", "provider", "external_id", "url", "requirement", "updated_at"}),
+		}).Create(addon)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		// Refresh the addon, since its id and creation date are the stored ones on updates
+		var stored OrganizationAddon
+		if err := s.first(tx, &stored, "organization_id = ? AND game_version = ? AND slug = ?", addon.OrganizationId, addon.GameVersion, addon.Slug); err != nil {
+			return err
+		}
+		*addon = stored
+		return nil
+	})
+}
+
+func (s *GormStore) DeleteOrganizationAddon(organizationId string, gameVersion GameVersion, slug string) error {
+	result := s.db.Where("organization_id = ? AND game_version = ? AND slug = ?", organizationId, gameVersion, slug).Delete(&OrganizationAddon{})
+	return requireRowsAffected(result)
+}
+
+func (s *GormStore) GetOrganizationMemberAddons(organizationId string) ([]Addon, error) {
+	addons := []Addon{}
+	result := s.db.
+		Where("user_id IN (?)", s.db.Model(&OrganizationMember{}).Select("user_id").Where("organization_id = ?", organizationId)).
+		Find(&addons)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return addons, nil
+}
+
+func (s *GormStore) CreateSession(session *Session) error {
+	return translateError(s.db.Omit("User").Create(session).Error)
+}
+
+func (s *GormStore) GetSession(id string) (*Session, error) {
+	var session Session
+	if err := s.first(s.db, &session, "id = ?", id); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *GormStore) GetSessionByRefreshTokenHash(refreshTokenHash string) (*Session, error) {
+	var session Session
+	if err := s.first(s.db.Preload("User"), &session, "refresh_token_hash = ?", refreshTokenHash); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *GormStore) RotateSession(id string, currentRefreshTokenHash string, newRefreshTokenHash string, expiresAt time.Time) error {
+	result := s.db.Model(&Session{}).
+		Where("id = ? AND refresh_token_hash = ?", id, currentRefreshTokenHash).
+		Updates(Session{RefreshTokenHash: newRefreshTokenHash, ExpiresAt: expiresAt})
+	return requireRowsAffected(result)
+}
+
+func (s *GormStore) RevokeSession(id string) error {
+	result := s.db.Model(&Session{}).Where("id = ?", id).Update("revoked_at", time.Now())
+	return requireRowsAffected(result)
+}
+
+func (s *GormStore) CreatePersonalAccessToken(token *PersonalAccessToken) error {
+	return translateError(s.db.Omit("User").Create(token).Error)
+}
+
+func (s *GormStore) GetPersonalAccessTokenByHash(tokenHash string) (*PersonalAccessToken, error) {
+	var token PersonalAccessToken
+	if err := s.first(s.db, &token, "token_hash = ?", tokenHash); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *GormStore) GetPersonalAccessTokens(userId string) ([]PersonalAccessToken, error) {
+	tokens := []PersonalAccessToken{}
+	result := s.db.Where("user_id = ?", userId).Order("created_at").Find(&tokens)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	return tokens, nil
+}
+
+func (s *GormStore) TouchPersonalAccessToken(id string, usedAt time.Time) error {
+	result := s.db.Model(&PersonalAccessToken{}).Where("id = ?", id).Update("last_used_at", usedAt)
+	return requireRowsAffected(result)
+}
+
+func (s *GormStore) DeletePersonalAccessToken(userId string, id string) error {
+	result := s.db.Where("user_id = ? AND id = ?", userId, id).Delete(&PersonalAccessToken{})
+	return requireRowsAffected(result)
+}
+
+func (s *GormStore) CreatePasswordResetToken(token *PasswordResetToken) error {
+	return translateError(s.db.Omit("User").Create(token).Error)
+}
+
+func (s *GormStore) ConsumePasswordResetToken(tokenHash string, passwordHash string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Mark the token as used first, so it cannot be used twice at the same time
+		result := tx.Model(&PasswordResetToken{}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+			Update("used_at", time.Now())
+		if err := requireRowsAffected(result); err != nil {
+			return err
+		}
+
+		var token PasswordResetToken
+		if err := s.first(tx, &token, "token_hash = ?", tokenHash); err != nil {
+			return err
+		}
+
+		err := tx.Model(&PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserId).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+
+		return updateUserPassword(tx, token.UserId, passwordHash)
+	})
+}
+
+func (s *GormStore) GetLoginThrottle(key string) (*LoginThrottle, error) {
+	var throttle LoginThrottle
+	if err := s.first(s.db, &throttle, "key = ?", key); err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (s *GormStore) RecordLoginFailure(key string, policy LoginLimitPolicy, now time.Time) (*LoginThrottle, error) {
+	var throttle LoginThrottle
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// A single upsert increments the failures, and locks the row until the lockout is written
+		result := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"failures":   gorm.Expr("CASE WHEN login_throttles.updated_at < ? THEN 1 ELSE login_throttles.failures + 1 END", now.Add(-policy.ResetAfter)),
+				"updated_at": now,
+			}),
+		}).Create(&LoginThrottle{Key: key, Failures: 1, UpdatedAt: now})
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		if err := s.first(tx, &throttle, "key = ?", key); err != nil {
+			return err
+		}
+
+		if lockout := policy.lockout(throttle.Failures); lockout > 0 {
+			throttle.LockedUntil = now.Add(lockout)
+			return translateError(tx.Model(&throttle).UpdateColumn("locked_until", throttle.LockedUntil).Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (s *GormStore) DeleteLoginThrottle(key string) error {
+	return translateError(s.db.Where("key = ?", key).Delete(&LoginThrottle{}).Error)
+}
+
+func (s *GormStore) GetProviderCacheEntry(key string) (*ProviderCacheEntry, error) {
+	var entry ProviderCacheEntry
+	if err := s.first(s.db, &entry, "key = ?", key); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (s *GormStore) SaveProviderCacheEntry(entry *ProviderCacheEntry) error {
+	return translateError(s.db.Save(entry).Error)
+}
+
+func (s *GormStore) MigrateUp() ([]Migration, error) {
+	return migrateUp(s.db)
+}
+
+func (s *GormStore) MigrateDown(steps int) ([]Migration, error) {
+	return migrateDown(s.db, steps)
+}
+
+func (s *GormStore) MigrationStatus() ([]MigrationStatus, error) {
+	return getMigrationStatus(s.db)
+}
+
+func (s *GormStore) Ping() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Ping()
+}
+
+func (s *GormStore) DB() (*sql.DB, error) {
+	return s.db.DB()
+}
+
+func (s *GormStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTestUser(t *testing.T, store Store, id string, email string) User {
+	t.Helper()
+	user := User{Id: id, Email: email, Password: "hash"}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestStoreReturnsErrNotFound(t *testing.T) {
+	store := newTestStore(t)
+	createTestUser(t, store, "user_1", "user@example.com")
+
+	if _, err := store.GetUserById("user_unknown"); err != ErrNotFound {
+		t.Errorf("GetUserById: expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.GetUserByEmail("unknown@example.com"); err != ErrNotFound {
+		t.Errorf("GetUserByEmail: expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.GetAddon("user_1", Retail, "unknown"); err != ErrNotFound {
+		t.Errorf("GetAddon: expected ErrNotFound, got %v", err)
+	}
+	if err := store.DeleteAddon("user_1", Retail, "unknown"); err != ErrNotFound {
+		t.Errorf("DeleteAddon: expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.GetCollectionByShareCode("unknown"); err != ErrNotFound {
+		t.Errorf("GetCollectionByShareCode: expected ErrNotFound, got %v", err)
+	}
+	if err := store.SetCollectionShareCode("collection_unknown", nil); err != ErrNotFound {
+		t.Errorf("SetCollectionShareCode: expected ErrNotFound, got %v", err)
+	}
+	if err := store.RevokeSession("session_unknown"); err != ErrNotFound {
+		t.Errorf("RevokeSession: expected ErrNotFound, got %v", err)
+	}
+	if err := store.DeletePersonalAccessToken("user_1", "pat_unknown"); err != ErrNotFound {
+		t.Errorf("DeletePersonalAccessToken: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStoreReturnsErrDuplicate(t *testing.T) {
+	store := newTestStore(t)
+	createTestUser(t, store, "user_1", "user@example.com")
+
+	duplicatedEmail := User{Id: "user_2", Email: "user@example.com", Password: "hash"}
+	if err := store.CreateUser(&duplicatedEmail); err != ErrDuplicate {
+		t.Errorf("CreateUser with a taken email: expected ErrDuplicate, got %v", err)
+	}
+	duplicatedId := User{Id: "user_1", Email: "other@example.com", Password: "hash"}
+	if err := store.CreateUser(&duplicatedId); err != ErrDuplicate {
+		t.Errorf("CreateUser with a taken id: expected ErrDuplicate, got %v", err)
+	}
+
+	session := Session{Id: "session_1", UserId: "user_1", RefreshTokenHash: "hash_1", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.CreateSession(&session); err != nil {
+		t.Fatal(err)
+	}
+	duplicatedSession := Session{Id: "session_2", UserId: "user_1", RefreshTokenHash: "hash_1", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.CreateSession(&duplicatedSession); err != ErrDuplicate {
+		t.Errorf("CreateSession with a taken refresh token: expected ErrDuplicate, got %v", err)
+	}
+
+	shareCode := "code"
+	for _, id := range []string{"collection_1", "collection_2"} {
+		collection := Collection{Id: id, UserId: "user_1", Name: id}
+		if err := store.CreateCollection(&collection); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SetCollectionShareCode("collection_1", &shareCode); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetCollectionShareCode("collection_2", &shareCode); err != ErrDuplicate {
+		t.Errorf("SetCollectionShareCode with a taken code: expected ErrDuplicate, got %v", err)
+	}
+}
+
+func TestStoreSaveAddonConflict(t *testing.T) {
+	store := newTestStore(t)
+	createTestUser(t, store, "user_1", "user@example.com")
+
+	addon := Addon{Id: "addon_1", UserId: "user_1", GameVersion: Retail, Slug: "details", Name: "Details!", Channel: ChannelRelease, Directories: []string{}}
+	status, err := store.SaveAddon(&addon, nil)
+	if err != nil || status != SaveStatusCreated {
+		t.Fatalf("expected the addon to be created, got %v and %v", status, err)
+	}
+
+	staleRevision := addon.Revision + 1
+	addon.Name = "Details! Damage Meter"
+	if _, err := store.SaveAddon(&addon, &staleRevision); err != ErrConflict {
+		t.Errorf("SaveAddon with a stale revision: expected ErrConflict, got %v", err)
+	}
+
+	missingRevision := 1
+	missing := Addon{Id: "addon_2", UserId: "user_1", GameVersion: Retail, Slug: "missing", Channel: ChannelRelease, Directories: []string{}}
+	if _, err := store.SaveAddon(&missing, &missingRevision); err != ErrConflict {
+		t.Errorf("SaveAddon of a missing addon with a revision: expected ErrConflict, got %v", err)
+	}
+}
+
+// migrateDownTo rolls back the migrations after the version.
+func migrateDownTo(t *testing.T, store *GormStore, version int) {
+	t.Helper()
+	if _, err := store.MigrateDown(latestMigrationVersion() - version); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrationNormalizesUserEmails(t *testing.T) {
+	store := newTestStore(t)
+	migrateDownTo(t, store, 10)
+	createTestUser(t, store, "user_1", "User@Example.com")
+	createTestUser(t, store, "user_2", "other@example.com")
+	if _, err := store.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := store.GetUserById("user_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "user@example.com" {
+		t.Errorf("expected the email to be lowercased, got %s", user.Email)
+	}
+	if _, err := store.GetUserByEmail("USER@example.com"); err != nil {
+		t.Errorf("GetUserByEmail in another case: expected the user, got %v", err)
+	}
+	if err := store.db.Create(&User{Id: "user_3", Email: "Other@example.com", Password: "hash"}).Error; err == nil {
+		t.Error("expected the index to reject an email in another case")
+	}
+}
+
+func TestMigrationRejectsEmailsDifferingByCase(t *testing.T) {
+	store := newTestStore(t)
+	migrateDownTo(t, store, 10)
+	createTestUser(t, store, "user_1", "user@example.com")
+	createTestUser(t, store, "user_2", "USER@example.com")
+
+	if _, err := store.MigrateUp(); err == nil || !strings.Contains(err.Error(), "user@example.com") {
+		t.Fatalf("expected the migration to fail on the duplicated email, got %v", err)
+	}
+}
+
+func TestStoreAddonChanges(t *testing.T) {
+	store := newTestStore(t)
+	createTestUser(t, store, "user_1", "user@example.com")
+	createTestUser(t, store, "user_2", "other@example.com")
+
+	for _, slug := range []string{"details", "weakauras"} {
+		addon := Addon{Id: "addon_" + slug, UserId: "user_1", GameVersion: Retail, Slug: slug, Name: slug, Channel: ChannelRelease, Directories: []string{}}
+		if _, err := store.SaveAddon(&addon, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.DeleteAddon("user_1", Retail, "details"); err != nil {
+		t.Fatal(err)
+	}
+	other := Addon{Id: "addon_other", UserId: "user_2", GameVersion: Retail, Slug: "details", Name: "details", Channel: ChannelRelease, Directories: []string{}}
+	if _, err := store.SaveAddon(&other, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := store.GetAddonChanges("user_1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Cursor != 3 || len(changes.Addons) != 1 || changes.Addons[0].Slug != "weakauras" ||
+		len(changes.Deleted) != 1 || changes.Deleted[0].Slug != "details" {
+		t.Fatalf("expected weakauras saved and details deleted at cursor 3, got %+v", changes)
+	}
+
+	// Each user counts their own changes
+	otherChanges, err := store.GetAddonChanges("user_2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherChanges.Cursor != 1 || len(otherChanges.Addons) != 1 || len(otherChanges.Deleted) != 0 {
+		t.Fatalf("expected only the addon of the other user at cursor 1, got %+v", otherChanges)
+	}
+
+	changes, err = store.GetAddonChanges("user_1", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Cursor != 3 || len(changes.Addons) != 0 || len(changes.Deleted) != 0 {
+		t.Fatalf("expected no changes after the last cursor, got %+v", changes)
+	}
+
+	addon := Addon{Id: "addon_details", UserId: "user_1", GameVersion: Retail, Slug: "details", Name: "details", Channel: ChannelRelease, Directories: []string{}}
+	if _, err := store.SaveAddon(&addon, nil); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = store.GetAddonChanges("user_1", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Cursor != 4 || len(changes.Addons) != 1 || changes.Addons[0].Slug != "details" || len(changes.Deleted) != 0 {
+		t.Fatalf("expected details saved again at cursor 4, got %+v", changes)
+	}
+}
+
+func TestMigrationKeepsAddonChangeCursors(t *testing.T) {
+	store := newTestStore(t)
+	migrateDownTo(t, store, 13)
+	createTestUser(t, store, "user_1", "user@example.com")
+	createTestUser(t, store, "user_2", "other@example.com")
+	for _, userId := range []string{"user_1", "user_2", "user_1"} {
+		err := store.db.Exec("INSERT INTO addon_changes (user_id, game_version, slug, deleted, created_at) VALUES (?, ?, ?, ?, ?)",
+			userId, Retail, "details", false, time.Now()).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := store.GetAddonChanges("user_1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Cursor != 3 || len(changes.Deleted) != 0 {
+		t.Fatalf("expected the cursors given before to be kept, got %+v", changes)
+	}
+	addon := Addon{Id: "addon_1", UserId: "user_1", GameVersion: Retail, Slug: "weakauras", Name: "WeakAuras", Channel: ChannelRelease, Directories: []string{}}
+	if _, err := store.SaveAddon(&addon, nil); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = store.GetAddonChanges("user_1", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Cursor != 4 || len(changes.Addons) != 1 {
+		t.Fatalf("expected the next change after the kept cursors, got %+v", changes)
+	}
+}
+
+func TestStoreDeleteUser(t *testing.T) {
+	store := newTestStore(t)
+	createTestUser(t, store, "user_1", "user@example.com")
+	createTestUser(t, store, "user_2", "other@example.com")
+	now := time.Now()
+	check := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Everything the user saved, with an addon and a session of the other user to keep
+	for _, addon := range []Addon{
+		{Id: "addon_1", UserId: "user_1", GameVersion: Retail, Slug: "details", Name: "details", Channel: ChannelRelease, Directories: []string{}},
+		{Id: "addon_2", UserId: "user_2", GameVersion: Retail, Slug: "details", Name: "details", Channel: ChannelRelease, Directories: []string{}},
+	} {
+		_, err := store.SaveAddon(&addon, nil)
+		check(err)
+	}
+	device := Device{Id: "device_1", UserId: "user_1", Name: "desktop", Platform: "windows", LastSeenAt: now}
+	check(store.SaveDevice(&device))
+	check(store.ReplaceDeviceAddons(device.Id, []DeviceAddon{{DeviceId: device.Id, GameVersion: Retail, Slug: "details", Version: "1.0.0", ReportedAt: now}}))
+	check(store.CreateSession(&Session{Id: "session_1", UserId: "user_1", RefreshTokenHash: "refresh_1", ExpiresAt: now.Add(time.Hour)}))
+	check(store.CreateSession(&Session{Id: "session_2", UserId: "user_2", RefreshTokenHash: "refresh_2", ExpiresAt: now.Add(time.Hour)}))
+	check(store.CreatePersonalAccessToken(&PersonalAccessToken{Id: "pat_1", UserId: "user_1", Name: "ci", Scope: ScopeAddonsRead, TokenHash: "pat_1"}))
+	check(store.CreatePasswordResetToken(&PasswordResetToken{Id: "reset_1", UserId: "user_1", TokenHash: "reset_1", ExpiresAt: now.Add(time.Hour)}))
+
+	// A shared collection with a subscriber, and a subscription to a collection of the other user
+	shareCode := "share_1"
+	check(store.CreateCollection(&Collection{Id: "collection_1", UserId: "user_1", Name: "raid", ShareCode: &shareCode}))
+	check(store.SaveCollectionAddon(&CollectionAddon{Id: "collection_addon_1", CollectionId: "collection_1", GameVersion: Retail, Slug: "details", Name: "details", Provider: Curse}))
+	check(store.SubscribeToCollection("user_2", "collection_1"))
+	check(store.CreateCollection(&Collection{Id: "collection_2", UserId: "user_2", Name: "pvp"}))
+	check(store.SubscribeToCollection("user_1", "collection_2"))
+
+	// An owned organization with an addon and an invitation, and a membership and an invitation in the
+	// organization of the other user
+	check(store.CreateOrganization(&Organization{Id: "org_1", Name: "guild"}, "user_1"))
+	check(store.SaveOrganizationAddon(&OrganizationAddon{Id: "org_addon_1", OrganizationId: "org_1", GameVersion: Retail, Slug: "details", Name: "details", Provider: Curse, Requirement: RequirementRequired}))
+	check(store.SaveOrganizationInvitation(&OrganizationInvitation{Id: "invitation_1", OrganizationId: "org_1", Email: "friend@example.com", Role: RoleMember, TokenHash: "invitation_1"}))
+	check(store.CreateOrganization(&Organization{Id: "org_2", Name: "other guild"}, "user_2"))
+	check(store.SaveOrganizationMember(&OrganizationMember{OrganizationId: "org_2", UserId: "user_1", Role: RoleMember}))
+	check(store.SaveOrganizationInvitation(&OrganizationInvitation{Id: "invitation_2", OrganizationId: "org_2", Email: "user@example.com", Role: RoleOfficer, TokenHash: "invitation_2"}))
+
+	check(store.DeleteUser("user_1"))
+
+	// Only the rows of the other user are left
+	expectedCounts := []struct {
+		model interface{}
+		count int64
+	}{
+		{&User{}, 1},
+		{&Addon{}, 1},
+		{&AddonChange{}, 1},
+		{&AddonChangeCounter{}, 1},
+		{&Device{}, 0},
+		{&DeviceAddon{}, 0},
+		{&Session{}, 1},
+		{&PersonalAccessToken{}, 0},
+		{&PasswordResetToken{}, 0},
+		{&Collection{}, 1},
+		{&CollectionAddon{}, 0},
+		{&CollectionSubscription{}, 0},
+		{&Organization{}, 1},
+		{&OrganizationMember{}, 1},
+		{&OrganizationAddon{}, 0},
+		{&OrganizationInvitation{}, 0},
+	}
+	for _, expected := range expectedCounts {
+		var count int64
+		check(store.db.Model(expected.model).Count(&count).Error)
+		if count != expected.count {
+			t.Errorf("%T: expected %d rows, got %d", expected.model, expected.count, count)
+		}
+	}
+	if _, err := store.GetUserById("user_2"); err != nil {
+		t.Fatalf("expected the other user to be kept, got %v", err)
+	}
+	if _, err := store.GetOrganization("org_2"); err != nil {
+		t.Fatalf("expected the organization of the other user to be kept, got %v", err)
+	}
+
+	if err := store.DeleteUser("user_1"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound for a deleted user, got %v", err)
+	}
+}
+
+func TestStoreDeleteUserOwningAnOrganizationWithMembers(t *testing.T) {
+	store := newTestStore(t)
+	createTestUser(t, store, "user_1", "user@example.com")
+	createTestUser(t, store, "user_2", "other@example.com")
+	if err := store.CreateOrganization(&Organization{Id: "org_1", Name: "guild"}, "user_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveOrganizationMember(&OrganizationMember{OrganizationId: "org_1", UserId: "user_2", Role: RoleMember}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.DeleteUser("user_1"); err != ErrOrganizationHasMembers {
+		t.Fatalf("expected ErrOrganizationHasMembers, got %v", err)
+	}
+	if _, err := store.GetUserById("user_1"); err != nil {
+		t.Fatalf("expected the user to be kept, got %v", err)
+	}
+	if _, err := store.GetOrganizationMember("org_1", "user_2"); err != nil {
+		t.Fatalf("expected the member to be kept, got %v", err)
+	}
+
+	// The user can leave once the organization has no other member
+	if err := store.DeleteOrganizationMember("org_1", "user_2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteUser("user_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetOrganization("org_1"); err != ErrNotFound {
+		t.Fatalf("expected the organization to be deleted with its owner, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wowa-api"
+)
+
+const personalAccessTokenPrefix = "wowa_pat_"
+
+type Scope = api.Scope
+
+const (
+	ScopeAddonsRead  = api.ScopeAddonsRead
+	ScopeAddonsWrite = api.ScopeAddonsWrite
+	ScopeAccount     = api.ScopeAccount
+)
+
+type PersonalAccessToken struct {
+	Id         string     `gorm:"primarykey;not null" json:"id"`
+	UserId     string     `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Scope      Scope      `gorm:"not null" json:"scope"`
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `gorm:"not null" json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	User       User       `json:"-"`
+}
+
+// toApiPersonalAccessToken returns the token as sent to the clients, without its hash.
+func toApiPersonalAccessToken(personalAccessToken PersonalAccessToken) api.PersonalAccessToken {
+	return api.PersonalAccessToken{
+		Id:         personalAccessToken.Id,
+		UserId:     personalAccessToken.UserId,
+		Name:       personalAccessToken.Name,
+		Scope:      personalAccessToken.Scope,
+		LastUsedAt: personalAccessToken.LastUsedAt,
+		CreatedAt:  personalAccessToken.CreatedAt,
+		UpdatedAt:  personalAccessToken.UpdatedAt,
+	}
+}
+
+func toApiPersonalAccessTokens(personalAccessTokens []PersonalAccessToken) []api.PersonalAccessToken {
+	apiPersonalAccessTokens := []api.PersonalAccessToken{}
+	for _, personalAccessToken := range personalAccessTokens {
+		apiPersonalAccessTokens = append(apiPersonalAccessTokens, toApiPersonalAccessToken(personalAccessToken))
+	}
+	return apiPersonalAccessTokens
+}
+
+// hasScope reports whether a token granted the given scope can be used for the required one.
+func hasScope(granted Scope, required Scope) bool {
+	if granted == required {
+		return true
+	}
+	return granted == ScopeAddonsWrite && required == ScopeAddonsRead
+}
+
+// authenticatePersonalAccessToken returns the personal access token, or writes the error response and returns nil.
+func authenticatePersonalAccessToken(store Store, w http.ResponseWriter, r *http.Request, tokenString string) *PersonalAccessToken {
+	personalAccessToken, err := store.GetPersonalAccessTokenByHash(hashSecret(tokenString))
+	if err != nil {
+		if err != ErrNotFound {
+			writeInternalError(w, r, err)
+			return nil
+		}
+		writeError(w, r, http.StatusUnauthorized, api.ErrorCodeInvalidToken, "Unauthorized (invalid token)")
+		return nil
+	}
+
+	err = store.TouchPersonalAccessToken(personalAccessToken.Id, time.Now())
+	if err != nil {
+		// Not worth failing the request for
+		slog.WarnContext(r.Context(), "Failed to touch the personal access token", "error", err)
+	}
+
+	return personalAccessToken
+}
+
+func createPersonalAccessTokenHandler(store Store, validate *validator.Validate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		var createRequest api.CreatePersonalAccessTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&createRequest); err != nil {
+			writeBadRequest(w, r)
+			return
+		}
+		if err := validate.Struct(createRequest); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		token, tokenHash, err := generateSecret(personalAccessTokenPrefix)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		personalAccessToken := PersonalAccessToken{
+			Id:        "pat_" + uuid.New().String(),
+			UserId:    userId,
+			Name:      createRequest.Name,
+			Scope:     createRequest.Scope,
+			TokenHash: tokenHash,
+		}
+		err = store.CreatePersonalAccessToken(&personalAccessToken)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(api.CreatedPersonalAccessToken{
+			PersonalAccessToken: toApiPersonalAccessToken(personalAccessToken),
+			Token:               token,
+		})
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+}
+
+func getPersonalAccessTokensHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		personalAccessTokens, err := store.GetPersonalAccessTokens(userId)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		err = json.NewEncoder(w).Encode(toApiPersonalAccessTokens(personalAccessTokens))
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+}
+
+func deletePersonalAccessTokenHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := getUserId(r)
+
+		id := mux.Vars(r)["id"]
+
+		err := store.DeletePersonalAccessToken(userId, id)
+		if err != nil {
+			if err == ErrNotFound {
+				writeNotFound(w, r)
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"wowa-api"
+)
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		granted  Scope
+		required Scope
+		expected bool
+	}{
+		{ScopeAddonsRead, ScopeAddonsRead, true},
+		{ScopeAddonsRead, ScopeAddonsWrite, false},
+		{ScopeAddonsRead, ScopeAccount, false},
+		{ScopeAddonsWrite, ScopeAddonsRead, true},
+		{ScopeAddonsWrite, ScopeAddonsWrite, true},
+		{ScopeAddonsWrite, ScopeAccount, false},
+		{ScopeAccount, ScopeAccount, true},
+	}
+	for _, test := range tests {
+		if actual := hasScope(test.granted, test.required); actual != test.expected {
+			t.Errorf("hasScope(%s, %s): expected %v, got %v", test.granted, test.required, test.expected, actual)
+		}
+	}
+}
+
+// createPersonalAccessToken creates a personal access token with the scope and returns it.
+func createPersonalAccessToken(t *testing.T, server *httptest.Server, accessToken string, scope Scope) api.CreatedPersonalAccessToken {
+	t.Helper()
+	var created api.CreatedPersonalAccessToken
+	resp := doJson(t, server, "POST", "/tokens", accessToken, api.CreatePersonalAccessTokenRequest{Name: "scheduled task", Scope: scope}, &created)
+	expectStatus(t, resp, http.StatusOK)
+	return created
+}
+
+// expectInsufficientScope checks that the request is forbidden to the token.
+func expectInsufficientScope(t *testing.T, server *httptest.Server, req *http.Request) {
+	t.Helper()
+	resp, errorResponse := doError(t, server, req)
+	if resp.StatusCode != http.StatusForbidden || errorResponse.Code != api.ErrorCodeInsufficientScope {
+		t.Fatalf("expected the token to miss the scope of %s %s, got %d %s", req.Method, req.URL.Path, resp.StatusCode, errorResponse.Code)
+	}
+}
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	server := newTestServer(t, newTestStore(t))
+	accessToken := register(t, server, "user@example.com")
+	readToken := createPersonalAccessToken(t, server, accessToken, ScopeAddonsRead)
+	writeToken := createPersonalAccessToken(t, server, accessToken, ScopeAddonsWrite)
+
+	addAddonRequest := api.AddAddonRequest{
+		GameVersion: api.Retail,
+		Slug:        "details",
+		PutAddonRequest: api.PutAddonRequest{
+			Name:       "Details! Damage Meter",
+			Author:     "Terciob",
+			Provider:   api.Curse,
+			ExternalId: "61284",
+			Url:        "https://www.curseforge.com/wow/addons/details",
+			Version:    "1.0.0",
+		},
+	}
+
+	// A read token reads the addons, and a write token saves them too
+	resp := doJson(t, server, "GET", "/addons", readToken.Token, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	expectInsufficientScope(t, server, newJsonRequest(t, server, "POST", "/addons", readToken.Token, addAddonRequest))
+	resp = doJson(t, server, "POST", "/addons", writeToken.Token, addAddonRequest, nil)
+	expectStatus(t, resp, http.StatusCreated)
+	resp = doJson(t, server, "GET", "/addons", writeToken.Token, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	// Neither can manage the account, which needs a session
+	for _, token := range []string{readToken.Token, writeToken.Token} {
+		expectInsufficientScope(t, server, newJsonRequest(t, server, "GET", "/tokens", token, nil))
+		expectInsufficientScope(t, server, newJsonRequest(t, server, "POST", "/tokens", token, api.CreatePersonalAccessTokenRequest{Name: "other", Scope: ScopeAddonsWrite}))
+		expectInsufficientScope(t, server, newJsonRequest(t, server, "DELETE", "/tokens/"+readToken.Id, token, nil))
+		expectInsufficientScope(t, server, newJsonRequest(t, server, "POST", "/password/change", token, ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "new password"}))
+		expectInsufficientScope(t, server, newJsonRequest(t, server, "GET", "/me/export", token, nil))
+		expectInsufficientScope(t, server, newJsonRequest(t, server, "DELETE", "/me", token, DeleteAccountRequest{Password: "password123"}))
+	}
+
+	// An account scope cannot be granted to a token
+	resp = doJson(t, server, "POST", "/tokens", accessToken, api.CreatePersonalAccessTokenRequest{Name: "account", Scope: ScopeAccount}, nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+}
+
+func TestPersonalAccessTokenRevocation(t *testing.T) {
+	server := newTestServer(t, newTestStore(t))
+	accessToken := register(t, server, "user@example.com")
+	token := createPersonalAccessToken(t, server, accessToken, ScopeAddonsRead)
+
+	resp := doJson(t, server, "GET", "/addons", token.Token, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var tokens []api.PersonalAccessToken
+	resp = doJson(t, server, "GET", "/tokens", accessToken, nil, &tokens)
+	expectStatus(t, resp, http.StatusOK)
+	if len(tokens) != 1 || tokens[0].Id != token.Id || tokens[0].LastUsedAt == nil {
+		t.Fatalf("expected the token to be listed as used, got %+v", tokens)
+	}
+
+	resp = doJson(t, server, "DELETE", "/tokens/"+token.Id, accessToken, nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	expectInvalidToken(t, server, newJsonRequest(t, server, "GET", "/addons", token.Token, nil))
+	expectInvalidToken(t, server, newJsonRequest(t, server, "GET", "/addons", personalAccessTokenPrefix+"unknown", nil))
+}